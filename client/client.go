@@ -0,0 +1,303 @@
+// Package client is a Go client of the dg-cal API described by
+// /api/openapi.json. Its types mirror the schemas of the document, the
+// contract tests validate them against it.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Codes of Error, see the Error schema.
+const ERROR_INVALID_REQUEST = "invalid_request"
+const ERROR_INVALID_PARAMETER = "invalid_parameter"
+const ERROR_UNSUPPORTED_MEDIA_TYPE = "unsupported_media_type"
+const ERROR_UNAUTHORIZED = "unauthorized"
+const ERROR_FORBIDDEN = "forbidden"
+const ERROR_NOT_FOUND = "not_found"
+const ERROR_TOO_MANY_REQUESTS = "too_many_requests"
+const ERROR_INTERNAL = "internal_error"
+
+// Error is returned for all responses with an error status.
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// RetryAfter is set for ERROR_TOO_MANY_REQUESTS
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("dg-cal api: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+type Pagination struct {
+	Page    int `json:"page"`
+	PerPage int `json:"perPage"`
+	Total   int `json:"total"`
+	Pages   int `json:"pages"`
+}
+
+type Page[T any] struct {
+	Data       []T        `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+type Registration struct {
+	Title     string    `json:"title"`
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+}
+
+type Tournament struct {
+	Id            int            `json:"id"`
+	Title         string         `json:"title"`
+	Status        string         `json:"status"`
+	StartDate     time.Time      `json:"startDate"`
+	EndDate       time.Time      `json:"endDate"`
+	Location      string         `json:"location"`
+	GeoLocation   string         `json:"geoLocation,omitempty"`
+	Series        []string       `json:"series"`
+	PdgaTier      string         `json:"pdgaTier,omitempty"`
+	PdgaId        string         `json:"pdgaId,omitempty"`
+	DRating       bool           `json:"dRating"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+	Registrations []Registration `json:"registrations"`
+}
+
+// TournamentDetail adds the earlier states of the tournament, newest first.
+type TournamentDetail struct {
+	Tournament
+	History []Tournament `json:"history"`
+}
+
+type Rules struct {
+	PdgaTiers   []string `json:"pdgaTiers"`
+	DRatingOnly bool     `json:"dRatingOnly"`
+	// From and To are dates like 2026-05-01
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Location string   `json:"location,omitempty"`
+	Regex    bool     `json:"regex"`
+	Status   []string `json:"status"`
+}
+
+type CalendarConfig struct {
+	Tournaments       []int    `json:"tournaments"`
+	Series            []string `json:"series"`
+	Tasks             bool     `json:"tasks"`
+	Rules             Rules    `json:"rules"`
+	Exclude           []int    `json:"exclude"`
+	Inherit           []string `json:"inherit"`
+	ConflictWindow    int      `json:"conflictWindow"`
+	AnnotateConflicts bool     `json:"annotateConflicts"`
+}
+
+type Calendar struct {
+	Id          string         `json:"id"`
+	Title       string         `json:"title"`
+	FeedUrl     string         `json:"feedUrl"`
+	Role        string         `json:"role"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	RetrievedAt *time.Time     `json:"retrievedAt"`
+	Config      CalendarConfig `json:"config"`
+}
+
+type CalendarInput struct {
+	Title  string          `json:"title"`
+	Config *CalendarConfig `json:"config"`
+}
+
+// CreatedCalendar holds the edit code of a new calendar, the token of all
+// further requests. It is not shown again.
+type CreatedCalendar struct {
+	EditCode string   `json:"editCode"`
+	Calendar Calendar `json:"calendar"`
+}
+
+// TournamentFilter are the query parameters of ListTournaments, zero values
+// don't filter.
+type TournamentFilter struct {
+	// From and To are dates like 2026-05-01
+	From     string
+	To       string
+	Status   []string
+	Series   []string
+	Tiers    []string
+	DRating  bool
+	Query    string
+	Location string
+	Page     int
+	PerPage  int
+}
+
+func (f TournamentFilter) values() url.Values {
+	query := url.Values{}
+	setString(query, "from", f.From)
+	setString(query, "to", f.To)
+	query["status"] = f.Status
+	query["series"] = f.Series
+	query["tier"] = f.Tiers
+	if f.DRating {
+		query.Set("drating", "true")
+	}
+	setString(query, "q", f.Query)
+	setString(query, "location", f.Location)
+	setPage(query, f.Page, f.PerPage)
+	return query
+}
+
+type Client struct {
+	baseUrl    string
+	httpClient *http.Client
+}
+
+// NewClient creates a client of the server at baseUrl, like
+// https://dg-cal.example.com. It uses http.DefaultClient if httpClient is
+// nil.
+func NewClient(baseUrl string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseUrl: strings.TrimSuffix(baseUrl, "/"), httpClient: httpClient}
+}
+
+func (c *Client) ListTournaments(ctx context.Context, filter TournamentFilter) (*Page[Tournament], error) {
+	return request[Page[Tournament]](ctx, c, http.MethodGet, "/api/v1/tournaments", filter.values(), "", nil)
+}
+
+func (c *Client) GetTournament(ctx context.Context, id int) (*TournamentDetail, error) {
+	return request[TournamentDetail](ctx, c, http.MethodGet, "/api/v1/tournaments/"+strconv.Itoa(id), nil, "", nil)
+}
+
+// ListSeries lists the series with tournaments that are neither done nor
+// cancelled, or all series if all is set.
+func (c *Client) ListSeries(ctx context.Context, all bool, page int, perPage int) (*Page[string], error) {
+	query := url.Values{}
+	if all {
+		query.Set("active", "false")
+	}
+	setPage(query, page, perPage)
+	return request[Page[string]](ctx, c, http.MethodGet, "/api/v1/series", query, "", nil)
+}
+
+func (c *Client) CreateCalendar(ctx context.Context, input CalendarInput) (*CreatedCalendar, error) {
+	return request[CreatedCalendar](ctx, c, http.MethodPost, "/api/v1/calendars", nil, "", input)
+}
+
+// GetCalendar returns the calendar of token, its edit code or the secret of
+// an invited editor.
+func (c *Client) GetCalendar(ctx context.Context, token string) (*Calendar, error) {
+	return request[Calendar](ctx, c, http.MethodGet, "/api/v1/calendar", nil, token, nil)
+}
+
+func (c *Client) UpdateCalendar(ctx context.Context, token string, input CalendarInput) (*Calendar, error) {
+	return request[Calendar](ctx, c, http.MethodPut, "/api/v1/calendar", nil, token, input)
+}
+
+func (c *Client) DeleteCalendar(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/calendar", nil, token, nil, nil)
+}
+
+// ListCalendarTournaments lists the tournaments in the feed of the calendar.
+func (c *Client) ListCalendarTournaments(ctx context.Context, token string, page int, perPage int) (*Page[Tournament], error) {
+	query := url.Values{}
+	setPage(query, page, perPage)
+	return request[Page[Tournament]](ctx, c, http.MethodGet, "/api/v1/calendar/tournaments", query, token, nil)
+}
+
+func request[T any](ctx context.Context, c *Client, method string, path string, query url.Values, token string, body any) (*T, error) {
+	var result T
+	if err := c.do(ctx, method, path, query, token, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// do sends body as JSON and decodes the response into result, unless it is
+// nil.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, token string, body any, result any) error {
+	u := c.baseUrl + path
+	if encoded := query.Encode(); encoded != "" {
+		u += "?" + encoded
+	}
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return responseError(resp)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+func responseError(resp *http.Response) error {
+	apiErr := &Error{Status: resp.StatusCode}
+	var response struct {
+		Error *Error `json:"error"`
+	}
+	response.Error = apiErr
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || apiErr.Code == "" {
+		// not the API, e.g. a proxy in front of it
+		apiErr.Code = ERROR_INTERNAL
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+func setString(query url.Values, name string, value string) {
+	if value != "" {
+		query.Set(name, value)
+	}
+}
+
+func setPage(query url.Values, page int, perPage int) {
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if perPage > 0 {
+		query.Set("perPage", strconv.Itoa(perPage))
+	}
+}
@@ -0,0 +1,440 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/client"
+	"github.com/resterle/dg-cal/v2/db"
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/resterle/dg-cal/v2/service"
+	"github.com/resterle/dg-cal/v2/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+var testStart = time.Date(2030, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// testGto has three tournaments, the third one cancelled.
+type testGto struct{}
+
+func (g *testGto) FetchEventDetails(id int) (*model.EventDetails, error) {
+	start := testStart.AddDate(0, 0, 7*id)
+	details := &model.EventDetails{
+		ID:          id,
+		Title:       fmt.Sprintf("Open %d", id),
+		StartDate:   start,
+		EndDate:     start.Add(24 * time.Hour),
+		Location:    "Berlin",
+		GeoLocation: "52.5,13.4",
+		Series:      []string{"Liga Nord"},
+		PDGATier:    "C",
+		RegistrationPhases: []model.RegistrationPhase{
+			{Name: "Phase 1", StartDate: start.AddDate(0, -1, 0), EndDate: start.AddDate(0, 0, -7)},
+		},
+	}
+	if id == 2 {
+		details.Series = []string{"Liga Süd"}
+		details.PDGATier = "B"
+		details.DRatingConsideration = true
+	}
+	return details, nil
+}
+
+func (g *testGto) FetchTournaments() (map[int]*model.Tournament, error) {
+	return map[int]*model.Tournament{
+		1: {Id: 1, Status: model.TOURNAMENT_STATUS_REGISTRATION, UpdatedAt: testStart},
+		2: {Id: 2, Status: model.TOURNAMENT_STATUS_ANNOUNCED, UpdatedAt: testStart},
+		3: {Id: 3, Status: model.TOURNAMENT_STATUS_CANCELLED, UpdatedAt: testStart},
+	}, nil
+}
+
+type exchange struct {
+	method string
+	path   string
+	status int
+	body   []byte
+}
+
+// recorder keeps all responses of the server to validate them against the
+// OpenAPI document.
+type recorder struct {
+	mu        sync.Mutex
+	exchanges []exchange
+}
+
+func (rec *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.exchanges = append(rec.exchanges, exchange{method: req.Method, path: req.URL.Path, status: resp.StatusCode, body: body})
+	return resp, nil
+}
+
+// newTestServer serves the API of an app backed by the real services and a
+// temporary database, like main does.
+func newTestServer(t *testing.T) *httptest.Server {
+	repo, err := db.NewRepo(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(repo.Close)
+
+	tournaments, err := service.NewTournamentService(repo, &testGto{})
+	require.NoError(t, err)
+	require.NoError(t, tournaments.Sync())
+	calendars := service.NewCalendarService(repo)
+
+	app := web.NewWebApp(tournaments, calendars, nil, nil, nil, nil, web.NewRateLimiter(nil, ""), time.Minute)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/openapi.json", app.OpenApiHandler)
+	app.RegisterApiRoutes(mux)
+	server := httptest.NewServer(web.SecurityMiddleware(mux))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func fetchSpec(t *testing.T, server *httptest.Server) map[string]any {
+	resp, err := http.Get(server.URL + "/api/openapi.json")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var spec map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&spec))
+	return spec
+}
+
+func TestContract(t *testing.T) {
+	server := newTestServer(t)
+	rec := &recorder{}
+	c := client.NewClient(server.URL, &http.Client{Transport: rec})
+	ctx := context.Background()
+
+	tournaments, err := c.ListTournaments(ctx, client.TournamentFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, tournaments.Pagination.Total)
+	require.Len(t, tournaments.Data, 3)
+	assert.Equal(t, "Open 1", tournaments.Data[0].Title)
+	assert.Equal(t, "52.5,13.4", tournaments.Data[0].GeoLocation)
+	require.Len(t, tournaments.Data[0].Registrations, 1)
+
+	tournaments, err = c.ListTournaments(ctx, client.TournamentFilter{Tiers: []string{"B"}, DRating: true})
+	require.NoError(t, err)
+	require.Len(t, tournaments.Data, 1)
+	assert.Equal(t, 2, tournaments.Data[0].Id)
+
+	tournaments, err = c.ListTournaments(ctx, client.TournamentFilter{Page: 2, PerPage: 2})
+	require.NoError(t, err)
+	assert.Equal(t, client.Pagination{Page: 2, PerPage: 2, Total: 3, Pages: 2}, tournaments.Pagination)
+
+	_, err = c.ListTournaments(ctx, client.TournamentFilter{From: "May"})
+	assertError(t, err, http.StatusBadRequest, client.ERROR_INVALID_PARAMETER)
+
+	tournament, err := c.GetTournament(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "Liga Süd", tournament.Series[0])
+	assert.NotNil(t, tournament.History)
+
+	_, err = c.GetTournament(ctx, 99)
+	assertError(t, err, http.StatusNotFound, client.ERROR_NOT_FOUND)
+
+	series, err := c.ListSeries(ctx, false, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Liga Nord", "Liga Süd"}, series.Data)
+
+	created, err := c.CreateCalendar(ctx, client.CalendarInput{
+		Title:  "Süden",
+		Config: &client.CalendarConfig{Series: []string{"Liga Süd"}, Tournaments: []int{1}, Tasks: true},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, created.EditCode)
+	assert.Equal(t, "OWNER", created.Calendar.Role)
+	assert.Nil(t, created.Calendar.RetrievedAt)
+	assert.Equal(t, server.URL+"/ical/"+created.Calendar.Id, created.Calendar.FeedUrl)
+
+	_, err = c.CreateCalendar(ctx, client.CalendarInput{})
+	assertError(t, err, http.StatusBadRequest, client.ERROR_INVALID_REQUEST)
+
+	calendar, err := c.GetCalendar(ctx, created.EditCode)
+	require.NoError(t, err)
+	assert.Equal(t, created.Calendar, *calendar)
+
+	_, err = c.GetCalendar(ctx, "unknown")
+	assertError(t, err, http.StatusUnauthorized, client.ERROR_UNAUTHORIZED)
+
+	inCalendar, err := c.ListCalendarTournaments(ctx, created.EditCode, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, inCalendar.Data, 2)
+	assert.Equal(t, []int{1, 2}, []int{inCalendar.Data[0].Id, inCalendar.Data[1].Id})
+
+	calendar, err = c.UpdateCalendar(ctx, created.EditCode, client.CalendarInput{
+		Title:  "Alles",
+		Config: &client.CalendarConfig{Rules: client.Rules{Status: []string{"ANNOUNCED"}}, ConflictWindow: 30},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Alles", calendar.Title)
+	assert.Equal(t, []string{"ANNOUNCED"}, calendar.Config.Rules.Status)
+	assert.Equal(t, 30, calendar.Config.ConflictWindow)
+
+	_, err = c.UpdateCalendar(ctx, created.EditCode, client.CalendarInput{Title: "Alles", Config: &client.CalendarConfig{ConflictWindow: -1}})
+	assertError(t, err, http.StatusBadRequest, client.ERROR_INVALID_REQUEST)
+
+	require.NoError(t, c.DeleteCalendar(ctx, created.EditCode))
+	_, err = c.GetCalendar(ctx, created.EditCode)
+	assertError(t, err, http.StatusUnauthorized, client.ERROR_UNAUTHORIZED)
+
+	// Every response matches the document, and every documented operation
+	// was called.
+	spec := fetchSpec(t, server)
+	called := map[string]bool{}
+	for _, e := range rec.exchanges {
+		template, operation := findOperation(spec, e.method, e.path)
+		require.NotNil(t, operation, "%s %s is documented", e.method, e.path)
+		called[e.method+" "+template] = true
+
+		responses := operation["responses"].(map[string]any)
+		response := resolve(spec, responses[fmt.Sprint(e.status)])
+		require.NotNil(t, response, "%s %s documents status %d", e.method, e.path, e.status)
+		content, ok := response["content"].(map[string]any)
+		if !ok {
+			assert.Empty(t, e.body, "%s %s has no content", e.method, e.path)
+			continue
+		}
+		var body any
+		require.NoError(t, json.Unmarshal(e.body, &body), "%s %s", e.method, e.path)
+		schema := content["application/json"].(map[string]any)["schema"]
+		for _, problem := range validate(spec, schema, body, "body") {
+			t.Errorf("%s %s %d: %s", e.method, e.path, e.status, problem)
+		}
+	}
+	for path, item := range spec["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			assert.True(t, called[strings.ToUpper(method)+" "+path], "%s %s was called", method, path)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":"too_many_requests","message":"Too many requests"}}`))
+	}))
+	defer server.Close()
+
+	_, err := client.NewClient(server.URL, nil).GetTournament(context.Background(), 1)
+	apiErr := assertError(t, err, http.StatusTooManyRequests, client.ERROR_TOO_MANY_REQUESTS)
+	assert.Equal(t, time.Minute, apiErr.RetryAfter)
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	})
+	_, err = client.NewClient(server.URL, nil).GetTournament(context.Background(), 1)
+	assertError(t, err, http.StatusBadGateway, client.ERROR_INTERNAL)
+}
+
+// TestTypes compares the JSON fields of the client types with the
+// properties of the schemas.
+func TestTypes(t *testing.T) {
+	spec := fetchSpec(t, newTestServer(t))
+	schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+
+	for name, v := range map[string]any{
+		"Error":            client.Error{},
+		"Pagination":       client.Pagination{},
+		"Registration":     client.Registration{},
+		"Tournament":       client.Tournament{},
+		"TournamentDetail": client.TournamentDetail{},
+		"TournamentPage":   client.Page[client.Tournament]{},
+		"SeriesPage":       client.Page[string]{},
+		"Rules":            client.Rules{},
+		"CalendarConfig":   client.CalendarConfig{},
+		"Calendar":         client.Calendar{},
+		"CalendarInput":    client.CalendarInput{},
+		"CreatedCalendar":  client.CreatedCalendar{},
+	} {
+		properties := map[string]bool{}
+		schema := schemas[name].(map[string]any)
+		parts := []any{schema}
+		if allOf, ok := schema["allOf"].([]any); ok {
+			parts = allOf
+		}
+		for _, part := range parts {
+			for property := range resolve(spec, part)["properties"].(map[string]any) {
+				properties[property] = true
+			}
+		}
+
+		fields := jsonFields(reflect.TypeOf(v))
+		for _, field := range fields {
+			assert.True(t, properties[field], "%s.%s is documented", name, field)
+		}
+		for property := range properties {
+			assert.Contains(t, fields, property, "%s.%s exists", name, property)
+		}
+	}
+}
+
+func assertError(t *testing.T, err error, status int, code string) *client.Error {
+	t.Helper()
+	apiErr, ok := err.(*client.Error)
+	require.True(t, ok, "%v is an *client.Error", err)
+	assert.Equal(t, status, apiErr.Status)
+	assert.Equal(t, code, apiErr.Code)
+	return apiErr
+}
+
+// findOperation returns the documented path matching path and its
+// operation.
+func findOperation(spec map[string]any, method string, path string) (string, map[string]any) {
+	for template, item := range spec["paths"].(map[string]any) {
+		pattern := "^" + regexp.MustCompile(`\\\{[^}]+\\\}`).ReplaceAllString(regexp.QuoteMeta(template), "[^/]+") + "$"
+		if !regexp.MustCompile(pattern).MatchString(path) {
+			continue
+		}
+		if operation, ok := item.(map[string]any)[strings.ToLower(method)].(map[string]any); ok {
+			return template, operation
+		}
+	}
+	return "", nil
+}
+
+// resolve follows a local $ref like #/components/schemas/Tournament.
+func resolve(spec map[string]any, v any) map[string]any {
+	object, _ := v.(map[string]any)
+	ref, ok := object["$ref"].(string)
+	if !ok {
+		return object
+	}
+	var target any = spec
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		target = target.(map[string]any)[key]
+	}
+	return resolve(spec, target)
+}
+
+// validate checks value against the subset of JSON schema used by the
+// document. Objects must not have undocumented properties.
+func validate(spec map[string]any, s any, value any, at string) []string {
+	schema := resolve(spec, s)
+	if allOf, ok := schema["allOf"].([]any); ok {
+		merged := map[string]any{"type": "object", "properties": map[string]any{}, "required": []any{}}
+		for _, part := range allOf {
+			part := resolve(spec, part)
+			for name, property := range part["properties"].(map[string]any) {
+				merged["properties"].(map[string]any)[name] = property
+			}
+			if required, ok := part["required"].([]any); ok {
+				merged["required"] = append(merged["required"].([]any), required...)
+			}
+		}
+		schema = merged
+	}
+
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{at + " is null"}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			found = found || e == value
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s: %v is not one of %v", at, value, enum)}
+		}
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return []string{at + " is not an object"}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is missing", at, name))
+			}
+		}
+		for name, v := range object {
+			property, ok := properties[name]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is not documented", at, name))
+				continue
+			}
+			problems = append(problems, validate(spec, property, v, at+"."+name)...)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return []string{at + " is not an array"}
+		}
+		for i, item := range items {
+			problems = append(problems, validate(spec, schema["items"], item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{at + " is not a string"}
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a date-time", at, s))
+			}
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			return []string{at + " is not an integer"}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{at + " is not a boolean"}
+		}
+	}
+	return problems
+}
+
+// jsonFields returns the JSON names of the fields of a struct, including
+// embedded ones.
+func jsonFields(t reflect.Type) []string {
+	var fields []string
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
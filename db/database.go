@@ -86,6 +86,23 @@ func initDB(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create calendars table: %w", err)
 	}
 
+	// Email notification, recovery and retention columns added after the
+	// calendars table was created
+	for _, column := range [][2]string{
+		{"pending_email", "TEXT NOT NULL DEFAULT ''"},
+		{"email_token", "TEXT NOT NULL DEFAULT ''"},
+		{"email_token_expires_at", "DATETIME"},
+		{"unsubscribe_token", "TEXT NOT NULL DEFAULT ''"},
+		{"recovery_token", "TEXT NOT NULL DEFAULT ''"},
+		{"recovery_expires_at", "DATETIME"},
+		{"flagged_at", "DATETIME"},
+		{"deleted_at", "DATETIME"},
+	} {
+		if err := addColumn(db, "calendars", column[0], column[1]); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create subscriptions table
 	createSubscriptionsTable := `
 	CREATE TABLE IF NOT EXISTS subscriptions (
@@ -103,6 +120,146 @@ func initDB(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create subscriptions table: %w", err)
 	}
 
+	// Create notes table
+	createNotesTable := `
+	CREATE TABLE IF NOT EXISTS notes (
+		calendar_id TEXT NOT NULL,
+		tournament_id INTEGER NOT NULL,
+		updated_at DATETIME NOT NULL,
+		note TEXT NOT NULL,
+		FOREIGN KEY (calendar_id) REFERENCES calendars(id),
+		FOREIGN KEY (tournament_id) REFERENCES tournaments(id),
+		UNIQUE(calendar_id, tournament_id)
+	);`
+
+	if _, err := db.Exec(createNotesTable); err != nil {
+		return nil, fmt.Errorf("failed to create notes table: %w", err)
+	}
+
+	// Create outbox table
+	createOutboxTable := `
+	CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		recipient TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		sent_at DATETIME,
+		last_error TEXT NOT NULL DEFAULT '',
+		dedupe_key TEXT UNIQUE
+	);`
+
+	if _, err := db.Exec(createOutboxTable); err != nil {
+		return nil, fmt.Errorf("failed to create outbox table: %w", err)
+	}
+
+	// Create calendar aliases table, mapping revoked public ids to the current one
+	createAliasesTable := `
+	CREATE TABLE IF NOT EXISTS calendar_aliases (
+		id TEXT PRIMARY KEY,
+		calendar_id TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);`
+
+	if _, err := db.Exec(createAliasesTable); err != nil {
+		return nil, fmt.Errorf("failed to create calendar aliases table: %w", err)
+	}
+
+	// Create calendar editors table
+	createEditorsTable := `
+	CREATE TABLE IF NOT EXISTS calendar_editors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		calendar_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		role TEXT NOT NULL,
+		secret TEXT NOT NULL UNIQUE,
+		invite_token TEXT UNIQUE,
+		created_at DATETIME NOT NULL,
+		accepted_at DATETIME,
+		FOREIGN KEY (calendar_id) REFERENCES calendars(id)
+	);`
+
+	if _, err := db.Exec(createEditorsTable); err != nil {
+		return nil, fmt.Errorf("failed to create calendar editors table: %w", err)
+	}
+
+	// Create calendar audit table
+	createAuditTable := `
+	CREATE TABLE IF NOT EXISTS calendar_audit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		calendar_id TEXT NOT NULL,
+		editor TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		changes TEXT NOT NULL,
+		FOREIGN KEY (calendar_id) REFERENCES calendars(id)
+	);`
+
+	if _, err := db.Exec(createAuditTable); err != nil {
+		return nil, fmt.Errorf("failed to create calendar audit table: %w", err)
+	}
+
+	// Create calendar versions table
+	createVersionsTable := `
+	CREATE TABLE IF NOT EXISTS calendar_versions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		calendar_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		subscription_config TEXT NOT NULL,
+		editor TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (calendar_id) REFERENCES calendars(id)
+	);`
+
+	if _, err := db.Exec(createVersionsTable); err != nil {
+		return nil, fmt.Errorf("failed to create calendar versions table: %w", err)
+	}
+
+	// Create feed retrievals table, fetches are counted per day
+	createRetrievalsTable := `
+	CREATE TABLE IF NOT EXISTS feed_retrievals (
+		calendar_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		client TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		count INTEGER NOT NULL,
+		last_at DATETIME NOT NULL,
+		PRIMARY KEY (calendar_id, day, client, status),
+		FOREIGN KEY (calendar_id) REFERENCES calendars(id)
+	);`
+
+	if _, err := db.Exec(createRetrievalsTable); err != nil {
+		return nil, fmt.Errorf("failed to create feed retrievals table: %w", err)
+	}
+
+	// Create admin users table, passwords are stored as bcrypt hashes
+	createAdminUsersTable := `
+	CREATE TABLE IF NOT EXISTS admin_users (
+		username TEXT PRIMARY KEY,
+		password_hash TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);`
+
+	if _, err := db.Exec(createAdminUsersTable); err != nil {
+		return nil, fmt.Errorf("failed to create admin users table: %w", err)
+	}
+
+	// Create admin sessions table
+	createAdminSessionsTable := `
+	CREATE TABLE IF NOT EXISTS admin_sessions (
+		token TEXT PRIMARY KEY,
+		username TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL
+	);`
+
+	if _, err := db.Exec(createAdminSessionsTable); err != nil {
+		return nil, fmt.Errorf("failed to create admin sessions table: %w", err)
+	}
+
 	// Create subscriptions table
 	createHistoryTable := `
 	CREATE TABLE IF NOT EXISTS tournament_history (
@@ -121,6 +278,33 @@ func initDB(dbPath string) (*sql.DB, error) {
 	return db, nil
 }
 
+// addColumn adds a column to an existing table unless it is already there.
+func addColumn(db *sql.DB, table string, column string, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s to %s: %w", column, table, err)
+	}
+	return nil
+}
+
 func (r *Repo) Close() {
 	r.db.Close()
 }
@@ -295,10 +479,30 @@ func (r *Repo) UpsertRegistration(tournamentId int, registration *model.Registra
 }
 
 func (r *Repo) GetCalendars() ([]*model.Calendar, error) {
+	return r.getCalendars("deleted_at IS NULL")
+}
+
+// GetDeletedCalendars returns the calendars that were deleted but not purged
+// yet.
+func (r *Repo) GetDeletedCalendars() ([]*model.Calendar, error) {
+	return r.getCalendars("deleted_at IS NOT NULL")
+}
+
+// GetDeletedCalendar returns the calendar with id if it was deleted but not
+// purged yet, nil otherwise.
+func (r *Repo) GetDeletedCalendar(id string) (*model.Calendar, error) {
+	calendars, err := r.getCalendars("deleted_at IS NOT NULL AND id = ?", id)
+	if err != nil || len(calendars) == 0 {
+		return nil, err
+	}
+	return calendars[0], nil
+}
+
+func (r *Repo) getCalendars(where string, args ...any) ([]*model.Calendar, error) {
 	rows, err := r.db.Query(`
-        SELECT id, title, email, created_at, updated_at, subscription_config, retrieved_at
+        SELECT id, title, email, created_at, updated_at, subscription_config, retrieved_at, pending_email, flagged_at, deleted_at
         FROM calendars
-    `)
+        WHERE `+where, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -309,7 +513,7 @@ func (r *Repo) GetCalendars() ([]*model.Calendar, error) {
 		var c model.Calendar
 		var configJson string
 
-		err := rows.Scan(&c.Id, &c.Title, &c.Email, &c.CreatedAt, &c.UpdatedAt, &configJson, &c.RetrievedAt)
+		err := rows.Scan(&c.Id, &c.Title, &c.Email, &c.CreatedAt, &c.UpdatedAt, &configJson, &c.RetrievedAt, &c.PendingEmail, &c.FlaggedAt, &c.DeletedAt)
 
 		if err != nil {
 			return nil, err
@@ -356,8 +560,8 @@ func (r *Repo) GetCalendarByEditId(editId string) (*model.Calendar, error) {
 
 func (r *Repo) getCalendar(idColumn string, id string) (*model.Calendar, error) {
 	query := fmt.Sprintf(`
-		SELECT id, title, email, created_at, updated_at, subscription_config, retrieved_at
-		FROM calendars WHERE %s = ?`, idColumn)
+		SELECT id, title, email, created_at, updated_at, subscription_config, retrieved_at, pending_email, flagged_at
+		FROM calendars WHERE %s = ? AND deleted_at IS NULL`, idColumn)
 	rows, err := r.db.Query(query, id)
 
 	if err != nil {
@@ -368,7 +572,7 @@ func (r *Repo) getCalendar(idColumn string, id string) (*model.Calendar, error)
 	if rows.Next() {
 		var subscriptionConfigJson sql.NullString
 		c := model.Calendar{Config: &model.SubscriptionConfig{Tournaments: []int{}, Series: []string{}}}
-		rows.Scan(&c.Id, &c.Title, &c.Email, &c.CreatedAt, &c.UpdatedAt, &subscriptionConfigJson, &c.RetrievedAt)
+		rows.Scan(&c.Id, &c.Title, &c.Email, &c.CreatedAt, &c.UpdatedAt, &subscriptionConfigJson, &c.RetrievedAt, &c.PendingEmail, &c.FlaggedAt)
 
 		if subscriptionConfigJson.Valid {
 			if err := json.Unmarshal([]byte(subscriptionConfigJson.String), c.Config); err != nil {
@@ -390,13 +594,18 @@ func (r *Repo) UpdateCalendar(calendar *model.Calendar) error {
 		return err
 	}
 
+	now := time.Now()
 	_, err = r.db.Exec(`
 		UPDATE calendars
 		SET title = ?, updated_at = ?, subscription_config = ?
 		WHERE id = ?`,
-		calendar.Title, time.Now(), string(subscriptionConfigJson), calendar.Id)
+		calendar.Title, now, string(subscriptionConfigJson), calendar.Id)
+	if err != nil {
+		return err
+	}
 
-	return err
+	calendar.UpdatedAt = now
+	return nil
 }
 
 func (r *Repo) SetCalendarRetrievedAt(calendarId string) error {
@@ -409,16 +618,544 @@ func (r *Repo) SetCalendarRetrievedAt(calendarId string) error {
 	return err
 }
 
-func (r *Repo) DeleteCalendar(id string) error {
-	_, err := r.db.Exec("DELETE FROM calendars WHERE id = ?", id)
+// PurgeCalendar removes the calendar and everything stored for it.
+func (r *Repo) PurgeCalendar(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"subscriptions", "notes", "calendar_editors", "calendar_audit", "calendar_versions", "feed_retrievals", "calendar_aliases"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE calendar_id = ?", id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM calendars WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetFlaggedAt marks the calendar for deletion by the retention policy, nil
+// removes the mark.
+func (r *Repo) SetFlaggedAt(calendarId string, flaggedAt *time.Time) error {
+	_, err := r.db.Exec("UPDATE calendars SET flagged_at = ? WHERE id = ?", flaggedAt, calendarId)
+	return err
+}
+
+// SoftDeleteCalendar hides the calendar until it is purged with
+// PurgeCalendar or restored with RestoreCalendar. The retention flag is kept,
+// it marks the calendars deleted by the retention policy.
+func (r *Repo) SoftDeleteCalendar(calendarId string, deletedAt time.Time) error {
+	_, err := r.db.Exec("UPDATE calendars SET deleted_at = ? WHERE id = ?", deletedAt, calendarId)
+	return err
+}
+
+// TrashCalendar soft deletes the calendar on behalf of an admin. The retention
+// flag is removed, so the retention policy never purges it.
+func (r *Repo) TrashCalendar(calendarId string, deletedAt time.Time) error {
+	_, err := r.db.Exec("UPDATE calendars SET deleted_at = ?, flagged_at = NULL WHERE id = ?", deletedAt, calendarId)
+	return err
+}
+
+// RestoreCalendar undoes SoftDeleteCalendar and TrashCalendar. The retention flag is removed as
+// well, so the calendar gets a full grace period again.
+func (r *Repo) RestoreCalendar(calendarId string) error {
+	_, err := r.db.Exec("UPDATE calendars SET deleted_at = NULL, flagged_at = NULL WHERE id = ?", calendarId)
+	return err
+}
+
+// RenameCalendar changes the public id of a calendar and keeps the old id as
+// alias until expiresAt. Aliases of the old id are moved to the new one.
+func (r *Repo) RenameCalendar(oldId string, newId string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{"UPDATE calendars SET id = ?, updated_at = ? WHERE id = ?", []any{newId, now, oldId}},
+		{"UPDATE subscriptions SET calendar_id = ? WHERE calendar_id = ?", []any{newId, oldId}},
+		{"UPDATE notes SET calendar_id = ? WHERE calendar_id = ?", []any{newId, oldId}},
+		{"UPDATE calendar_editors SET calendar_id = ? WHERE calendar_id = ?", []any{newId, oldId}},
+		{"UPDATE calendar_audit SET calendar_id = ? WHERE calendar_id = ?", []any{newId, oldId}},
+		{"UPDATE calendar_versions SET calendar_id = ? WHERE calendar_id = ?", []any{newId, oldId}},
+		{"UPDATE feed_retrievals SET calendar_id = ? WHERE calendar_id = ?", []any{newId, oldId}},
+		{"UPDATE calendar_aliases SET calendar_id = ? WHERE calendar_id = ?", []any{newId, oldId}},
+		{"INSERT INTO calendar_aliases (id, calendar_id, created_at, expires_at) VALUES(?, ?, ?, ?)", []any{oldId, newId, now, expiresAt}},
+	}
+	for _, st := range statements {
+		if _, err := tx.Exec(st.query, st.args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetCalendarAlias returns the current id of the calendar formerly known as
+// id and until when the alias is valid. The id is empty if there is no alias.
+func (r *Repo) GetCalendarAlias(id string) (string, time.Time, error) {
+	var calendarId string
+	var expiresAt time.Time
+	err := r.db.QueryRow("SELECT calendar_id, expires_at FROM calendar_aliases WHERE id = ?", id).Scan(&calendarId, &expiresAt)
+	if err == sql.ErrNoRows {
+		return "", time.Time{}, nil
+	}
+	return calendarId, expiresAt, err
+}
+
+// SetPendingEmail stores an address waiting for confirmation with token.
+func (r *Repo) SetPendingEmail(calendarId string, email string, token string, expiresAt time.Time) error {
+	_, err := r.db.Exec("UPDATE calendars SET pending_email = ?, email_token = ?, email_token_expires_at = ? WHERE id = ?", email, token, expiresAt, calendarId)
+	return err
+}
+
+// ConfirmEmail makes the pending address of the calendar with token its email
+// and returns the calendar, or nil if no calendar waits for token or it expired.
+func (r *Repo) ConfirmEmail(token string, unsubscribeToken string, now time.Time) (*model.Calendar, error) {
+	var id string
+	err := r.db.QueryRow(`
+		UPDATE calendars
+		SET email = pending_email, pending_email = '', email_token = '', email_token_expires_at = NULL, unsubscribe_token = ?
+		WHERE email_token = ? AND pending_email != '' AND email_token_expires_at >= ?
+		RETURNING id`,
+		unsubscribeToken, token, now).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.GetCalendarById(id)
+}
+
+// GetUnsubscribeToken returns the token of the link that removes the email of the calendar.
+func (r *Repo) GetUnsubscribeToken(calendarId string) (string, error) {
+	var token string
+	err := r.db.QueryRow("SELECT unsubscribe_token FROM calendars WHERE id = ?", calendarId).Scan(&token)
+	return token, err
+}
+
+// ClearEmail removes the confirmed and pending address of the calendar.
+func (r *Repo) ClearEmail(calendarId string) error {
+	_, err := r.db.Exec(`
+		UPDATE calendars
+		SET email = '', pending_email = '', email_token = '', unsubscribe_token = '', recovery_token = ''
+		WHERE id = ?`,
+		calendarId)
+	return err
+}
+
+// Unsubscribe removes the address of the calendar with the unsubscribe token
+// and reports whether there was one.
+func (r *Repo) Unsubscribe(unsubscribeToken string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE calendars
+		SET email = '', pending_email = '', email_token = '', unsubscribe_token = '', recovery_token = ''
+		WHERE unsubscribe_token = ? AND unsubscribe_token != ''`,
+		unsubscribeToken)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetEditIdsByEmail returns the edit ids by calendar id of the calendars with
+// the confirmed address email.
+func (r *Repo) GetEditIdsByEmail(email string) (map[string]string, error) {
+	rows, err := r.db.Query("SELECT id, edit_id FROM calendars WHERE email != '' AND lower(email) = lower(?) AND deleted_at IS NULL", email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]string{}
+	for rows.Next() {
+		var id, editId string
+		if err := rows.Scan(&id, &editId); err != nil {
+			return nil, err
+		}
+		result[id] = editId
+	}
+	return result, rows.Err()
+}
+
+// SetRecoveryToken stores the token of a recovery mail for the calendars with
+// the confirmed address email, replacing the token of an earlier mail.
+func (r *Repo) SetRecoveryToken(email string, token string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE calendars
+		SET recovery_token = ?, recovery_expires_at = ?
+		WHERE email != '' AND lower(email) = lower(?) AND deleted_at IS NULL`,
+		token, expiresAt, email)
+	return err
+}
+
+// RedeemRecoveryToken clears the token and returns the ids of its calendars,
+// or none if the token is unknown or expired at now.
+func (r *Repo) RedeemRecoveryToken(token string, now time.Time) ([]string, error) {
+	rows, err := r.db.Query(`
+		UPDATE calendars
+		SET recovery_token = '', recovery_expires_at = NULL
+		WHERE recovery_token = ? AND recovery_token != '' AND recovery_expires_at >= ? AND deleted_at IS NULL
+		RETURNING id`,
+		token, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *Repo) SetEditId(calendarId string, editId string) error {
+	_, err := r.db.Exec("UPDATE calendars SET edit_id = ? WHERE id = ?", editId, calendarId)
+	return err
+}
+
+// CreateEditor stores a new editor invited through editor.InviteToken.
+func (r *Repo) CreateEditor(editor *model.Editor) error {
+	result, err := r.db.Exec(`
+		INSERT INTO calendar_editors (calendar_id, name, role, secret, invite_token, created_at)
+		VALUES(?, ?, ?, ?, ?, ?)`,
+		editor.CalendarId, editor.Name, editor.Role, editor.Secret, editor.InviteToken, editor.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	editor.Id = int(id)
+	return err
+}
+
+func (r *Repo) GetEditors(calendarId string) ([]*model.Editor, error) {
+	return r.getEditors("calendar_id = ?", calendarId)
+}
+
+// GetEditorBySecret returns the editor with secret who accepted the
+// invitation, or nil.
+func (r *Repo) GetEditorBySecret(secret string) (*model.Editor, error) {
+	editors, err := r.getEditors("secret = ? AND accepted_at IS NOT NULL", secret)
+	if err != nil || len(editors) == 0 {
+		return nil, err
+	}
+	return editors[0], nil
+}
+
+// AcceptInvite marks the invitation with token as accepted, so the link
+// cannot be used again, and returns its editor or nil.
+func (r *Repo) AcceptInvite(token string) (*model.Editor, error) {
+	e := model.Editor{}
+	err := r.db.QueryRow(`
+		UPDATE calendar_editors
+		SET invite_token = NULL, accepted_at = ?
+		WHERE invite_token = ?
+		RETURNING id, calendar_id, name, role, secret, created_at, accepted_at`,
+		time.Now(), token).Scan(&e.Id, &e.CalendarId, &e.Name, &e.Role, &e.Secret, &e.CreatedAt, &e.AcceptedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *Repo) SetEditorSecret(editorId int, secret string) error {
+	_, err := r.db.Exec("UPDATE calendar_editors SET secret = ? WHERE id = ?", secret, editorId)
+	return err
+}
+
+func (r *Repo) DeleteEditor(calendarId string, editorId int) error {
+	_, err := r.db.Exec("DELETE FROM calendar_editors WHERE calendar_id = ? AND id = ?", calendarId, editorId)
+	return err
+}
+
+func (r *Repo) getEditors(where string, args ...any) ([]*model.Editor, error) {
+	rows, err := r.db.Query(`
+		SELECT id, calendar_id, name, role, secret, invite_token, created_at, accepted_at
+		FROM calendar_editors
+		WHERE `+where+`
+		ORDER BY id`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*model.Editor{}
+	for rows.Next() {
+		e := model.Editor{}
+		var inviteToken sql.NullString
+		if err := rows.Scan(&e.Id, &e.CalendarId, &e.Name, &e.Role, &e.Secret, &inviteToken, &e.CreatedAt, &e.AcceptedAt); err != nil {
+			return nil, err
+		}
+		e.InviteToken = inviteToken.String
+		result = append(result, &e)
+	}
+	return result, rows.Err()
+}
+
+func (r *Repo) AddAuditEntry(entry *model.AuditEntry) error {
+	changesJson, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO calendar_audit (calendar_id, editor, created_at, changes)
+		VALUES(?, ?, ?, ?)`,
+		entry.CalendarId, entry.Editor, entry.CreatedAt, string(changesJson))
+	return err
+}
+
+// GetAuditEntries returns the latest limit changes of the calendar, newest first.
+func (r *Repo) GetAuditEntries(calendarId string, limit int) ([]*model.AuditEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT id, calendar_id, editor, created_at, changes
+		FROM calendar_audit
+		WHERE calendar_id = ?
+		ORDER BY id DESC
+		LIMIT ?`,
+		calendarId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*model.AuditEntry{}
+	for rows.Next() {
+		e := model.AuditEntry{}
+		var changesJson string
+		if err := rows.Scan(&e.Id, &e.CalendarId, &e.Editor, &e.CreatedAt, &changesJson); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changesJson), &e.Changes); err != nil {
+			return nil, err
+		}
+		result = append(result, &e)
+	}
+	return result, rows.Err()
+}
+
+func (r *Repo) AddVersion(version *model.CalendarVersion) error {
+	subscriptionConfigJson, err := json.Marshal(version.Config)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.db.Exec(`
+		INSERT INTO calendar_versions (calendar_id, title, subscription_config, editor, created_at)
+		VALUES(?, ?, ?, ?, ?)`,
+		version.CalendarId, version.Title, string(subscriptionConfigJson), version.Editor, version.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	version.Id = int(id)
+	return err
+}
+
+// GetVersions returns the latest limit versions of the calendar, newest first.
+func (r *Repo) GetVersions(calendarId string, limit int) ([]*model.CalendarVersion, error) {
+	return r.getVersions("calendar_id = ? ORDER BY id DESC LIMIT ?", calendarId, limit)
+}
+
+// GetVersion returns a version of the calendar or nil if there is none with
+// that id.
+func (r *Repo) GetVersion(calendarId string, versionId int) (*model.CalendarVersion, error) {
+	versions, err := r.getVersions("calendar_id = ? AND id = ?", calendarId, versionId)
+	if err != nil || len(versions) == 0 {
+		return nil, err
+	}
+	return versions[0], nil
+}
+
+func (r *Repo) getVersions(where string, args ...any) ([]*model.CalendarVersion, error) {
+	rows, err := r.db.Query(`
+		SELECT id, calendar_id, title, subscription_config, editor, created_at
+		FROM calendar_versions
+		WHERE `+where,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*model.CalendarVersion{}
+	for rows.Next() {
+		v := model.CalendarVersion{}
+		var subscriptionConfigJson string
+		if err := rows.Scan(&v.Id, &v.CalendarId, &v.Title, &subscriptionConfigJson, &v.Editor, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(subscriptionConfigJson), &v.Config); err != nil {
+			return nil, err
+		}
+		result = append(result, &v)
+	}
+	return result, rows.Err()
+}
+
+// retrievalDay is the key fetches are summed up by.
+func retrievalDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// AddRetrieval counts a fetch of the calendar feed.
+func (r *Repo) AddRetrieval(calendarId string, client string, status int, at time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO feed_retrievals (calendar_id, day, client, status, count, last_at)
+		VALUES(?, ?, ?, ?, 1, ?)
+		ON CONFLICT(calendar_id, day, client, status) DO UPDATE SET count = count + 1, last_at = excluded.last_at`,
+		calendarId, retrievalDay(at), client, status, at)
+	return err
+}
+
+// GetRetrievals returns the fetches of the calendar per day, client and
+// status since the day of since.
+func (r *Repo) GetRetrievals(calendarId string, since time.Time) ([]*model.Retrieval, error) {
+	rows, err := r.db.Query(`
+		SELECT calendar_id, client, status, count, last_at
+		FROM feed_retrievals
+		WHERE calendar_id = ? AND day >= ?`,
+		calendarId, retrievalDay(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*model.Retrieval{}
+	for rows.Next() {
+		rt := model.Retrieval{}
+		if err := rows.Scan(&rt.CalendarId, &rt.Client, &rt.Status, &rt.Count, &rt.LastAt); err != nil {
+			return nil, err
+		}
+		result = append(result, &rt)
+	}
+	return result, rows.Err()
+}
+
+// GetClientStats sums up the fetches of all calendars since the day of since
+// by client.
+func (r *Repo) GetClientStats(since time.Time, errorStatus int) ([]*model.ClientStats, error) {
+	rows, err := r.db.Query(`
+		SELECT client, SUM(count), SUM(CASE WHEN status >= ? THEN count ELSE 0 END), COUNT(DISTINCT calendar_id)
+		FROM feed_retrievals
+		WHERE day >= ?
+		GROUP BY client
+		ORDER BY SUM(count) DESC`,
+		errorStatus, retrievalDay(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*model.ClientStats{}
+	for rows.Next() {
+		cs := model.ClientStats{}
+		if err := rows.Scan(&cs.Client, &cs.Retrievals, &cs.Errors, &cs.Calendars); err != nil {
+			return nil, err
+		}
+		result = append(result, &cs)
+	}
+	return result, rows.Err()
+}
+
+// DeleteRetrievals removes the counts of days before the day of before.
+func (r *Repo) DeleteRetrievals(before time.Time) error {
+	_, err := r.db.Exec("DELETE FROM feed_retrievals WHERE day < ?", retrievalDay(before))
+	return err
+}
+
+// GetAdminPasswordHash returns the password hash of the admin user, or an
+// empty string if there is no such user.
+func (r *Repo) GetAdminPasswordHash(username string) (string, error) {
+	var hash string
+	err := r.db.QueryRow("SELECT password_hash FROM admin_users WHERE username = ?", username).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return hash, err
+}
+
+// SetAdminPassword creates the admin user or replaces its password hash.
+func (r *Repo) SetAdminPassword(username string, hash string, at time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO admin_users (username, password_hash, created_at, updated_at)
+		VALUES(?, ?, ?, ?)
+		ON CONFLICT(username) DO UPDATE SET password_hash = excluded.password_hash, updated_at = excluded.updated_at`,
+		username, hash, at, at)
+	return err
+}
+
+func (r *Repo) CountAdminUsers() (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM admin_users").Scan(&count)
+	return count, err
+}
+
+func (r *Repo) CreateAdminSession(session *model.AdminSession) error {
+	_, err := r.db.Exec(`
+		INSERT INTO admin_sessions (token, username, created_at, expires_at)
+		VALUES(?, ?, ?, ?)`,
+		session.Token, session.Username, session.CreatedAt, session.ExpiresAt)
+	return err
+}
+
+// GetAdminSession returns the session with the token, or nil if there is
+// none. Expired sessions are returned as well.
+func (r *Repo) GetAdminSession(token string) (*model.AdminSession, error) {
+	s := model.AdminSession{}
+	err := r.db.QueryRow("SELECT token, username, created_at, expires_at FROM admin_sessions WHERE token = ?", token).
+		Scan(&s.Token, &s.Username, &s.CreatedAt, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *Repo) DeleteAdminSession(token string) error {
+	_, err := r.db.Exec("DELETE FROM admin_sessions WHERE token = ?", token)
+	return err
+}
+
+// DeleteAdminSessions logs the user out everywhere.
+func (r *Repo) DeleteAdminSessions(username string) error {
+	_, err := r.db.Exec("DELETE FROM admin_sessions WHERE username = ?", username)
+	return err
+}
+
+func (r *Repo) DeleteExpiredAdminSessions(now time.Time) error {
+	_, err := r.db.Exec("DELETE FROM admin_sessions WHERE expires_at < ?", now)
 	return err
 }
 
 func (r *Repo) GetSubscriptions(calendar *model.Calendar) ([]*model.Subscription, error) {
 	rows, err := r.db.Query(`
-        SELECT s.status, s.created_at, s.updated_at, t.id, t.title, t.updated_at, t.start_date, t.end_date, t.series, t.pdga_status, t.drating
+        SELECT s.status, s.created_at, s.updated_at, t.id, t.title, t.updated_at, t.start_date, t.end_date, t.series, t.pdga_tier, t.drating
         FROM subscriptions AS s
-        LEFT JOIN tournaments AS t ON s.tournament_id = t.id
+        JOIN tournaments AS t ON s.tournament_id = t.id
         WHERE s.calendar_id = ?
     `, calendar.Id)
 
@@ -465,6 +1202,99 @@ func (r *Repo) UpsertSubscription(subscription *model.Subscription) error {
 	return err
 }
 
+func (r *Repo) DeleteSubscription(calendarId string, tournamentId int) error {
+	_, err := r.db.Exec("DELETE FROM subscriptions WHERE calendar_id = ? AND tournament_id = ?", calendarId, tournamentId)
+	return err
+}
+
+func (r *Repo) GetNotes(calendarId string) (map[int]string, error) {
+	rows, err := r.db.Query("SELECT tournament_id, note FROM notes WHERE calendar_id = ?", calendarId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[int]string{}
+	for rows.Next() {
+		var id int
+		var note string
+		if err := rows.Scan(&id, &note); err != nil {
+			return nil, err
+		}
+		result[id] = note
+	}
+	return result, rows.Err()
+}
+
+func (r *Repo) UpsertNote(calendarId string, tournamentId int, note string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO notes (calendar_id, tournament_id, updated_at, note)
+		VALUES(?, ?, ?, ?)
+		ON CONFLICT(calendar_id, tournament_id) DO UPDATE SET
+		note=excluded.note,
+		updated_at=excluded.updated_at`,
+		calendarId, tournamentId, time.Now(), note)
+
+	return err
+}
+
+func (r *Repo) DeleteNote(calendarId string, tournamentId int) error {
+	_, err := r.db.Exec("DELETE FROM notes WHERE calendar_id = ? AND tournament_id = ?", calendarId, tournamentId)
+	return err
+}
+
+// EnqueueMail stores msg in the outbox. Messages with a dedupe key that was
+// queued before are dropped.
+func (r *Repo) EnqueueMail(msg *model.OutboxMessage) error {
+	var dedupeKey sql.NullString
+	if msg.DedupeKey != "" {
+		dedupeKey = sql.NullString{String: msg.DedupeKey, Valid: true}
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO outbox (recipient, subject, body, created_at, next_attempt_at, dedupe_key)
+		VALUES(?, ?, ?, ?, ?, ?)
+		ON CONFLICT(dedupe_key) DO NOTHING`,
+		msg.To, msg.Subject, msg.Body, time.Now(), time.Now(), dedupeKey)
+
+	return err
+}
+
+// GetDueMails returns unsent messages with less than maxAttempts attempts
+// whose next attempt is due at now.
+func (r *Repo) GetDueMails(now time.Time, maxAttempts int) ([]*model.OutboxMessage, error) {
+	rows, err := r.db.Query(`
+		SELECT id, recipient, subject, body, created_at, attempts, next_attempt_at, last_error
+		FROM outbox
+		WHERE sent_at IS NULL AND attempts < ? AND next_attempt_at <= ?
+		ORDER BY id`,
+		maxAttempts, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*model.OutboxMessage{}
+	for rows.Next() {
+		m := model.OutboxMessage{}
+		if err := rows.Scan(&m.Id, &m.To, &m.Subject, &m.Body, &m.CreatedAt, &m.Attempts, &m.NextAttemptAt, &m.LastError); err != nil {
+			return nil, err
+		}
+		result = append(result, &m)
+	}
+	return result, rows.Err()
+}
+
+func (r *Repo) MarkMailSent(id int, sentAt time.Time) error {
+	_, err := r.db.Exec("UPDATE outbox SET sent_at = ?, attempts = attempts + 1 WHERE id = ?", sentAt, id)
+	return err
+}
+
+func (r *Repo) MarkMailFailed(id int, nextAttemptAt time.Time, lastError string) error {
+	_, err := r.db.Exec("UPDATE outbox SET attempts = attempts + 1, next_attempt_at = ?, last_error = ? WHERE id = ?", nextAttemptAt, lastError, id)
+	return err
+}
+
 func (r *Repo) CreateTurnamentHistory(tournament *model.Tournament) error {
 	snapshot, err := json.Marshal(tournament)
 	if err != nil {
@@ -0,0 +1,301 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+func newTestRepo(t *testing.T) *Repo {
+	repo, err := NewRepo(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(repo.Close)
+	return repo
+}
+
+func TestSetEditId(t *testing.T) {
+	repo := newTestRepo(t)
+	require.NoError(t, repo.CreateCalendar("cal", "old-edit", "My calendar", model.SubscriptionConfig{}))
+
+	require.NoError(t, repo.SetEditId("cal", "new-edit"))
+
+	c, err := repo.GetCalendarByEditId("old-edit")
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	c, err = repo.GetCalendarByEditId("new-edit")
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, "cal", c.Id)
+}
+
+func TestRenameCalendar(t *testing.T) {
+	repo := newTestRepo(t)
+	start := time.Date(2025, 6, 14, 0, 0, 0, 0, time.UTC)
+	tournament := &model.Tournament{Id: 42, Status: model.TOURNAMENT_STATUS_ANNOUNCED, UpdatedAt: start, StartDate: start, EndDate: start, Title: "Summer Open"}
+	require.NoError(t, repo.UpsertTournament(tournament))
+
+	require.NoError(t, repo.CreateCalendar("cal", "edit", "My calendar", model.SubscriptionConfig{}))
+	calendar, err := repo.GetCalendarById("cal")
+	require.NoError(t, err)
+	require.NoError(t, repo.UpsertSubscription(&model.Subscription{Calendar: calendar, Tournament: tournament, Status: model.SUBSCRIPTION_STATUS_REGISTERED}))
+	require.NoError(t, repo.UpsertNote("cal", 42, "Zelt mitnehmen"))
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, repo.RenameCalendar("cal", "cal2", expiresAt))
+
+	c, err := repo.GetCalendarById("cal")
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	c, err = repo.GetCalendarById("cal2")
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, "My calendar", c.Title)
+
+	c, err = repo.GetCalendarByEditId("edit")
+	require.NoError(t, err)
+	require.NotNil(t, c, "the edit id is kept")
+	assert.Equal(t, "cal2", c.Id)
+
+	subscriptions, err := repo.GetSubscriptions(c)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	assert.Equal(t, model.SUBSCRIPTION_STATUS_REGISTERED, subscriptions[0].Status)
+
+	notes, err := repo.GetNotes("cal2")
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{42: "Zelt mitnehmen"}, notes)
+
+	id, at, err := repo.GetCalendarAlias("cal")
+	require.NoError(t, err)
+	assert.Equal(t, "cal2", id)
+	assert.True(t, expiresAt.Equal(at))
+
+	require.NoError(t, repo.RenameCalendar("cal2", "cal3", expiresAt))
+	id, _, err = repo.GetCalendarAlias("cal")
+	require.NoError(t, err)
+	assert.Equal(t, "cal3", id, "older aliases follow the calendar")
+	id, _, err = repo.GetCalendarAlias("cal2")
+	require.NoError(t, err)
+	assert.Equal(t, "cal3", id)
+
+	id, _, err = repo.GetCalendarAlias("unknown")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+}
+
+func TestAcceptInvite(t *testing.T) {
+	repo := newTestRepo(t)
+	require.NoError(t, repo.CreateCalendar("cal", "cal-edit", "My calendar", model.SubscriptionConfig{}))
+	editor := &model.Editor{CalendarId: "cal", Name: "Erika", Role: model.EDITOR_ROLE_EDITOR, Secret: "secret", InviteToken: "invite", CreatedAt: time.Now()}
+	require.NoError(t, repo.CreateEditor(editor))
+
+	accepted, err := repo.AcceptInvite("unknown")
+	require.NoError(t, err)
+	assert.Nil(t, accepted)
+
+	accepted, err = repo.AcceptInvite("invite")
+	require.NoError(t, err)
+	require.NotNil(t, accepted)
+	assert.Equal(t, editor.Id, accepted.Id)
+	assert.Equal(t, "secret", accepted.Secret)
+	assert.Empty(t, accepted.InviteToken)
+	assert.NotNil(t, accepted.AcceptedAt)
+
+	accepted, err = repo.AcceptInvite("invite")
+	require.NoError(t, err)
+	assert.Nil(t, accepted, "invites are accepted once")
+}
+
+func TestVersions(t *testing.T) {
+	repo := newTestRepo(t)
+	now := time.Now().Truncate(time.Second)
+	first := &model.CalendarVersion{CalendarId: "cal", Title: "My calendar", Config: &model.SubscriptionConfig{Series: []string{"Liga"}}, CreatedAt: now}
+	require.NoError(t, repo.AddVersion(first))
+	require.NoError(t, repo.AddVersion(&model.CalendarVersion{CalendarId: "cal", Title: "Club", Config: &model.SubscriptionConfig{}, Editor: "Anna", CreatedAt: now}))
+
+	versions, err := repo.GetVersions("cal", 10)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, "Club", versions[0].Title, "newest first")
+	assert.Equal(t, "Anna", versions[0].Editor)
+
+	v, err := repo.GetVersion("cal", first.Id)
+	require.NoError(t, err)
+	require.NotNil(t, v)
+	assert.Equal(t, []string{"Liga"}, v.Config.Series)
+
+	v, err = repo.GetVersion("other", first.Id)
+	require.NoError(t, err)
+	assert.Nil(t, v, "versions of other calendars are not returned")
+}
+
+func TestRetrievals(t *testing.T) {
+	repo := newTestRepo(t)
+	day := time.Date(2025, 6, 14, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, repo.AddRetrieval("cal", "google", 200, day.Add(-24*time.Hour)))
+	require.NoError(t, repo.AddRetrieval("cal", "google", 200, day))
+	require.NoError(t, repo.AddRetrieval("cal", "google", 200, day.Add(time.Hour)))
+	require.NoError(t, repo.AddRetrieval("cal", "google", 500, day))
+	require.NoError(t, repo.AddRetrieval("other", "apple", 304, day))
+
+	retrievals, err := repo.GetRetrievals("cal", day)
+	require.NoError(t, err)
+	require.Len(t, retrievals, 2, "fetches are summed up per day, client and status")
+	for _, rt := range retrievals {
+		if rt.Status == 200 {
+			assert.Equal(t, 2, rt.Count)
+			assert.True(t, day.Add(time.Hour).Equal(rt.LastAt))
+		}
+	}
+
+	stats, err := repo.GetClientStats(day.Add(-24*time.Hour), 400)
+	require.NoError(t, err)
+	require.Len(t, stats, 2)
+	assert.Equal(t, model.ClientStats{Client: "google", Retrievals: 4, Errors: 1, Calendars: 1}, *stats[0])
+
+	require.NoError(t, repo.DeleteRetrievals(day))
+	retrievals, err = repo.GetRetrievals("cal", time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, retrievals, 2, "only earlier days are removed")
+}
+
+func TestSoftDeleteCalendar(t *testing.T) {
+	repo := newTestRepo(t)
+	require.NoError(t, repo.CreateCalendar("cal", "edit", "My calendar", model.SubscriptionConfig{}))
+	require.NoError(t, repo.CreateCalendar("other", "other-edit", "Other", model.SubscriptionConfig{}))
+
+	flaggedAt := time.Now().Truncate(time.Second)
+	require.NoError(t, repo.SetFlaggedAt("cal", &flaggedAt))
+	c, err := repo.GetCalendarById("cal")
+	require.NoError(t, err)
+	require.NotNil(t, c.FlaggedAt)
+	assert.True(t, flaggedAt.Equal(*c.FlaggedAt))
+
+	require.NoError(t, repo.SoftDeleteCalendar("cal", flaggedAt))
+	c, err = repo.GetCalendarById("cal")
+	require.NoError(t, err)
+	assert.Nil(t, c, "deleted calendars are hidden")
+	c, err = repo.GetCalendarByEditId("edit")
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	calendars, err := repo.GetCalendars()
+	require.NoError(t, err)
+	require.Len(t, calendars, 1)
+	assert.Equal(t, "other", calendars[0].Id)
+
+	deleted, err := repo.GetDeletedCalendars()
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, "cal", deleted[0].Id)
+	require.NotNil(t, deleted[0].DeletedAt)
+}
+
+func TestRecoveryToken(t *testing.T) {
+	repo := newTestRepo(t)
+	now := time.Now()
+	for _, id := range []string{"cal", "other", "deleted"} {
+		require.NoError(t, repo.CreateCalendar(id, id+"-edit", "My calendar", model.SubscriptionConfig{}))
+	}
+	for _, id := range []string{"cal", "deleted"} {
+		require.NoError(t, repo.SetPendingEmail(id, "Max@example.com", id+"-confirm", now.Add(time.Hour)))
+		_, err := repo.ConfirmEmail(id+"-confirm", id+"-unsubscribe", now)
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.SoftDeleteCalendar("deleted", now))
+
+	require.NoError(t, repo.SetRecoveryToken("max@example.com", "token", now.Add(time.Hour)))
+
+	ids, err := repo.RedeemRecoveryToken("token", now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, ids, "expired")
+
+	ids, err = repo.RedeemRecoveryToken("token", now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cal"}, ids)
+
+	ids, err = repo.RedeemRecoveryToken("token", now)
+	require.NoError(t, err)
+	assert.Empty(t, ids, "tokens are used once")
+}
+
+func TestPurgeCalendar(t *testing.T) {
+	repo := newTestRepo(t)
+	start := time.Date(2025, 6, 14, 0, 0, 0, 0, time.UTC)
+	tournament := &model.Tournament{Id: 42, Status: model.TOURNAMENT_STATUS_ANNOUNCED, UpdatedAt: start, StartDate: start, EndDate: start, Title: "Summer Open"}
+	require.NoError(t, repo.UpsertTournament(tournament))
+
+	require.NoError(t, repo.CreateCalendar("cal", "edit", "My calendar", model.SubscriptionConfig{}))
+	calendar, err := repo.GetCalendarById("cal")
+	require.NoError(t, err)
+	require.NoError(t, repo.UpsertSubscription(&model.Subscription{Calendar: calendar, Tournament: tournament, Status: model.SUBSCRIPTION_STATUS_REGISTERED}))
+	require.NoError(t, repo.UpsertNote("cal", 42, "Zelt mitnehmen"))
+	require.NoError(t, repo.CreateEditor(&model.Editor{CalendarId: "cal", Name: "Anna", Role: model.EDITOR_ROLE_EDITOR, Secret: "anna", CreatedAt: start}))
+	require.NoError(t, repo.AddVersion(&model.CalendarVersion{CalendarId: "cal", Title: "My calendar", Config: &model.SubscriptionConfig{}, CreatedAt: start}))
+	require.NoError(t, repo.AddRetrieval("cal", "google", 200, start))
+
+	require.NoError(t, repo.TrashCalendar("cal", start))
+	require.NoError(t, repo.RestoreCalendar("cal"))
+	calendar, err = repo.GetCalendarById("cal")
+	require.NoError(t, err)
+	require.NotNil(t, calendar, "restored calendars are visible again")
+
+	require.NoError(t, repo.PurgeCalendar("cal"))
+	calendar, err = repo.GetDeletedCalendar("cal")
+	require.NoError(t, err)
+	assert.Nil(t, calendar)
+
+	for _, table := range []string{"calendars", "subscriptions", "notes", "calendar_editors", "calendar_versions", "feed_retrievals"} {
+		var count int
+		require.NoError(t, repo.db.QueryRow("SELECT COUNT(*) FROM "+table).Scan(&count))
+		assert.Zero(t, count, table)
+	}
+}
+
+func TestAdminSessions(t *testing.T) {
+	repo := newTestRepo(t)
+	now := time.Date(2025, 6, 14, 12, 0, 0, 0, time.UTC)
+
+	hash, err := repo.GetAdminPasswordHash("max")
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+
+	require.NoError(t, repo.SetAdminPassword("max", "hash1", now))
+	require.NoError(t, repo.SetAdminPassword("max", "hash2", now))
+	hash, err = repo.GetAdminPasswordHash("max")
+	require.NoError(t, err)
+	assert.Equal(t, "hash2", hash)
+	count, err := repo.CountAdminUsers()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	require.NoError(t, repo.CreateAdminSession(&model.AdminSession{Token: "old", Username: "max", CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}))
+	require.NoError(t, repo.CreateAdminSession(&model.AdminSession{Token: "new", Username: "max", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}))
+
+	s, err := repo.GetAdminSession("new")
+	require.NoError(t, err)
+	require.NotNil(t, s)
+	assert.Equal(t, "max", s.Username)
+	assert.True(t, s.ExpiresAt.Equal(now.Add(time.Hour)))
+
+	require.NoError(t, repo.DeleteExpiredAdminSessions(now))
+	s, err = repo.GetAdminSession("old")
+	require.NoError(t, err)
+	assert.Nil(t, s)
+	s, err = repo.GetAdminSession("new")
+	require.NoError(t, err)
+	assert.NotNil(t, s)
+
+	require.NoError(t, repo.DeleteAdminSessions("max"))
+	s, err = repo.GetAdminSession("new")
+	require.NoError(t, err)
+	assert.Nil(t, s)
+}
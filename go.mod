@@ -5,8 +5,10 @@ go 1.25.0
 require (
 	github.com/PuerkitoBio/goquery v1.11.0
 	github.com/arran4/golang-ical v0.3.2
+	github.com/graphql-go/graphql v0.8.1
 	github.com/hashicorp/go-retryablehttp v0.7.8
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/crypto v0.45.0
 	modernc.org/sqlite v1.44.1
 )
 
@@ -0,0 +1,86 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers a message or returns an error if it should be retried.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// format renders msg as a plain text RFC 5322 message.
+func format(from string, msg Message, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.Write(bytes.ReplaceAll([]byte(msg.Body), []byte("\n"), []byte("\r\n")))
+	return b.Bytes()
+}
+
+type SmtpSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSmtpSender sends mail through host:port, using STARTTLS if the server
+// offers it. Authentication is skipped if user is empty.
+func NewSmtpSender(host string, port int, user string, password string, from string) *SmtpSender {
+	s := SmtpSender{addr: net.JoinHostPort(host, strconv.Itoa(port)), from: from}
+	if user != "" {
+		s.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return &s
+}
+
+func (s *SmtpSender) Send(msg Message) error {
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, format(s.from, msg, time.Now()))
+}
+
+type LogSender struct {
+	dir  string
+	from string
+}
+
+// NewLogSender writes every message as .eml file into dir, or to the log if
+// dir is empty. It is meant for local testing.
+func NewLogSender(dir string, from string) *LogSender {
+	return &LogSender{dir: dir, from: from}
+}
+
+func (s *LogSender) Send(msg Message) error {
+	now := time.Now()
+	content := format(s.from, msg, now)
+	if s.dir == "" {
+		log.Printf("Mail to %s:\n%s", msg.To, content)
+		return nil
+	}
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(s.dir, fmt.Sprintf("%d.eml", now.UnixNano()))
+	return os.WriteFile(name, content, 0644)
+}
@@ -6,11 +6,14 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/resterle/dg-cal/v2/db"
 	"github.com/resterle/dg-cal/v2/gto"
+	"github.com/resterle/dg-cal/v2/mail"
 	"github.com/resterle/dg-cal/v2/service"
 	"github.com/resterle/dg-cal/v2/web"
 
@@ -70,39 +73,83 @@ func main() {
 
 	icsService := service.NewIcsService(calendarservice, tournamentService)
 
+	baseUrl := os.Getenv("BASE_URL")
+	if baseUrl == "" {
+		log.Printf("BASE_URL missing, links in mails point to localhost")
+		baseUrl = "http://localhost:8080"
+	}
+	notificationService := service.NewNotificationService(repo, calendarservice, tournamentService, newMailSender(), baseUrl)
+	go mailer(notificationService)
+
+	retentionMode := os.Getenv("RETENTION_MODE")
+	if retentionMode == "" {
+		retentionMode = service.RETENTION_MODE_OFF
+	}
+	if !slices.Contains(service.RetentionModes, retentionMode) {
+		panic("RETENTION_MODE must be one of " + strings.Join(service.RetentionModes, ", "))
+	}
+	retentionService := service.NewRetentionService(repo, notificationService, service.RetentionPolicy{
+		Mode:          retentionMode,
+		UnusedAfter:   time.Duration(envInt("RETENTION_UNUSED_DAYS", 30)) * 24 * time.Hour,
+		InactiveAfter: time.Duration(envInt("RETENTION_INACTIVE_MONTHS", 12)) * 30 * 24 * time.Hour,
+		Grace:         time.Duration(envInt("RETENTION_GRACE_DAYS", 30)) * 24 * time.Hour,
+	})
+	limits := newRateLimiter()
+	go housekeeping(calendarservice, retentionService, limits)
+
 	syncInterval := time.Minute * time.Duration(syncIntervalInMinutes)
 	ticker = time.NewTicker(syncInterval)
 	defer ticker.Stop()
 	go scheduler(tournamentService, syncIntervalInMinutes)
 
-	webApp := web.NewWebApp(tournamentService, calendarservice, icsService, syncInterval)
+	adminAuth := newAdminAuth(service.NewAdminService(repo))
+
+	webApp := web.NewWebApp(tournamentService, calendarservice, icsService, notificationService, retentionService, adminAuth, limits, syncInterval)
 
 	http.HandleFunc("GET /{$}", webApp.WelcomeHandler)
 	http.HandleFunc("GET /tournaments", webApp.TournamentsHandler)
 	http.HandleFunc("GET /tournament/{id}", webApp.TournamentDetailHandler)
 	http.HandleFunc("GET /registrations", webApp.RegistrationsHandler)
 	http.HandleFunc("GET /calendar/new", webApp.CreateCalendarFormHandler)
-	http.HandleFunc("POST /calendar/create", webApp.CreateCalendarHandler)
+	http.Handle("POST /calendar/create", limits.Limit("create", webApp.CreateCalendarHandler))
 	http.HandleFunc("GET /calendar/created", webApp.CalendarCreatedHandler)
 	http.HandleFunc("GET /calendar/edit", webApp.AccessCalendarFormHandler)
-	http.HandleFunc("POST /calendar/edit", webApp.AccessCalendarHandler)
-	http.HandleFunc("GET /calendar/edit/{id}", webApp.EditCalendarFormHandler)
-	http.HandleFunc("POST /calendar/edit/{id}", webApp.EditCalendarHandler)
+	http.Handle("POST /calendar/edit", limits.Limit("edit", webApp.AccessCalendarHandler))
+	http.Handle("POST /calendar/recover", limits.Limit("recover", webApp.RecoverHandler))
+	http.Handle("GET /calendar/recover/{token}", limits.Limit("recover", webApp.RenewEditCodesFormHandler))
+	http.Handle("POST /calendar/recover/{token}", limits.Limit("recover", webApp.RenewEditCodesHandler))
+	http.Handle("GET /calendar/edit/{id}", limits.Limit("edit", webApp.EditCalendarFormHandler))
+	http.Handle("POST /calendar/edit/{id}", limits.Limit("edit", webApp.EditCalendarHandler))
+	http.Handle("POST /calendar/preview", limits.Limit("edit", webApp.CalendarPreviewHandler))
+	http.Handle("POST /calendar/edit/{id}/attendance", limits.Limit("edit", webApp.AttendanceHandler))
+	http.Handle("POST /calendar/edit/{id}/email", limits.Limit("edit", webApp.EmailHandler))
+	http.Handle("POST /calendar/edit/{id}/rotate-edit-code", limits.Limit("edit", webApp.RotateEditIdHandler))
+	http.Handle("POST /calendar/edit/{id}/rotate-feed", limits.Limit("edit", webApp.RotateIdHandler))
+	http.Handle("POST /calendar/edit/{id}/editors", limits.Limit("edit", webApp.InviteEditorHandler))
+	http.Handle("POST /calendar/edit/{id}/editors/{editor}/revoke", limits.Limit("edit", webApp.RevokeEditorHandler))
+	http.Handle("POST /calendar/edit/{id}/versions/{version}/restore", limits.Limit("edit", webApp.RestoreVersionHandler))
+	http.Handle("GET /calendar/invite/{token}", limits.Limit("edit", webApp.AcceptInviteHandler))
+	http.HandleFunc("GET /calendar/email/confirm/{token}", webApp.ConfirmEmailHandler)
+	http.HandleFunc("GET /calendar/email/unsubscribe/{token}", webApp.UnsubscribeFormHandler)
+	http.HandleFunc("POST /calendar/email/unsubscribe/{token}", webApp.UnsubscribeHandler)
 	http.HandleFunc("GET /api/tournaments", webApp.TournamentHandler)
-	http.HandleFunc("GET /ical/{id}", webApp.IcsHandler)
+	http.HandleFunc("GET /api/openapi.json", webApp.OpenApiHandler)
+	http.HandleFunc("GET /api/docs", webApp.ApiDocsHandler)
+	http.Handle("GET /ical/{id}", limits.Limit("feed", webApp.IcsHandler))
+	http.Handle("GET /ical/series/{name}", limits.Limit("feed", webApp.SeriesIcsHandler))
+	http.Handle("GET /ical/tournament/{id}", limits.Limit("feed", webApp.TournamentIcsHandler))
 
-	http.HandleFunc("GET /admin", webApp.AdminHandler)
-	http.HandleFunc("POST /admin/calendar/delete/{id}", webApp.DeleteCalendarHandler)
-	http.HandleFunc("GET /admin/calendar/{id}", webApp.AdminViewCalendarHandler)
-	http.HandleFunc("POST /admin/calendar/{id}", webApp.AdminUpdateCalendarHandler)
-	http.HandleFunc("GET /admin/tournaments", webApp.AdminTournamentsHandler)
-	http.HandleFunc("GET /admin/tournament/{id}/history", webApp.AdminTournamentHistoryHandler)
+	webApp.RegisterApiRoutes(http.DefaultServeMux)
+	http.Handle("GET /graphql", limits.Limit("api", webApp.GraphqlHandler))
+	http.Handle("POST /graphql", limits.Limit("api", webApp.GraphqlHandler))
+	webApp.RegisterAdminRoutes(http.DefaultServeMux)
 
 	http.HandleFunc("GET /common.css", webApp.CommonCSSHandler)
 	http.HandleFunc("GET /favicon.svg", webApp.FaviconHandler)
 	http.HandleFunc("GET /common.js", webApp.CommonJSHandler)
 	http.HandleFunc("GET /table-filters.js", webApp.TableFiltersJSHandler)
 	http.HandleFunc("GET /fonts/{name}", webApp.FontHandler)
+	http.HandleFunc("GET /js/{name}", webApp.ScriptHandler)
 
 	http.HandleFunc("/", webApp.NotFoundHandler)
 
@@ -112,7 +159,7 @@ func main() {
 	}
 
 	fmt.Printf("Web service starting on port %s\n", port)
-	withLogging := web.LoggingMiddleware(http.DefaultServeMux)
+	withLogging := web.LoggingMiddleware(web.SecurityMiddleware(http.DefaultServeMux))
 	log.Fatal(http.ListenAndServe(":"+port, web.LanguageMiddleware(withLogging)))
 
 }
@@ -124,3 +171,133 @@ func scheduler(s *service.TournamentService, syncInterval int) {
 		<-ticker.C
 	}
 }
+
+// newMailSender sends mail through SMTP_HOST, or writes it to MAIL_DIR (or
+// the log) if no SMTP server is configured.
+func newMailSender() mail.Sender {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "dg-cal@localhost"
+	}
+
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		log.Printf("SMTP_HOST missing, mails are not sent")
+		return mail.NewLogSender(os.Getenv("MAIL_DIR"), from)
+	}
+
+	port := 587
+	if p := os.Getenv("SMTP_PORT"); p != "" {
+		var err error
+		if port, err = strconv.Atoi(p); err != nil {
+			panic("smtp port " + err.Error())
+		}
+	}
+	return mail.NewSmtpSender(host, port, os.Getenv("SMTP_USER"), os.Getenv("SMTP_PASSWORD"), from)
+}
+
+func mailer(s *service.NotificationService) {
+	for {
+		if err := s.NotifyRegistrations(time.Now()); err != nil {
+			log.Printf("Could not queue registration reminders: %s", err.Error())
+		}
+		if err := s.DeliverMail(time.Now()); err != nil {
+			log.Printf("Could not deliver mail: %s", err.Error())
+		}
+		time.Sleep(time.Minute)
+	}
+}
+
+// housekeeping removes data that is kept for a limited time only and
+// abandoned calendars.
+func housekeeping(s *service.CalendarService, retention *service.RetentionService, limits *web.RateLimiter) {
+	for {
+		limits.Prune(time.Now())
+		if err := s.PruneRetrievals(time.Now()); err != nil {
+			log.Printf("Could not prune feed retrievals: %s", err.Error())
+		}
+		if _, err := retention.Run(time.Now()); err != nil {
+			log.Printf("Could not apply retention policy: %s", err.Error())
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// newAdminAuth lets whoever the proxy names in ADMIN_PROXY_HEADER use the
+// admin pages, optionally only the ADMIN_PROXY_USERS. Without a proxy local
+// users log in, ADMIN_USER and ADMIN_PASSWORD create one.
+func newAdminAuth(admins *service.AdminService) *web.AdminAuth {
+	if header := os.Getenv("ADMIN_PROXY_HEADER"); header != "" {
+		users := []string{}
+		for _, user := range strings.Split(os.Getenv("ADMIN_PROXY_USERS"), ",") {
+			if user = strings.TrimSpace(user); user != "" {
+				users = append(users, user)
+			}
+		}
+		log.Printf("Admin pages are authenticated by the proxy header %s", header)
+		return web.NewProxyAdminAuth(header, users)
+	}
+
+	if user := os.Getenv("ADMIN_USER"); user != "" {
+		if err := admins.EnsurePassword(user, os.Getenv("ADMIN_PASSWORD"), time.Now()); err != nil {
+			panic("admin password " + err.Error())
+		}
+	}
+	hasUsers, err := admins.HasUsers()
+	if err != nil {
+		log.Fatalf("Failed to get admin users: %v", err)
+	}
+	if !hasUsers {
+		log.Printf("ADMIN_USER missing, nobody can log in to the admin pages")
+	}
+	return web.NewLocalAdminAuth(admins)
+}
+
+// newRateLimiter limits the requests per client address and in total for
+// each group of routes. RATE_LIMIT_<GROUP> and RATE_LIMIT_<GROUP>_GLOBAL
+// override the defaults, e.g. "10/m" or "off". Behind a proxy
+// CLIENT_IP_HEADER names the header with the client address.
+func newRateLimiter() *web.RateLimiter {
+	defaults := map[string][2]string{
+		"create":  {"10/h", "200/h"},
+		"edit":    {"120/m", "off"},
+		"recover": {"5/h", "100/h"},
+		"login":   {"10/m", "100/h"},
+		"feed":    {"60/m", "off"},
+		"api":     {"300/m", "off"},
+	}
+	groups := map[string]web.RateLimitGroup{}
+	for name, limits := range defaults {
+		env := "RATE_LIMIT_" + strings.ToUpper(name)
+		groups[name] = web.RateLimitGroup{
+			Client: envRateLimit(env, limits[0]),
+			Global: envRateLimit(env+"_GLOBAL", limits[1]),
+		}
+	}
+	return web.NewRateLimiter(groups, os.Getenv("CLIENT_IP_HEADER"))
+}
+
+func envRateLimit(name string, fallback string) web.RateLimit {
+	v := os.Getenv(name)
+	if v == "" {
+		v = fallback
+	}
+	limit, err := web.ParseRateLimit(v)
+	if err != nil {
+		panic(name + " " + err.Error())
+	}
+	return limit
+}
+
+// envInt reads a number from the environment variable name.
+func envInt(name string, fallback int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		panic(name + " " + err.Error())
+	}
+	return i
+}
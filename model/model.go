@@ -44,17 +44,51 @@ type Calendar struct {
 	UpdatedAt   time.Time
 	RetrievedAt *time.Time
 	Config      *SubscriptionConfig
+	// PendingEmail waits for the owner to follow the confirmation link, Email
+	// is only set once it is confirmed
+	PendingEmail string
+	// FlaggedAt is set when the retention policy considers the calendar
+	// abandoned, DeletedAt once it was deleted but not purged yet
+	FlaggedAt *time.Time
+	DeletedAt *time.Time
 }
 
 type SubscriptionConfig struct {
 	Tournaments []int
 	Series      []string
+	Tasks       bool
+	// Rules narrow down the series selection, or select from all tournaments
+	// when no series is chosen. Explicit tournaments always match.
+	Rules SubscriptionRules
+	// Exclude removes tournaments even if they match a series, the rules or
+	// an inherited calendar
+	Exclude []int
+	// Inherit lists the public ids of calendars whose tournaments are included
+	Inherit []string
+	// ConflictWindow is the number of minutes between registration openings
+	// that are reported as a conflict
+	ConflictWindow    int
+	AnnotateConflicts bool
+}
+
+type SubscriptionRules struct {
+	PdgaTiers   []string
+	DRatingOnly bool
+	From        *time.Time
+	To          *time.Time
+	Title       string
+	Location    string
+	Regex       bool
+	Status      []string
 }
 
 const SUBSCRIPTION_STATUS_INVITED = "INVITED"
 const SUBSCRIPTION_STATUS_ACCEPTED = "ACCEPTED"
 const SUBSCRIPTION_STATUS_DECLINED = "DECLINED"
 const SUBSCRIPTION_STATUS_CANCELLED = "CANCELLED"
+const SUBSCRIPTION_STATUS_PLANNED = "PLANNED"
+const SUBSCRIPTION_STATUS_REGISTERED = "REGISTERED"
+const SUBSCRIPTION_STATUS_ATTENDED = "ATTENDED"
 
 type Subscription struct {
 	Calendar   *Calendar
@@ -83,3 +117,83 @@ type EventDetails struct {
 	DRatingConsideration bool
 	RegistrationPhases   []RegistrationPhase
 }
+
+type OutboxMessage struct {
+	Id            int
+	To            string
+	Subject       string
+	Body          string
+	CreatedAt     time.Time
+	Attempts      int
+	NextAttemptAt time.Time
+	SentAt        *time.Time
+	LastError     string
+	// DedupeKey prevents queueing the same notification twice, it is optional
+	DedupeKey string
+}
+
+const EDITOR_ROLE_OWNER = "OWNER"
+const EDITOR_ROLE_EDITOR = "EDITOR"
+const EDITOR_ROLE_VIEWER = "VIEWER"
+
+// Editor is a person with access to a calendar through an own secret. The
+// holder of the calendar edit code is an owner without id.
+type Editor struct {
+	Id          int
+	CalendarId  string
+	Name        string
+	Role        string
+	Secret      string
+	InviteToken string
+	CreatedAt   time.Time
+	AcceptedAt  *time.Time
+}
+
+// AuditEntry records a change of the title or SubscriptionConfig of a calendar.
+type AuditEntry struct {
+	Id         int
+	CalendarId string
+	// Editor is the name of the editor, empty for the holder of the edit code
+	Editor    string
+	CreatedAt time.Time
+	Changes   []string
+}
+
+// Retrieval counts the fetches of a calendar feed by one client with one
+// response status on a day.
+type Retrieval struct {
+	CalendarId string
+	Client     string
+	Status     int
+	Count      int
+	LastAt     time.Time
+}
+
+// ClientStats sums up the fetches of all calendar feeds by one client.
+type ClientStats struct {
+	Client     string
+	Retrievals int
+	Errors     int
+	Calendars  int
+}
+
+// CalendarVersion is the title and SubscriptionConfig of a calendar after a
+// change, so earlier versions can be restored.
+type CalendarVersion struct {
+	Id         int
+	CalendarId string
+	Title      string
+	Config     *SubscriptionConfig
+	// Editor is the name of the editor, empty for the holder of the edit code
+	Editor    string
+	CreatedAt time.Time
+}
+
+// AdminSession is a login to the admin pages, identified by the token in the
+// session cookie.
+type AdminSession struct {
+	Token     string
+	Username  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ADMIN_SESSION_DURATION is how long an admin stays logged in.
+const ADMIN_SESSION_DURATION = 12 * time.Hour
+
+// ADMIN_PASSWORD_MIN_LENGTH is the shortest password accepted for admins.
+const ADMIN_PASSWORD_MIN_LENGTH = 12
+
+var InvalidLoginError = errors.New("invalid username or password")
+var WeakPasswordError = errors.New("password too short")
+
+type AdminRepo interface {
+	GetAdminPasswordHash(username string) (string, error)
+	SetAdminPassword(username string, hash string, at time.Time) error
+	CountAdminUsers() (int, error)
+	CreateAdminSession(session *model.AdminSession) error
+	GetAdminSession(token string) (*model.AdminSession, error)
+	DeleteAdminSession(token string) error
+	DeleteAdminSessions(username string) error
+	DeleteExpiredAdminSessions(now time.Time) error
+}
+
+// AdminService logs in the local admin users, whose passwords are stored as
+// bcrypt hashes.
+type AdminService struct {
+	repo AdminRepo
+	// dummyHash is compared against for unknown users, so they take as long
+	// to reject as wrong passwords
+	dummyHash []byte
+}
+
+func NewAdminService(repo AdminRepo) *AdminService {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte(rand.Text()), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return &AdminService{repo: repo, dummyHash: dummyHash}
+}
+
+// SetPassword creates the admin user or changes its password, which logs it
+// out everywhere.
+func (s *AdminService) SetPassword(username string, password string, now time.Time) error {
+	if len(password) < ADMIN_PASSWORD_MIN_LENGTH {
+		return WeakPasswordError
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetAdminPassword(username, string(hash), now); err != nil {
+		return err
+	}
+	return s.repo.DeleteAdminSessions(username)
+}
+
+// EnsurePassword sets the password of the user unless it already has it, so
+// sessions survive restarts with the same configured password.
+func (s *AdminService) EnsurePassword(username string, password string, now time.Time) error {
+	hash, err := s.repo.GetAdminPasswordHash(username)
+	if err != nil {
+		return err
+	}
+	if hash != "" && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+		return nil
+	}
+	return s.SetPassword(username, password, now)
+}
+
+// HasUsers tells whether anyone can log in at all.
+func (s *AdminService) HasUsers() (bool, error) {
+	count, err := s.repo.CountAdminUsers()
+	return count > 0, err
+}
+
+// Login checks the password of the user and starts a session, whose token
+// is returned.
+func (s *AdminService) Login(username string, password string, now time.Time) (string, error) {
+	hash, err := s.repo.GetAdminPasswordHash(username)
+	if err != nil {
+		return "", err
+	}
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return "", InvalidLoginError
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return "", InvalidLoginError
+	}
+
+	if err := s.repo.DeleteExpiredAdminSessions(now); err != nil {
+		return "", err
+	}
+	session := model.AdminSession{
+		Token:     rand.Text(),
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ADMIN_SESSION_DURATION),
+	}
+	if err := s.repo.CreateAdminSession(&session); err != nil {
+		return "", err
+	}
+	return session.Token, nil
+}
+
+// Session returns the user logged in with the token, or an empty string if
+// the session does not exist or has expired.
+func (s *AdminService) Session(token string, now time.Time) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	session, err := s.repo.GetAdminSession(token)
+	if err != nil || session == nil {
+		return "", err
+	}
+	if !now.Before(session.ExpiresAt) {
+		return "", nil
+	}
+	return session.Username, nil
+}
+
+func (s *AdminService) Logout(token string) error {
+	return s.repo.DeleteAdminSession(token)
+}
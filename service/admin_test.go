@@ -0,0 +1,123 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAdminRepo struct {
+	hashes   map[string]string
+	sessions map[string]*model.AdminSession
+}
+
+func newFakeAdminRepo() *fakeAdminRepo {
+	return &fakeAdminRepo{hashes: map[string]string{}, sessions: map[string]*model.AdminSession{}}
+}
+
+func (r *fakeAdminRepo) GetAdminPasswordHash(username string) (string, error) {
+	return r.hashes[username], nil
+}
+
+func (r *fakeAdminRepo) SetAdminPassword(username string, hash string, at time.Time) error {
+	r.hashes[username] = hash
+	return nil
+}
+
+func (r *fakeAdminRepo) CountAdminUsers() (int, error) {
+	return len(r.hashes), nil
+}
+
+func (r *fakeAdminRepo) CreateAdminSession(session *model.AdminSession) error {
+	r.sessions[session.Token] = session
+	return nil
+}
+
+func (r *fakeAdminRepo) GetAdminSession(token string) (*model.AdminSession, error) {
+	return r.sessions[token], nil
+}
+
+func (r *fakeAdminRepo) DeleteAdminSession(token string) error {
+	delete(r.sessions, token)
+	return nil
+}
+
+func (r *fakeAdminRepo) DeleteAdminSessions(username string) error {
+	for token, s := range r.sessions {
+		if s.Username == username {
+			delete(r.sessions, token)
+		}
+	}
+	return nil
+}
+
+func (r *fakeAdminRepo) DeleteExpiredAdminSessions(now time.Time) error {
+	for token, s := range r.sessions {
+		if s.ExpiresAt.Before(now) {
+			delete(r.sessions, token)
+		}
+	}
+	return nil
+}
+
+func TestAdminLogin(t *testing.T) {
+	repo := newFakeAdminRepo()
+	s := NewAdminService(repo)
+	now := time.Now()
+
+	hasUsers, err := s.HasUsers()
+	require.NoError(t, err)
+	assert.False(t, hasUsers)
+
+	assert.ErrorIs(t, s.SetPassword("max", "short", now), WeakPasswordError)
+	require.NoError(t, s.SetPassword("max", "correct horse battery", now))
+	assert.NotContains(t, repo.hashes["max"], "horse", "only the hash is stored")
+
+	_, err = s.Login("max", "wrong password", now)
+	assert.ErrorIs(t, err, InvalidLoginError)
+	_, err = s.Login("moritz", "correct horse battery", now)
+	assert.ErrorIs(t, err, InvalidLoginError)
+
+	token, err := s.Login("max", "correct horse battery", now)
+	require.NoError(t, err)
+	user, err := s.Session(token, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, "max", user)
+
+	user, err = s.Session(token, now.Add(ADMIN_SESSION_DURATION))
+	require.NoError(t, err)
+	assert.Empty(t, user, "session expired")
+	user, err = s.Session("", now)
+	require.NoError(t, err)
+	assert.Empty(t, user)
+
+	require.NoError(t, s.Logout(token))
+	user, err = s.Session(token, now)
+	require.NoError(t, err)
+	assert.Empty(t, user)
+}
+
+func TestAdminEnsurePassword(t *testing.T) {
+	repo := newFakeAdminRepo()
+	s := NewAdminService(repo)
+	now := time.Now()
+
+	require.NoError(t, s.EnsurePassword("max", "correct horse battery", now))
+	token, err := s.Login("max", "correct horse battery", now)
+	require.NoError(t, err)
+
+	require.NoError(t, s.EnsurePassword("max", "correct horse battery", now))
+	user, err := s.Session(token, now)
+	require.NoError(t, err)
+	assert.Equal(t, "max", user, "unchanged password keeps sessions")
+
+	require.NoError(t, s.EnsurePassword("max", "new horse battery", now))
+	user, err = s.Session(token, now)
+	require.NoError(t, err)
+	assert.Empty(t, user, "changed password logs out")
+	_, err = s.Login("max", "new horse battery", now)
+	assert.NoError(t, err)
+}
@@ -2,7 +2,16 @@ package service
 
 import (
 	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
 	"math/big"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/resterle/dg-cal/v2/model"
 )
@@ -11,6 +20,26 @@ const idGroupLen = 4
 const idGroups = 4
 const charset = "abcdefghjkmnpqrstuvwxyz23456789"
 
+var InheritanceCycleError = errors.New("calendar inherits from itself")
+
+// CalendarGoneError is returned for revoked public ids whose alias expired
+// and for deleted calendars.
+var CalendarGoneError = errors.New("calendar id was revoked")
+
+// NotInTrashError is returned when purging a calendar that was not deleted.
+var NotInTrashError = errors.New("calendar is not in the trash")
+
+// NOTE_MAX_LENGTH is the maximum number of characters of a note.
+const NOTE_MAX_LENGTH = 500
+
+// AttendanceStatuses are the states a calendar owner can mark a tournament with.
+var AttendanceStatuses = []string{
+	model.SUBSCRIPTION_STATUS_PLANNED,
+	model.SUBSCRIPTION_STATUS_REGISTERED,
+	model.SUBSCRIPTION_STATUS_ATTENDED,
+	model.SUBSCRIPTION_STATUS_DECLINED,
+}
+
 type CalendarRepo interface {
 	CreateCalendar(id, editId, title string, config model.SubscriptionConfig) error
 	UpdateCalendar(calendar *model.Calendar) error
@@ -19,7 +48,35 @@ type CalendarRepo interface {
 	GetCalendarByEditId(editId string) (*model.Calendar, error)
 	GetCalendarUpdateCount() (map[int]int, error)
 	SetCalendarRetrievedAt(calendarId string) error
-	DeleteCalendar(id string) error
+	TrashCalendar(calendarId string, deletedAt time.Time) error
+	RestoreCalendar(calendarId string) error
+	PurgeCalendar(id string) error
+	GetDeletedCalendars() ([]*model.Calendar, error)
+	GetDeletedCalendar(id string) (*model.Calendar, error)
+	GetSubscriptions(calendar *model.Calendar) ([]*model.Subscription, error)
+	UpsertSubscription(subscription *model.Subscription) error
+	DeleteSubscription(calendarId string, tournamentId int) error
+	GetNotes(calendarId string) (map[int]string, error)
+	UpsertNote(calendarId string, tournamentId int, note string) error
+	DeleteNote(calendarId string, tournamentId int) error
+	SetEditId(calendarId string, editId string) error
+	RenameCalendar(oldId string, newId string, expiresAt time.Time) error
+	GetCalendarAlias(id string) (string, time.Time, error)
+	CreateEditor(editor *model.Editor) error
+	GetEditors(calendarId string) ([]*model.Editor, error)
+	GetEditorBySecret(secret string) (*model.Editor, error)
+	AcceptInvite(token string) (*model.Editor, error)
+	SetEditorSecret(editorId int, secret string) error
+	DeleteEditor(calendarId string, editorId int) error
+	AddAuditEntry(entry *model.AuditEntry) error
+	GetAuditEntries(calendarId string, limit int) ([]*model.AuditEntry, error)
+	AddVersion(version *model.CalendarVersion) error
+	GetVersions(calendarId string, limit int) ([]*model.CalendarVersion, error)
+	GetVersion(calendarId string, versionId int) (*model.CalendarVersion, error)
+	AddRetrieval(calendarId string, client string, status int, at time.Time) error
+	GetRetrievals(calendarId string, since time.Time) ([]*model.Retrieval, error)
+	GetClientStats(since time.Time, errorStatus int) ([]*model.ClientStats, error)
+	DeleteRetrievals(before time.Time) error
 }
 
 type CalId struct {
@@ -36,7 +93,8 @@ func CalendarEditId(id string) CalId {
 }
 
 type CalendarService struct {
-	repo CalendarRepo
+	repo       CalendarRepo
+	generation atomic.Int64
 }
 
 func NewCalendarService(repo CalendarRepo) *CalendarService {
@@ -50,6 +108,9 @@ func (s *CalendarService) CreateCalendar(title string, config model.Subscription
 	if err := s.repo.CreateCalendar(id, editId, title, config); err != nil {
 		return "", err
 	}
+	if err := s.repo.AddVersion(&model.CalendarVersion{CalendarId: id, Title: title, Config: &config, CreatedAt: time.Now()}); err != nil {
+		return "", err
+	}
 
 	return editId, nil
 }
@@ -58,6 +119,7 @@ func (s *CalendarService) UpdateCalendar(calendar *model.Calendar) (*model.Calen
 	if err := s.repo.UpdateCalendar(calendar); err != nil {
 		return nil, err
 	}
+	s.generation.Add(1)
 	return calendar, nil
 }
 
@@ -81,8 +143,256 @@ func (s *CalendarService) GetAllCalendars() ([]*model.Calendar, error) {
 	return s.repo.GetCalendars()
 }
 
+// DeleteCalendar moves the calendar to the trash, where it can be restored
+// until it is purged.
 func (s *CalendarService) DeleteCalendar(id string) error {
-	return s.repo.DeleteCalendar(id)
+	if err := s.repo.TrashCalendar(id, time.Now()); err != nil {
+		return err
+	}
+	s.generation.Add(1)
+	return nil
+}
+
+func (s *CalendarService) RestoreCalendar(id string) error {
+	if err := s.repo.RestoreCalendar(id); err != nil {
+		return err
+	}
+	s.generation.Add(1)
+	return nil
+}
+
+// PurgeCalendar removes a deleted calendar for good.
+func (s *CalendarService) PurgeCalendar(id string) error {
+	calendar, err := s.repo.GetDeletedCalendar(id)
+	if err != nil {
+		return err
+	}
+	if calendar == nil {
+		return NotInTrashError
+	}
+	return s.repo.PurgeCalendar(id)
+}
+
+// GetDeletedCalendars returns the calendars in the trash, recently deleted
+// first.
+func (s *CalendarService) GetDeletedCalendars() ([]*model.Calendar, error) {
+	calendars, err := s.repo.GetDeletedCalendars()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(calendars, func(a, b *model.Calendar) int { return b.DeletedAt.Compare(*a.DeletedAt) })
+	return calendars, nil
+}
+
+// GetGeneration returns a counter that is incremented by every change of a
+// calendar, feeds inheriting from other calendars depend on it.
+func (s *CalendarService) GetGeneration() int {
+	return int(s.generation.Load())
+}
+
+// RotateEditId replaces the edit code of the calendar, the old one stops
+// working immediately.
+func (s *CalendarService) RotateEditId(calendar *model.Calendar) (string, error) {
+	editId := generateSecret()
+	if err := s.repo.SetEditId(calendar.Id, editId); err != nil {
+		return "", err
+	}
+	return editId, nil
+}
+
+// RotateId gives the calendar a new public id. The old id keeps resolving to
+// the calendar for the grace period, afterwards it is gone. Calendars
+// inheriting from it are updated to the new id.
+func (s *CalendarService) RotateId(calendar *model.Calendar, grace time.Duration) (string, error) {
+	oldId := calendar.Id
+	newId := rand.Text()
+	if err := s.repo.RenameCalendar(oldId, newId, time.Now().Add(grace)); err != nil {
+		return "", err
+	}
+	calendar.Id = newId
+
+	calendars, err := s.repo.GetCalendars()
+	if err != nil {
+		return "", err
+	}
+	for _, c := range calendars {
+		if c.Config == nil || !slices.Contains(c.Config.Inherit, oldId) {
+			continue
+		}
+		for i, id := range c.Config.Inherit {
+			if id == oldId {
+				c.Config.Inherit[i] = newId
+			}
+		}
+		if err := s.repo.UpdateCalendar(c); err != nil {
+			return "", err
+		}
+	}
+	s.generation.Add(1)
+	return newId, nil
+}
+
+// ResolveCalendarId returns the current public id of a calendar that was
+// known as id. It is empty if id never belonged to a calendar, and
+// CalendarGoneError is returned once the grace period of id is over or while
+// the calendar is deleted.
+func (s *CalendarService) ResolveCalendarId(id string, now time.Time) (string, error) {
+	calendarId, expiresAt, err := s.repo.GetCalendarAlias(id)
+	if err != nil {
+		return "", err
+	}
+	if calendarId == "" {
+		// Deleted calendars are gone as well until they are restored
+		deleted, err := s.repo.GetDeletedCalendar(id)
+		if err == nil && deleted != nil {
+			err = CalendarGoneError
+		}
+		return "", err
+	}
+	if !now.Before(expiresAt) {
+		return "", CalendarGoneError
+	}
+	return calendarId, nil
+}
+
+// GetAttendance returns the attendance status of the calendar by tournament id.
+func (s *CalendarService) GetAttendance(calendar *model.Calendar) (map[int]string, error) {
+	subscriptions, err := s.repo.GetSubscriptions(calendar)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[int]string{}
+	for _, subscription := range subscriptions {
+		if slices.Contains(AttendanceStatuses, subscription.Status) {
+			result[subscription.Tournament.Id] = subscription.Status
+		}
+	}
+	return result, nil
+}
+
+// SetAttendance marks a tournament with one of AttendanceStatuses, an empty
+// status clears it. The calendar is updated so its feed is rendered again.
+func (s *CalendarService) SetAttendance(calendar *model.Calendar, tournamentId int, status string) error {
+	var err error
+	if status == "" {
+		err = s.repo.DeleteSubscription(calendar.Id, tournamentId)
+	} else if !slices.Contains(AttendanceStatuses, status) {
+		return fmt.Errorf("unknown attendance status %q", status)
+	} else {
+		err = s.repo.UpsertSubscription(&model.Subscription{Calendar: calendar, Tournament: &model.Tournament{Id: tournamentId}, Status: status})
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.repo.UpdateCalendar(calendar)
+}
+
+// GetNotes returns the notes of the calendar by tournament id.
+func (s *CalendarService) GetNotes(calendar *model.Calendar) (map[int]string, error) {
+	return s.repo.GetNotes(calendar.Id)
+}
+
+// SetNotes stores the given notes by tournament id, an empty note removes it.
+// Notes not in the map are kept.
+func (s *CalendarService) SetNotes(calendar *model.Calendar, notes map[int]string) error {
+	stored, err := s.repo.GetNotes(calendar.Id)
+	if err != nil {
+		return err
+	}
+
+	for tournamentId, note := range notes {
+		note = SanitizeNote(note)
+		if utf8.RuneCountInString(note) > NOTE_MAX_LENGTH {
+			return fmt.Errorf("note for tournament %d is longer than %d characters", tournamentId, NOTE_MAX_LENGTH)
+		}
+		if note == stored[tournamentId] {
+			continue
+		}
+
+		if note == "" {
+			err = s.repo.DeleteNote(calendar.Id, tournamentId)
+		} else {
+			err = s.repo.UpsertNote(calendar.Id, tournamentId, note)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SanitizeNote normalizes line breaks and drops invalid UTF-8 and control
+// characters, which golang-ical would write into the feed unescaped.
+func SanitizeNote(note string) string {
+	note = strings.ToValidUTF8(note, "")
+	note = strings.ReplaceAll(note, "\r\n", "\n")
+	note = strings.ReplaceAll(note, "\r", "\n")
+	note = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return -1
+		}
+		return r
+	}, note)
+	return strings.TrimSpace(note)
+}
+
+// GetConflicts finds the conflicts between the given tournaments of the
+// calendar, leaving out declined ones.
+func (s *CalendarService) GetConflicts(calendar *model.Calendar, tournaments []*model.Tournament) ([]Conflict, error) {
+	attendance, err := s.GetAttendance(calendar)
+	if err != nil {
+		return nil, err
+	}
+
+	tournaments = slices.DeleteFunc(slices.Clone(tournaments), func(t *model.Tournament) bool {
+		return attendance[t.Id] == model.SUBSCRIPTION_STATUS_DECLINED
+	})
+	return FindConflicts(tournaments, time.Duration(calendar.Config.ConflictWindow)*time.Minute), nil
+}
+
+// GetMatcher builds the matcher for config including the calendars it inherits
+// from. id is the public id of the calendar config belongs to and is used to
+// detect cycles, it is empty for calendars not stored yet.
+func (s *CalendarService) GetMatcher(id string, config model.SubscriptionConfig) (*TournamentMatcher, error) {
+	return s.matcher(config, []string{id})
+}
+
+func (s *CalendarService) matcher(config model.SubscriptionConfig, path []string) (*TournamentMatcher, error) {
+	m, err := NewTournamentMatcher(config)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, parentId := range config.Inherit {
+		if slices.Contains(path, parentId) {
+			return nil, InheritanceCycleError
+		}
+		parent, err := s.repo.GetCalendarById(parentId)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			log.Printf("Inherited calendar %s does not exist", parentId)
+			continue
+		}
+
+		p, err := s.matcher(*parent.Config, append(slices.Clone(path), parentId))
+		if err != nil {
+			return nil, fmt.Errorf("calendar %s: %w", parentId, err)
+		}
+		m.parents = append(m.parents, p)
+		for _, updatedAt := range []time.Time{parent.UpdatedAt, p.updatedAt} {
+			if updatedAt.After(m.updatedAt) {
+				m.updatedAt = updatedAt
+			}
+		}
+	}
+	return m, nil
 }
 
 func generateSecret() string {
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCalendarService() (*CalendarService, *fakeCalendarRepo) {
+	repo := &fakeCalendarRepo{calendars: map[string]*model.Calendar{
+		"cal":   {Id: "cal", Title: "My calendar", Config: &model.SubscriptionConfig{Series: []string{"Liga"}}},
+		"child": {Id: "child", Title: "Child", Config: &model.SubscriptionConfig{Inherit: []string{"other", "cal"}}},
+	}}
+	return NewCalendarService(repo), repo
+}
+
+func TestRotateEditId(t *testing.T) {
+	s, repo := newTestCalendarService()
+
+	first, err := s.RotateEditId(repo.calendars["cal"])
+	require.NoError(t, err)
+	assert.Len(t, first, idGroupLen*idGroups)
+	assert.Equal(t, first, repo.editIds["cal"])
+
+	second, err := s.RotateEditId(repo.calendars["cal"])
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, second, repo.editIds["cal"])
+}
+
+func TestRotateId(t *testing.T) {
+	s, repo := newTestCalendarService()
+	require.NoError(t, repo.UpsertNote("cal", 42, "Zelt mitnehmen"))
+	calendar := repo.calendars["cal"]
+
+	newId, err := s.RotateId(calendar, 7*24*time.Hour)
+	require.NoError(t, err)
+	assert.NotEqual(t, "cal", newId)
+	assert.Equal(t, newId, calendar.Id)
+
+	c, err := s.GetCalendar(CalendarId("cal"))
+	require.NoError(t, err)
+	assert.Nil(t, c, "the old id no longer opens the calendar")
+	c, err = s.GetCalendar(CalendarId(newId))
+	require.NoError(t, err)
+	require.NotNil(t, c)
+
+	notes, err := s.GetNotes(c)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{42: "Zelt mitnehmen"}, notes)
+
+	assert.Equal(t, []string{"other", newId}, repo.calendars["child"].Config.Inherit, "inheriting calendars follow the new id")
+
+	now := time.Now()
+	id, err := s.ResolveCalendarId("cal", now)
+	require.NoError(t, err)
+	assert.Equal(t, newId, id, "the old id redirects during the grace period")
+
+	_, err = s.ResolveCalendarId("cal", now.Add(8*24*time.Hour))
+	assert.ErrorIs(t, err, CalendarGoneError)
+
+	id, err = s.ResolveCalendarId("unknown", now)
+	require.NoError(t, err)
+	assert.Empty(t, id)
+
+	latestId, err := s.RotateId(calendar, 0)
+	require.NoError(t, err)
+	id, err = s.ResolveCalendarId("cal", now)
+	require.NoError(t, err)
+	assert.Equal(t, latestId, id, "older aliases point to the latest id")
+
+	_, err = s.ResolveCalendarId(newId, time.Now())
+	assert.ErrorIs(t, err, CalendarGoneError, "without grace period the old id is gone at once")
+}
+
+func TestDeleteCalendar(t *testing.T) {
+	s, repo := newTestCalendarService()
+	now := time.Now()
+
+	assert.ErrorIs(t, s.PurgeCalendar("cal"), NotInTrashError, "only deleted calendars can be purged")
+
+	require.NoError(t, s.DeleteCalendar("cal"))
+	c, err := s.GetCalendar(CalendarId("cal"))
+	require.NoError(t, err)
+	assert.Nil(t, c)
+	_, err = s.ResolveCalendarId("cal", now)
+	assert.ErrorIs(t, err, CalendarGoneError, "deleted calendars are gone")
+
+	deleted, err := s.GetDeletedCalendars()
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+
+	require.NoError(t, s.RestoreCalendar("cal"))
+	c, err = s.GetCalendar(CalendarId("cal"))
+	require.NoError(t, err)
+	assert.NotNil(t, c)
+
+	require.NoError(t, s.DeleteCalendar("cal"))
+	require.NoError(t, s.PurgeCalendar("cal"))
+	assert.NotContains(t, repo.calendars, "cal")
+	id, err := s.ResolveCalendarId("cal", now)
+	require.NoError(t, err)
+	assert.Empty(t, id)
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+)
+
+const CONFLICT_OVERLAP = "OVERLAP"
+const CONFLICT_REGISTRATION = "REGISTRATION"
+const CONFLICT_TRAVEL = "TRAVEL"
+
+// TRAVEL_MAX_KM is the distance that is still considered feasible between a
+// tournament and one starting the next day.
+const TRAVEL_MAX_KM = 400
+
+// Conflict is a pair of tournaments in a calendar that are hard to attend both.
+type Conflict struct {
+	Type string
+	A    *model.Tournament
+	B    *model.Tournament
+	// RegistrationA and RegistrationB are the phases opening close to each
+	// other, set for CONFLICT_REGISTRATION
+	RegistrationA *model.Registration
+	RegistrationB *model.Registration
+	// Distance in km, set for CONFLICT_TRAVEL
+	Distance int
+}
+
+// FindConflicts returns overlapping tournaments, registration phases opening
+// within window of each other and back-to-back tournaments too far apart.
+func FindConflicts(tournaments []*model.Tournament, window time.Duration) []Conflict {
+	sorted := slices.Clone(tournaments)
+	slices.SortFunc(sorted, func(a, b *model.Tournament) int {
+		if c := a.StartDate.Compare(b.StartDate); c != 0 {
+			return c
+		}
+		return a.Id - b.Id
+	})
+
+	result := []Conflict{}
+	for i, a := range sorted {
+		for _, b := range sorted[i+1:] {
+			if !dateOnly(b.StartDate).After(dateOnly(a.EndDate)) {
+				result = append(result, Conflict{Type: CONFLICT_OVERLAP, A: a, B: b})
+			} else if dateOnly(b.StartDate).Equal(dateOnly(a.EndDate).Add(24 * time.Hour)) {
+				if d, ok := distance(a.GeoLocation, b.GeoLocation); ok && d > TRAVEL_MAX_KM {
+					result = append(result, Conflict{Type: CONFLICT_TRAVEL, A: a, B: b, Distance: int(d)})
+				}
+			}
+
+			for _, ra := range a.Registrations {
+				for _, rb := range b.Registrations {
+					diff := ra.StartDate.Sub(rb.StartDate).Abs()
+					if diff.Truncate(time.Minute) <= window {
+						result = append(result, Conflict{Type: CONFLICT_REGISTRATION, A: a, B: b, RegistrationA: ra, RegistrationB: rb})
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// distance returns the great-circle distance in km between two "lat, lng" locations.
+func distance(from string, to string) (float64, bool) {
+	lat1, lng1, ok := parseGeo(from)
+	if !ok {
+		return 0, false
+	}
+	lat2, lng2, ok := parseGeo(to)
+	if !ok {
+		return 0, false
+	}
+
+	const earthRadius = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h)), true
+}
+
+func parseGeo(geo string) (float64, float64, bool) {
+	parts := strings.Split(geo, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
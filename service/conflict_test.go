@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindConflicts(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 6, d, 0, 0, 0, 0, time.UTC) }
+	opening := time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC)
+
+	berlin := &model.Tournament{Id: 1, Title: "Berlin", StartDate: day(14), EndDate: day(15), GeoLocation: "52.52, 13.40",
+		Registrations: []*model.Registration{{Title: "Phase 1", StartDate: opening}}}
+	potsdam := &model.Tournament{Id: 2, Title: "Potsdam", StartDate: day(15), EndDate: day(15), GeoLocation: "52.39, 13.06"}
+	munich := &model.Tournament{Id: 3, Title: "München", StartDate: day(16), EndDate: day(16), GeoLocation: "48.14, 11.58",
+		Registrations: []*model.Registration{{Title: "Phase 1", StartDate: opening.Add(10 * time.Minute)}}}
+	hamburg := &model.Tournament{Id: 4, Title: "Hamburg", StartDate: day(21), EndDate: day(22), GeoLocation: "53.55, 9.99",
+		Registrations: []*model.Registration{{Title: "Phase 1", StartDate: opening.Add(30 * time.Second)}}}
+
+	type pair struct {
+		Type string
+		A, B int
+	}
+	pairs := func(conflicts []Conflict) []pair {
+		result := []pair{}
+		for _, c := range conflicts {
+			result = append(result, pair{c.Type, c.A.Id, c.B.Id})
+		}
+		return result
+	}
+
+	conflicts := FindConflicts([]*model.Tournament{hamburg, munich, potsdam, berlin}, 0)
+	assert.Equal(t, []pair{
+		{CONFLICT_OVERLAP, 1, 2},
+		{CONFLICT_TRAVEL, 1, 3},
+		{CONFLICT_REGISTRATION, 1, 4},
+		{CONFLICT_TRAVEL, 2, 3},
+	}, pairs(conflicts), "registrations opening in the same minute conflict")
+	assert.InDelta(t, 485, conflicts[3].Distance, 5)
+
+	conflicts = FindConflicts([]*model.Tournament{potsdam, munich, hamburg}, 15*time.Minute)
+	assert.Equal(t, []pair{
+		{CONFLICT_TRAVEL, 2, 3},
+		{CONFLICT_REGISTRATION, 3, 4},
+	}, pairs(conflicts), "registrations opening within the window conflict")
+	require.NotNil(t, conflicts[1].RegistrationA)
+}
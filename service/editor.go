@@ -0,0 +1,223 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/resterle/dg-cal/v2/model"
+)
+
+// EditorRoles are ordered from most to least rights. Owners manage editors,
+// email and the feed URL, editors change the calendar and viewers may only
+// look at the edit page and preview rules.
+var EditorRoles = []string{model.EDITOR_ROLE_OWNER, model.EDITOR_ROLE_EDITOR, model.EDITOR_ROLE_VIEWER}
+
+// EDITOR_NAME_MAX_LENGTH is the maximum number of characters of an editor name.
+const EDITOR_NAME_MAX_LENGTH = 100
+
+// AUDIT_LOG_LENGTH is the number of changes shown for a calendar.
+const AUDIT_LOG_LENGTH = 50
+
+var InvalidEditorError = errors.New("editor needs a name and a known role")
+
+// HasRole reports whether editor has role or one with more rights.
+func HasRole(editor *model.Editor, role string) bool {
+	i := slices.Index(EditorRoles, editor.Role)
+	return i >= 0 && i <= slices.Index(EditorRoles, role)
+}
+
+// GetEditor returns the calendar and editor for a secret, which is either the
+// edit code of the calendar or the secret of an invited editor. Both are nil
+// if the secret is unknown.
+func (s *CalendarService) GetEditor(secret string) (*model.Calendar, *model.Editor, error) {
+	calendar, err := s.repo.GetCalendarByEditId(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	if calendar != nil {
+		return calendar, &model.Editor{CalendarId: calendar.Id, Role: model.EDITOR_ROLE_OWNER, Secret: secret}, nil
+	}
+
+	editor, err := s.repo.GetEditorBySecret(secret)
+	if err != nil || editor == nil {
+		return nil, nil, err
+	}
+	calendar, err = s.repo.GetCalendarById(editor.CalendarId)
+	if err != nil || calendar == nil {
+		return nil, nil, err
+	}
+	return calendar, editor, nil
+}
+
+func (s *CalendarService) GetEditors(calendar *model.Calendar) ([]*model.Editor, error) {
+	return s.repo.GetEditors(calendar.Id)
+}
+
+// InviteEditor creates an editor whose secret is handed out through the
+// invite link built from InviteToken.
+func (s *CalendarService) InviteEditor(calendar *model.Calendar, name string, role string) (*model.Editor, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > EDITOR_NAME_MAX_LENGTH || !slices.Contains(EditorRoles, role) {
+		return nil, InvalidEditorError
+	}
+
+	editor := model.Editor{
+		CalendarId:  calendar.Id,
+		Name:        name,
+		Role:        role,
+		Secret:      generateSecret(),
+		InviteToken: generateSecret(),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repo.CreateEditor(&editor); err != nil {
+		return nil, err
+	}
+	return &editor, nil
+}
+
+// AcceptInvite activates the editor invited with token and returns it, or nil
+// if the link is unknown or was used already.
+func (s *CalendarService) AcceptInvite(token string) (*model.Editor, error) {
+	return s.repo.AcceptInvite(token)
+}
+
+// RevokeEditor removes the access of an invited editor.
+func (s *CalendarService) RevokeEditor(calendar *model.Calendar, editorId int) error {
+	return s.repo.DeleteEditor(calendar.Id, editorId)
+}
+
+// RotateEditorSecret replaces the secret editor uses to access the calendar.
+func (s *CalendarService) RotateEditorSecret(calendar *model.Calendar, editor *model.Editor) (string, error) {
+	if editor.Id == 0 {
+		return s.RotateEditId(calendar)
+	}
+
+	secret := generateSecret()
+	if err := s.repo.SetEditorSecret(editor.Id, secret); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// RecordChange adds an audit entry for the difference between the previous
+// title and config and the current ones of calendar and stores the current
+// ones as a new version. Nothing is recorded if they are equal.
+func (s *CalendarService) RecordChange(calendar *model.Calendar, editor *model.Editor, oldTitle string, old model.SubscriptionConfig) error {
+	changes := configChanges(old, *calendar.Config)
+	if oldTitle != calendar.Title {
+		changes = append([]string{fmt.Sprintf("Title: %q → %q", oldTitle, calendar.Title)}, changes...)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if err := s.repo.AddAuditEntry(&model.AuditEntry{
+		CalendarId: calendar.Id,
+		Editor:     editor.Name,
+		CreatedAt:  now,
+		Changes:    changes,
+	}); err != nil {
+		return err
+	}
+	return s.addVersion(calendar, editor, oldTitle, old, now)
+}
+
+func (s *CalendarService) GetAuditLog(calendar *model.Calendar) ([]*model.AuditEntry, error) {
+	return s.repo.GetAuditEntries(calendar.Id, AUDIT_LOG_LENGTH)
+}
+
+// configChanges describes the fields that differ between two configs, one
+// line per field. Lists show the added and removed values.
+func configChanges(old model.SubscriptionConfig, new model.SubscriptionConfig) []string {
+	oldFields, newFields := flattenConfig(old), flattenConfig(new)
+
+	keys := []string{}
+	for k := range oldFields {
+		keys = append(keys, k)
+	}
+	for k := range newFields {
+		if _, ok := oldFields[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	result := []string{}
+	for _, k := range keys {
+		o, n := oldFields[k], newFields[k]
+		oldList, oldIsList := o.([]any)
+		newList, newIsList := n.([]any)
+		if oldIsList || newIsList || (o == nil && n == nil) {
+			if diff := listChanges(oldList, newList); diff != "" {
+				result = append(result, fmt.Sprintf("%s: %s", k, diff))
+			}
+			continue
+		}
+
+		oldJson, _ := json.Marshal(o)
+		newJson, _ := json.Marshal(n)
+		if string(oldJson) != string(newJson) {
+			result = append(result, fmt.Sprintf("%s: %s → %s", k, oldJson, newJson))
+		}
+	}
+	return result
+}
+
+func listChanges(old []any, new []any) string {
+	format := func(v any) string {
+		if s, ok := v.(string); ok {
+			return s
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	oldValues, newValues := []string{}, []string{}
+	for _, v := range old {
+		oldValues = append(oldValues, format(v))
+	}
+	for _, v := range new {
+		newValues = append(newValues, format(v))
+	}
+
+	parts := []string{}
+	for _, v := range newValues {
+		if !slices.Contains(oldValues, v) {
+			parts = append(parts, "+"+v)
+		}
+	}
+	for _, v := range oldValues {
+		if !slices.Contains(newValues, v) {
+			parts = append(parts, "-"+v)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// flattenConfig returns the JSON fields of config with nested objects joined
+// by dots, so new config fields are audited without changes here.
+func flattenConfig(config model.SubscriptionConfig) map[string]any {
+	b, _ := json.Marshal(config)
+	fields := map[string]any{}
+	json.Unmarshal(b, &fields)
+
+	result := map[string]any{}
+	var flatten func(prefix string, m map[string]any)
+	flatten = func(prefix string, m map[string]any) {
+		for k, v := range m {
+			if nested, ok := v.(map[string]any); ok {
+				flatten(prefix+k+".", nested)
+			} else {
+				result[prefix+k] = v
+			}
+		}
+	}
+	flatten("", fields)
+	return result
+}
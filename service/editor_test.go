@@ -0,0 +1,93 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditors(t *testing.T) {
+	s, repo := newTestCalendarService()
+	repo.editIds = map[string]string{"cal": "code"}
+	calendar := repo.calendars["cal"]
+
+	c, owner, err := s.GetEditor("code")
+	require.NoError(t, err)
+	assert.Equal(t, calendar, c)
+	assert.Equal(t, model.EDITOR_ROLE_OWNER, owner.Role, "the edit code belongs to an owner")
+
+	_, err = s.InviteEditor(calendar, " ", model.EDITOR_ROLE_EDITOR)
+	assert.ErrorIs(t, err, InvalidEditorError)
+	_, err = s.InviteEditor(calendar, "Anna", "ADMIN")
+	assert.ErrorIs(t, err, InvalidEditorError)
+
+	invited, err := s.InviteEditor(calendar, " Anna ", model.EDITOR_ROLE_VIEWER)
+	require.NoError(t, err)
+	assert.Equal(t, "Anna", invited.Name)
+
+	c, _, err = s.GetEditor(invited.Secret)
+	require.NoError(t, err)
+	assert.Nil(t, c, "the secret works only once the invitation is accepted")
+
+	accepted, err := s.AcceptInvite(invited.InviteToken)
+	require.NoError(t, err)
+	require.NotNil(t, accepted)
+	accepted, err = s.AcceptInvite(invited.InviteToken)
+	require.NoError(t, err)
+	assert.Nil(t, accepted, "invite links work once")
+
+	c, editor, err := s.GetEditor(invited.Secret)
+	require.NoError(t, err)
+	assert.Equal(t, calendar, c)
+	assert.Equal(t, "Anna", editor.Name)
+	assert.True(t, HasRole(editor, model.EDITOR_ROLE_VIEWER))
+	assert.False(t, HasRole(editor, model.EDITOR_ROLE_EDITOR))
+	assert.True(t, HasRole(owner, model.EDITOR_ROLE_EDITOR))
+
+	secret, err := s.RotateEditorSecret(calendar, editor)
+	require.NoError(t, err)
+	c, _, _ = s.GetEditor(invited.Secret)
+	assert.Nil(t, c)
+	c, _, _ = s.GetEditor(secret)
+	assert.NotNil(t, c)
+
+	require.NoError(t, s.RevokeEditor(calendar, editor.Id))
+	c, _, _ = s.GetEditor(secret)
+	assert.Nil(t, c, "revoked editors lose access")
+	editors, err := s.GetEditors(calendar)
+	require.NoError(t, err)
+	assert.Empty(t, editors)
+}
+
+func TestRecordChange(t *testing.T) {
+	s, repo := newTestCalendarService()
+	calendar := repo.calendars["cal"]
+	editor := &model.Editor{Name: "Anna", Role: model.EDITOR_ROLE_EDITOR}
+
+	old := *calendar.Config
+	require.NoError(t, s.RecordChange(calendar, editor, calendar.Title, old))
+	assert.Empty(t, repo.audit, "unchanged configs are not recorded")
+
+	calendar.Title = "Club"
+	calendar.Config = &model.SubscriptionConfig{
+		Series:      []string{"Cup"},
+		Tournaments: []int{42},
+		Tasks:       true,
+		Rules:       model.SubscriptionRules{Title: "Open"},
+	}
+	require.NoError(t, s.RecordChange(calendar, editor, "My calendar", old))
+
+	log, err := s.GetAuditLog(calendar)
+	require.NoError(t, err)
+	require.Len(t, log, 1)
+	assert.Equal(t, "Anna", log[0].Editor)
+	assert.Equal(t, []string{
+		`Title: "My calendar" → "Club"`,
+		`Rules.Title: "" → "Open"`,
+		`Series: +Cup, -Liga`,
+		`Tasks: false → true`,
+		`Tournaments: +42`,
+	}, log[0].Changes)
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+const FEED_FORMAT_ICS = "ics"
+const FEED_FORMAT_JCAL = "jcal"
+const FEED_FORMAT_XCAL = "xcal"
+
+const xCalNamespace = "urn:ietf:params:xml:ns:icalendar-2.0"
+
+// serializeFeed renders the calendar model built by render in the given format.
+// All formats walk the same components, so they always contain the same data.
+func serializeFeed(cal *ics.Calendar, format string) (string, error) {
+	switch format {
+	case FEED_FORMAT_ICS:
+		return cal.Serialize(), nil
+	case FEED_FORMAT_JCAL:
+		return serializeJCal(cal)
+	case FEED_FORMAT_XCAL:
+		return serializeXCal(cal)
+	}
+	return "", fmt.Errorf("unknown feed format %q", format)
+}
+
+type feedComponent struct {
+	name       string
+	properties []ics.BaseProperty
+	components []feedComponent
+}
+
+func feedComponents(cal *ics.Calendar) feedComponent {
+	root := feedComponent{name: "vcalendar"}
+	for _, p := range cal.CalendarProperties {
+		root.properties = append(root.properties, p.BaseProperty)
+	}
+	root.components = subComponents(cal.Components)
+	return root
+}
+
+func subComponents(components []ics.Component) []feedComponent {
+	result := []feedComponent{}
+	for _, c := range components {
+		var name string
+		switch c.(type) {
+		case *ics.VEvent:
+			name = "vevent"
+		case *ics.VTodo:
+			name = "vtodo"
+		case *ics.VAlarm:
+			name = "valarm"
+		default:
+			continue
+		}
+
+		fc := feedComponent{name: name, components: subComponents(c.SubComponents())}
+		for _, p := range c.UnknownPropertiesIANAProperties() {
+			fc.properties = append(fc.properties, p.BaseProperty)
+		}
+		result = append(result, fc)
+	}
+	return result
+}
+
+// valueType returns the RFC 5545 value type of a property in lower case, as
+// used by both jCal and xCal.
+func valueType(p ics.BaseProperty) string {
+	if strings.HasPrefix(p.IANAToken, "X-") {
+		return "unknown"
+	}
+	return strings.ToLower(string(p.GetValueType()))
+}
+
+// parameters returns the property parameters except VALUE, which both
+// formats express through the value type instead.
+func parameters(p ics.BaseProperty) map[string][]string {
+	result := map[string][]string{}
+	for k, v := range p.ICalParameters {
+		if k == string(ics.ParameterValue) {
+			continue
+		}
+		result[strings.ToLower(k)] = v
+	}
+	return result
+}
+
+// formatValue converts basic format date and date-time values into the
+// extended format required by jCal and xCal.
+func formatValue(valueType string, value string) string {
+	switch valueType {
+	case "date":
+		if len(value) == 8 {
+			return value[0:4] + "-" + value[4:6] + "-" + value[6:8]
+		}
+	case "date-time":
+		if len(value) >= 15 {
+			return value[0:4] + "-" + value[4:6] + "-" + value[6:8] + "T" + value[9:11] + ":" + value[11:13] + ":" + value[13:]
+		}
+	}
+	return value
+}
+
+func serializeJCal(cal *ics.Calendar) (string, error) {
+	b, err := json.Marshal(jCalComponent(feedComponents(cal)))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func jCalComponent(c feedComponent) []any {
+	properties := []any{}
+	for _, p := range c.properties {
+		properties = append(properties, jCalProperty(p))
+	}
+	components := []any{}
+	for _, sub := range c.components {
+		components = append(components, jCalComponent(sub))
+	}
+	return []any{c.name, properties, components}
+}
+
+func jCalProperty(p ics.BaseProperty) []any {
+	params := map[string]any{}
+	for k, v := range parameters(p) {
+		if len(v) == 1 {
+			params[k] = v[0]
+		} else {
+			params[k] = v
+		}
+	}
+
+	t := valueType(p)
+	var value any = formatValue(t, p.Value)
+	switch t {
+	case "integer":
+		if i, err := strconv.Atoi(p.Value); err == nil {
+			value = i
+		}
+	case "float":
+		// GEO is the only float property and is structured as [lat, lon]
+		parts := []any{}
+		for _, part := range strings.Split(p.Value, ";") {
+			if f, err := strconv.ParseFloat(part, 64); err == nil {
+				parts = append(parts, f)
+			}
+		}
+		value = parts
+	}
+
+	return []any{strings.ToLower(p.IANAToken), params, t, value}
+}
+
+func serializeXCal(cal *ics.Calendar) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	e := xml.NewEncoder(&buf)
+	root := xml.StartElement{Name: xml.Name{Local: "icalendar"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: xCalNamespace}}}
+	if err := e.EncodeToken(root); err != nil {
+		return "", err
+	}
+	if err := xCalComponent(e, feedComponents(cal)); err != nil {
+		return "", err
+	}
+	if err := e.EncodeToken(root.End()); err != nil {
+		return "", err
+	}
+	if err := e.Flush(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func xCalComponent(e *xml.Encoder, c feedComponent) error {
+	return xCalElement(e, c.name, func() error {
+		if err := xCalElement(e, "properties", func() error {
+			for _, p := range c.properties {
+				if err := xCalProperty(e, p); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if len(c.components) == 0 {
+			return nil
+		}
+		return xCalElement(e, "components", func() error {
+			for _, sub := range c.components {
+				if err := xCalComponent(e, sub); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func xCalProperty(e *xml.Encoder, p ics.BaseProperty) error {
+	return xCalElement(e, strings.ToLower(p.IANAToken), func() error {
+		params := parameters(p)
+		if len(params) > 0 {
+			if err := xCalElement(e, "parameters", func() error {
+				for _, k := range slices.Sorted(maps.Keys(params)) {
+					values := params[k]
+					if err := xCalElement(e, k, func() error {
+						for _, v := range values {
+							if err := xCalText(e, "text", v); err != nil {
+								return err
+							}
+						}
+						return nil
+					}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		t := valueType(p)
+		if t == "float" {
+			// GEO is the only float property and is structured as latitude/longitude
+			geo := strings.SplitN(p.Value, ";", 2)
+			if len(geo) == 2 {
+				if err := xCalText(e, "latitude", geo[0]); err != nil {
+					return err
+				}
+				return xCalText(e, "longitude", geo[1])
+			}
+		}
+		return xCalText(e, t, formatValue(t, p.Value))
+	})
+}
+
+func xCalElement(e *xml.Encoder, name string, content func() error) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := content(); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+func xCalText(e *xml.Encoder, name string, text string) error {
+	return xCalElement(e, name, func() error {
+		return e.EncodeToken(xml.CharData(text))
+	})
+}
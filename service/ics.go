@@ -1,18 +1,51 @@
 package service
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
 	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	ics "github.com/arran4/golang-ical"
+	"github.com/resterle/dg-cal/v2/model"
 )
 
+// ICS_CACHE_SIZE is the number of rendered feeds kept in memory, the least
+// recently used ones are dropped beyond it.
+const ICS_CACHE_SIZE = 1000
+
+// RETRIEVED_AT_INTERVAL is how often the retrieval time of a calendar is
+// stored, feeds are polled far more often.
+const RETRIEVED_AT_INTERVAL = time.Hour
+
 type IcsService struct {
 	calendarService   *CalendarService
 	tournamentService *TournamentService
+	cache             map[string]*icsCacheEntry
+	mu                sync.Mutex
+}
+
+// IcsFeed is a rendered calendar feed together with its HTTP validators.
+type IcsFeed struct {
+	Content    string
+	ETag       string
+	ModifiedAt time.Time
+}
+
+type icsCacheEntry struct {
+	// calendar is the model every feed format is serialized from
+	calendar    *ics.Calendar
+	modifiedAt  time.Time
+	feeds       map[string]*IcsFeed
+	version     string
+	tournaments []int
+	match       func(*model.Tournament) bool
+	usedAt      time.Time
 }
 
 var NotFoundError error
@@ -20,77 +53,364 @@ var NotFoundError error
 func NewIcsService(calendarService *CalendarService, tournamentService *TournamentService) *IcsService {
 	NotFoundError = errors.New("Not found")
 
-	return &IcsService{calendarService: calendarService, tournamentService: tournamentService}
+	s := &IcsService{calendarService: calendarService, tournamentService: tournamentService, cache: map[string]*icsCacheEntry{}}
+	tournamentService.AddChangeListener(s.invalidate)
+	return s
 }
 
-func (s *IcsService) CreateIcs(id string) (string, error) {
+func (s *IcsService) CreateIcs(id string, profile IcsProfile, format string) (*IcsFeed, error) {
 	calendar, err := s.calendarService.GetCalendar(CalendarId(id))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if calendar == nil {
-		return "", NotFoundError
+		// Feeds of deleted calendars are still fetched by their subscribers
+		// for a while
+		s.evict("calendar:" + id + "|")
+		return nil, NotFoundError
 	}
 
-	updateCount, err := s.calendarService.GetUpdateCount()
-	if err != nil {
-		return "", err
+	if calendar.RetrievedAt == nil || time.Since(*calendar.RetrievedAt) >= RETRIEVED_AT_INTERVAL {
+		if err := s.calendarService.SetCalendarRetrievedAt(calendar.Id); err != nil {
+			log.Printf("Error setting calender retieved at: %s", err.Error())
+		}
 	}
 
-	tournaments := s.tournamentService.GetTournamentsForSeries(calendar.Config.Series)
-	for _, tid := range calendar.Config.Tournaments {
-		tournament := s.tournamentService.GetTournament(tid)
-		if slices.Contains(tournaments, tournament) {
-			continue
+	// Inherited calendars are only loaded to render the feed, so any stored
+	// calendar change renders it again
+	version := calendar.UpdatedAt.Format(time.RFC3339Nano)
+	if len(calendar.Config.Inherit) > 0 {
+		version = fmt.Sprintf("%s|%d", version, s.calendarService.GetGeneration())
+	}
+
+	return s.feed("calendar:"+calendar.Id, profile, format, version, func() (feedSource, error) {
+		matcher, err := s.calendarService.GetMatcher(calendar.Id, *calendar.Config)
+		if err != nil {
+			return feedSource{}, err
+		}
+
+		attendance, err := s.calendarService.GetAttendance(calendar)
+		if err != nil {
+			return feedSource{}, err
+		}
+
+		notes, err := s.calendarService.GetNotes(calendar)
+		if err != nil {
+			return feedSource{}, err
+		}
+
+		// Changes to inherited calendars show up in the modification time
+		updatedAt := calendar.UpdatedAt
+		if matcher.UpdatedAt().After(updatedAt) {
+			updatedAt = matcher.UpdatedAt()
+		}
+
+		source := feedSource{
+			title:       calendar.Title,
+			updatedAt:   updatedAt,
+			tournaments: s.tournamentService.GetMatchingTournaments(matcher),
+			match:       matcher.Match,
+			attendance:  attendance,
+			notes:       notes,
+		}
+		if calendar.Config.Tasks {
+			source.tasks = calendar.Config.Tournaments
 		}
-		tournaments = append(tournaments, tournament)
+		if calendar.Config.AnnotateConflicts {
+			if conflicts, err := s.calendarService.GetConflicts(calendar, source.tournaments); err != nil {
+				log.Printf("Error finding conflicts of calendar %s: %s", calendar.Id, err.Error())
+			} else {
+				source.conflicts = conflicts
+			}
+		}
+		return source, nil
+	})
+}
+
+// CreateSeriesIcs renders the public feed of all tournaments in a series.
+func (s *IcsService) CreateSeriesIcs(name string, profile IcsProfile, format string) (*IcsFeed, error) {
+	if !slices.Contains(s.tournamentService.GetAllSeries(false), name) {
+		return nil, NotFoundError
+	}
+
+	return s.feed("series:"+name, profile, format, "", func() (feedSource, error) {
+		return feedSource{
+			title:       name,
+			tournaments: s.tournamentService.GetTournamentsForSeries([]string{name}),
+			match:       func(t *model.Tournament) bool { return slices.Contains(t.Series, name) },
+		}, nil
+	})
+}
+
+// CreateTournamentIcs renders the public feed of a single tournament.
+func (s *IcsService) CreateTournamentIcs(id int, profile IcsProfile, format string) (*IcsFeed, error) {
+	tournament := s.tournamentService.GetTournament(id)
+	if tournament == nil {
+		return nil, NotFoundError
+	}
+
+	return s.feed(fmt.Sprintf("tournament:%d", id), profile, format, "", func() (feedSource, error) {
+		return feedSource{
+			title:       tournament.Title,
+			tournaments: []*model.Tournament{tournament},
+			match:       func(t *model.Tournament) bool { return t.Id == id },
+		}, nil
+	})
+}
+
+// feedSource is everything needed to render a feed. Changed tournaments that
+// were rendered or are accepted by match invalidate the cached feed.
+type feedSource struct {
+	title       string
+	updatedAt   time.Time
+	tournaments []*model.Tournament
+	match       func(*model.Tournament) bool
+	// tasks lists the tournaments that get a VTODO per registration phase
+	tasks []int
+	// attendance holds the attendance status by tournament id
+	attendance map[int]string
+	// notes holds the calendar owner's notes by tournament id
+	notes map[int]string
+	// conflicts are added as warnings to the descriptions
+	conflicts []Conflict
+}
+
+// feed returns the cached feed for key and profile if it was rendered for the
+// same version, and renders it from source otherwise.
+func (s *IcsService) feed(key string, profile IcsProfile, format string, version string, source func() (feedSource, error)) (*IcsFeed, error) {
+	key = key + "|" + profile.Name
+	generation := s.tournamentService.GetGeneration()
+	s.mu.Lock()
+	entry := s.cache[key]
+	s.mu.Unlock()
+	if entry == nil || entry.version != version {
+		source, err := source()
+		if err != nil {
+			return nil, err
+		}
+		entry, err = s.render(source, profile)
+		if err != nil {
+			return nil, err
+		}
+		entry.version = version
+		s.store(key, entry, generation)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry.usedAt = time.Now()
+	if feed, ok := entry.feeds[format]; ok {
+		return feed, nil
+	}
+
+	content, err := serializeFeed(entry.calendar, format)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(content))
+	feed := &IcsFeed{
+		Content:    content,
+		ETag:       fmt.Sprintf("\"%s\"", hex.EncodeToString(hash[:16])),
+		ModifiedAt: entry.modifiedAt,
 	}
+	entry.feeds[format] = feed
+	return feed, nil
+}
+
+// store caches entry unless a sync changed tournaments since generation,
+// then the entry may be rendered from the tournaments before the sync and
+// its invalidation is already over.
+func (s *IcsService) store(key string, entry *icsCacheEntry, generation int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tournamentService.GetGeneration() != generation {
+		return
+	}
+	if _, ok := s.cache[key]; !ok && len(s.cache) >= ICS_CACHE_SIZE {
+		s.evictLeastRecentlyUsed()
+	}
+	entry.usedAt = time.Now()
+	s.cache[key] = entry
+}
+
+func (s *IcsService) render(source feedSource, profile IcsProfile) (*icsCacheEntry, error) {
+	updateCount, err := s.calendarService.GetUpdateCount()
+	if err != nil {
+		return nil, err
+	}
+
+	modifiedAt := source.updatedAt
+	tournamentIds := []int{}
+
+	// Render in a stable order, tournaments come from a map
+	tournaments := slices.DeleteFunc(slices.Clone(source.tournaments), func(t *model.Tournament) bool { return t == nil })
+	slices.SortFunc(tournaments, func(a, b *model.Tournament) int { return a.Id - b.Id })
+
+	warnings, registrationWarnings := conflictWarnings(source.conflicts)
 
 	icsCal := ics.NewCalendar()
 	icsCal.SetProductId("dg-cal v0.1")
 	icsCal.SetMethod(ics.MethodPublish)
-	icsCal.SetName(calendar.Title)
+	icsCal.SetName(source.title)
 	for _, tournament := range tournaments {
-		if tournament == nil {
+		tournamentIds = append(tournamentIds, tournament.Id)
+		attendance := source.attendance[tournament.Id]
+		if attendance == model.SUBSCRIPTION_STATUS_DECLINED {
 			continue
 		}
+		registered := attendance == model.SUBSCRIPTION_STATUS_REGISTERED || attendance == model.SUBSCRIPTION_STATUS_ATTENDED
+		if tournament.UpdatedAt.After(modifiedAt) {
+			modifiedAt = tournament.UpdatedAt
+		}
+
 		e := icsCal.AddEvent(fmt.Sprintf("tournament-%d@dg-cal", tournament.Id))
 		e.SetSequence(updateCount[tournament.Id])
 		e.SetDtStampTime(tournament.UpdatedAt)
 		e.SetSummary(tournament.Title)
-		e.SetDescription(fmt.Sprintf("https://turniere.discgolf.de/index.php?p=events&sp=view&id=%d", tournament.Id))
+		link := tournamentLink(tournament.Id)
+		e.SetDescription(profile.formatDescription(withWarnings(warnings[tournament.Id], source.notes[tournament.Id]), link))
+		if profile.Url {
+			e.SetURL(link)
+		}
 
 		e.SetAllDayStartAt(tournament.StartDate)
 		e.SetAllDayEndAt(tournament.EndDate.Add(time.Hour * 24))
 		e.SetTimeTransparency(ics.TransparencyTransparent)
 
 		e.AddProperty(ics.ComponentPropertyLocation, tournament.Localtion)
-		/* Outlook issue
-		geo := strings.Split(tournament.GeoLocation, ",")
-		if len(geo) == 2 {
-			e.SetGeo(geo[0], geo[1])
+		if profile.Geo {
+			geo := strings.Split(tournament.GeoLocation, ",")
+			if len(geo) == 2 {
+				e.SetGeo(strings.TrimSpace(geo[0]), strings.TrimSpace(geo[1]))
+			}
+		}
+		if profile.MsAllDay {
+			e.SetProperty("X-MICROSOFT-CDO-ALLDAYEVENT", "TRUE")
 		}
-		*/
-		e.SetProperty("X-MICROSOFT-CDO-ALLDAYEVENT", "TRUE")
 		for i, reg := range tournament.Registrations {
 			re := icsCal.AddEvent(fmt.Sprintf("registration-%d-%d@dg-cal", tournament.Id, i))
 			re.SetDtStampTime(tournament.UpdatedAt)
 			re.SetSequence(updateCount[tournament.Id])
 			re.SetSummary("Anmeldung: " + tournament.Title)
-			re.SetDescription(fmt.Sprintf("%s\nhttps://turniere.discgolf.de/index.php?p=events&sp=view&id=%d", reg.Title, tournament.Id))
+			re.SetDescription(profile.formatDescription(withWarnings(registrationWarnings[reg], reg.Title), link))
+			if profile.Url {
+				re.SetURL(link)
+			}
 			re.SetStartAt(reg.StartDate)
 			re.SetEndAt(reg.StartDate.Add(time.Hour * 2))
 			re.AddProperty(ics.ComponentPropertyRelatedTo, e.Id())
 			re.SetTimeTransparency(ics.TransparencyTransparent)
 
-			a := re.AddAlarm()
-			a.SetDescription(fmt.Sprintf("Anmeldung: %s (%s)", tournament.Title, reg.Title))
-			a.SetAction(ics.ActionDisplay)
-			a.SetTrigger("-PT15M")
+			if profile.Alarms && !registered {
+				a := re.AddAlarm()
+				a.SetDescription(fmt.Sprintf("Anmeldung: %s (%s)", tournament.Title, reg.Title))
+				a.SetAction(ics.ActionDisplay)
+				a.SetTrigger("-PT15M")
+			}
+
+			if slices.Contains(source.tasks, tournament.Id) {
+				due := reg.EndDate
+				if !due.After(reg.StartDate) {
+					due = tournament.StartDate
+				}
+				todo := icsCal.AddTodo(fmt.Sprintf("todo-%d-%d@dg-cal", tournament.Id, i))
+				todo.SetDtStampTime(tournament.UpdatedAt)
+				todo.SetSequence(updateCount[tournament.Id])
+				todo.SetSummary("Anmelden: " + tournament.Title)
+				todo.SetDescription(profile.formatDescription(reg.Title, link))
+				todo.SetStartAt(reg.StartDate)
+				todo.SetDueAt(due)
+				if registered {
+					todo.SetStatus(ics.ObjectStatusCompleted)
+				} else {
+					todo.SetStatus(ics.ObjectStatusNeedsAction)
+				}
+				todo.AddProperty(ics.ComponentPropertyRelatedTo, e.Id())
+			}
+		}
+	}
+
+	return &icsCacheEntry{
+		calendar:    icsCal,
+		modifiedAt:  modifiedAt.UTC().Truncate(time.Second),
+		feeds:       map[string]*IcsFeed{},
+		tournaments: tournamentIds,
+		match:       source.match,
+	}, nil
+}
+
+// conflictWarnings turns conflicts into description lines by tournament id
+// and by registration phase.
+func conflictWarnings(conflicts []Conflict) (map[int][]string, map[*model.Registration][]string) {
+	tournaments := map[int][]string{}
+	registrations := map[*model.Registration][]string{}
+	for _, c := range conflicts {
+		switch c.Type {
+		case CONFLICT_OVERLAP:
+			tournaments[c.A.Id] = append(tournaments[c.A.Id], "⚠ Überschneidung mit "+c.B.Title)
+			tournaments[c.B.Id] = append(tournaments[c.B.Id], "⚠ Überschneidung mit "+c.A.Title)
+		case CONFLICT_TRAVEL:
+			tournaments[c.A.Id] = append(tournaments[c.A.Id], fmt.Sprintf("⚠ Am Folgetag %s, %d km entfernt", c.B.Title, c.Distance))
+			tournaments[c.B.Id] = append(tournaments[c.B.Id], fmt.Sprintf("⚠ Am Vortag %s, %d km entfernt", c.A.Title, c.Distance))
+		case CONFLICT_REGISTRATION:
+			registrations[c.RegistrationA] = append(registrations[c.RegistrationA], "⚠ Gleichzeitig Anmeldung: "+c.B.Title)
+			registrations[c.RegistrationB] = append(registrations[c.RegistrationB], "⚠ Gleichzeitig Anmeldung: "+c.A.Title)
 		}
 	}
-	if err := s.calendarService.SetCalendarRetrievedAt(calendar.Id); err != nil {
-		log.Printf("Error setting calender retieved at: %s", err.Error())
+	return tournaments, registrations
+}
+
+// withWarnings puts the warnings in front of text, one per line.
+func withWarnings(warnings []string, text string) string {
+	lines := slices.Clone(warnings)
+	if text != "" {
+		lines = append(lines, text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// invalidate drops every cached feed that contains a changed tournament or
+// would contain it now (or used to).
+func (s *IcsService) invalidate(changes []TournamentChange) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, entry := range s.cache {
+		for _, c := range changes {
+			if entry.affectedBy(c.Old) || entry.affectedBy(c.New) {
+				delete(s.cache, key)
+				break
+			}
+		}
+	}
+}
+
+// evict drops the cached feeds of all profiles of a calendar.
+func (s *IcsService) evict(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.cache {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.cache, key)
+		}
+	}
+}
+
+func (s *IcsService) evictLeastRecentlyUsed() {
+	oldest := ""
+	for key, entry := range s.cache {
+		if oldest == "" || entry.usedAt.Before(s.cache[oldest].usedAt) {
+			oldest = key
+		}
+	}
+	delete(s.cache, oldest)
+}
+
+func (e *icsCacheEntry) affectedBy(t *model.Tournament) bool {
+	if t == nil {
+		return false
 	}
-	return icsCal.Serialize(), nil
+	return slices.Contains(e.tournaments, t.Id) || e.match(t)
 }
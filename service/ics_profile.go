@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+const CLIENT_GOOGLE = "google"
+const CLIENT_APPLE = "apple"
+const CLIENT_OUTLOOK = "outlook"
+const CLIENT_THUNDERBIRD = "thunderbird"
+const CLIENT_OTHER = "other"
+
+// IcsProfile describes which iCalendar features are safe to emit for a client.
+type IcsProfile struct {
+	Name string
+	// Geo adds the GEO property. Outlook refuses to import events carrying it.
+	Geo bool
+	// MsAllDay marks all-day events with X-MICROSOFT-CDO-ALLDAYEVENT.
+	MsAllDay bool
+	// Alarms adds VALARM reminders to registration events.
+	Alarms bool
+	// HtmlDescription renders DESCRIPTION with HTML line breaks and links.
+	HtmlDescription bool
+	// Url adds the tournament page as URL property.
+	Url bool
+}
+
+// The default profile renders the same output the feed always had, which is
+// known to work in Outlook and is accepted by every other client.
+var IcsProfileDefault = IcsProfile{Name: "default", Geo: false, MsAllDay: true, Alarms: true}
+var IcsProfileOutlook = IcsProfile{Name: CLIENT_OUTLOOK, Geo: false, MsAllDay: true, Alarms: true}
+var IcsProfileGoogle = IcsProfile{Name: CLIENT_GOOGLE, Geo: true, MsAllDay: false, Alarms: false, HtmlDescription: true}
+var IcsProfileApple = IcsProfile{Name: CLIENT_APPLE, Geo: true, MsAllDay: false, Alarms: true, Url: true}
+
+var icsProfiles = map[string]IcsProfile{
+	IcsProfileDefault.Name: IcsProfileDefault,
+	IcsProfileOutlook.Name: IcsProfileOutlook,
+	IcsProfileGoogle.Name:  IcsProfileGoogle,
+	IcsProfileApple.Name:   IcsProfileApple,
+}
+
+// IcsProfileByName looks up a profile by the name used in the ?profile= parameter.
+func IcsProfileByName(name string) (IcsProfile, bool) {
+	p, ok := icsProfiles[strings.ToLower(name)]
+	return p, ok
+}
+
+// IcsProfileForUserAgent picks the profile matching the client sending the request.
+func IcsProfileForUserAgent(userAgent string) IcsProfile {
+	if p, ok := icsProfiles[ClientFromUserAgent(userAgent)]; ok {
+		return p
+	}
+	return IcsProfileDefault
+}
+
+// ClientFromUserAgent classifies the calendar client by its User-Agent header.
+func ClientFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	// Thunderbird sends "Macintosh; Intel Mac OS X" on macOS, check it first
+	case strings.Contains(ua, "thunderbird"), strings.Contains(ua, "lightning"):
+		return CLIENT_THUNDERBIRD
+	case strings.Contains(ua, "google"):
+		return CLIENT_GOOGLE
+	case strings.Contains(ua, "outlook"), strings.Contains(ua, "microsoft office"), strings.Contains(ua, "exchange"):
+		return CLIENT_OUTLOOK
+	case strings.Contains(ua, "dataaccessd"), strings.Contains(ua, "calendaragent"), strings.Contains(ua, "ical/"),
+		strings.Contains(ua, "ios/"), strings.Contains(ua, "macos/"), strings.Contains(ua, "mac os x/"):
+		return CLIENT_APPLE
+	}
+	return CLIENT_OTHER
+}
+
+func (p IcsProfile) formatDescription(text string, link string) string {
+	if !p.HtmlDescription {
+		if text == "" {
+			return link
+		}
+		return fmt.Sprintf("%s\n%s", text, link)
+	}
+
+	anchor := fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(link), html.EscapeString(link))
+	if text == "" {
+		return anchor
+	}
+	return fmt.Sprintf("%s<br>%s", strings.ReplaceAll(html.EscapeString(text), "\n", "<br>"), anchor)
+}
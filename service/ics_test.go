@@ -0,0 +1,823 @@
+package service
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCalendarRepo struct {
+	calendars     map[string]*model.Calendar
+	subscriptions map[string]map[int]*model.Subscription
+	notes         map[string]map[int]string
+	editIds       map[string]string
+	aliases       map[string]fakeAlias
+	editors       []*model.Editor
+	audit         []*model.AuditEntry
+	versions      []*model.CalendarVersion
+	retrievals    []*model.Retrieval
+	retrieved     int
+}
+
+type fakeAlias struct {
+	calendarId string
+	expiresAt  time.Time
+}
+
+func (r *fakeCalendarRepo) CreateCalendar(id, editId, title string, config model.SubscriptionConfig) error {
+	r.calendars[id] = &model.Calendar{Id: id, Title: title, Config: &config}
+	return nil
+}
+
+func (r *fakeCalendarRepo) UpdateCalendar(calendar *model.Calendar) error {
+	calendar.UpdatedAt = time.Now()
+	r.calendars[calendar.Id] = calendar
+	return nil
+}
+
+func (r *fakeCalendarRepo) GetCalendars() ([]*model.Calendar, error) {
+	result := []*model.Calendar{}
+	for _, c := range r.calendars {
+		if c.DeletedAt == nil {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeCalendarRepo) GetDeletedCalendars() ([]*model.Calendar, error) {
+	result := []*model.Calendar{}
+	for _, c := range r.calendars {
+		if c.DeletedAt != nil {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeCalendarRepo) GetCalendarById(id string) (*model.Calendar, error) {
+	if c := r.calendars[id]; c != nil && c.DeletedAt == nil {
+		return c, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeCalendarRepo) SetFlaggedAt(calendarId string, flaggedAt *time.Time) error {
+	r.calendars[calendarId].FlaggedAt = flaggedAt
+	return nil
+}
+
+func (r *fakeCalendarRepo) SoftDeleteCalendar(calendarId string, deletedAt time.Time) error {
+	r.calendars[calendarId].DeletedAt = &deletedAt
+	return nil
+}
+
+func (r *fakeCalendarRepo) TrashCalendar(calendarId string, deletedAt time.Time) error {
+	r.calendars[calendarId].DeletedAt = &deletedAt
+	r.calendars[calendarId].FlaggedAt = nil
+	return nil
+}
+
+func (r *fakeCalendarRepo) GetCalendarByEditId(editId string) (*model.Calendar, error) {
+	for id, e := range r.editIds {
+		if e == editId {
+			return r.calendars[id], nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeCalendarRepo) GetCalendarUpdateCount() (map[int]int, error) {
+	return map[int]int{}, nil
+}
+
+func (r *fakeCalendarRepo) SetCalendarRetrievedAt(calendarId string) error {
+	now := time.Now()
+	r.calendars[calendarId].RetrievedAt = &now
+	r.retrieved++
+	return nil
+}
+
+func (r *fakeCalendarRepo) PurgeCalendar(id string) error {
+	delete(r.calendars, id)
+	delete(r.subscriptions, id)
+	delete(r.notes, id)
+	return nil
+}
+
+func (r *fakeCalendarRepo) RestoreCalendar(calendarId string) error {
+	r.calendars[calendarId].DeletedAt = nil
+	r.calendars[calendarId].FlaggedAt = nil
+	return nil
+}
+
+func (r *fakeCalendarRepo) GetDeletedCalendar(id string) (*model.Calendar, error) {
+	if c := r.calendars[id]; c != nil && c.DeletedAt != nil {
+		return c, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeCalendarRepo) GetSubscriptions(calendar *model.Calendar) ([]*model.Subscription, error) {
+	result := []*model.Subscription{}
+	for _, s := range r.subscriptions[calendar.Id] {
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+func (r *fakeCalendarRepo) UpsertSubscription(subscription *model.Subscription) error {
+	if r.subscriptions == nil {
+		r.subscriptions = map[string]map[int]*model.Subscription{}
+	}
+	if r.subscriptions[subscription.Calendar.Id] == nil {
+		r.subscriptions[subscription.Calendar.Id] = map[int]*model.Subscription{}
+	}
+	r.subscriptions[subscription.Calendar.Id][subscription.Tournament.Id] = subscription
+	return nil
+}
+
+func (r *fakeCalendarRepo) DeleteSubscription(calendarId string, tournamentId int) error {
+	delete(r.subscriptions[calendarId], tournamentId)
+	return nil
+}
+
+func (r *fakeCalendarRepo) GetNotes(calendarId string) (map[int]string, error) {
+	result := map[int]string{}
+	for id, note := range r.notes[calendarId] {
+		result[id] = note
+	}
+	return result, nil
+}
+
+func (r *fakeCalendarRepo) UpsertNote(calendarId string, tournamentId int, note string) error {
+	if r.notes == nil {
+		r.notes = map[string]map[int]string{}
+	}
+	if r.notes[calendarId] == nil {
+		r.notes[calendarId] = map[int]string{}
+	}
+	r.notes[calendarId][tournamentId] = note
+	return nil
+}
+
+func (r *fakeCalendarRepo) DeleteNote(calendarId string, tournamentId int) error {
+	delete(r.notes[calendarId], tournamentId)
+	return nil
+}
+
+func (r *fakeCalendarRepo) SetEditId(calendarId string, editId string) error {
+	if r.editIds == nil {
+		r.editIds = map[string]string{}
+	}
+	r.editIds[calendarId] = editId
+	return nil
+}
+
+func (r *fakeCalendarRepo) RenameCalendar(oldId string, newId string, expiresAt time.Time) error {
+	c := r.calendars[oldId]
+	delete(r.calendars, oldId)
+	r.calendars[newId] = c
+	c.Id = newId
+
+	if s, ok := r.subscriptions[oldId]; ok {
+		delete(r.subscriptions, oldId)
+		r.subscriptions[newId] = s
+	}
+	if n, ok := r.notes[oldId]; ok {
+		delete(r.notes, oldId)
+		r.notes[newId] = n
+	}
+
+	if r.aliases == nil {
+		r.aliases = map[string]fakeAlias{}
+	}
+	for id, a := range r.aliases {
+		if a.calendarId == oldId {
+			r.aliases[id] = fakeAlias{newId, a.expiresAt}
+		}
+	}
+	r.aliases[oldId] = fakeAlias{newId, expiresAt}
+	return nil
+}
+
+func (r *fakeCalendarRepo) CreateEditor(editor *model.Editor) error {
+	editor.Id = len(r.editors) + 1
+	c := *editor
+	r.editors = append(r.editors, &c)
+	return nil
+}
+
+func (r *fakeCalendarRepo) GetEditors(calendarId string) ([]*model.Editor, error) {
+	result := []*model.Editor{}
+	for _, e := range r.editors {
+		if e != nil && e.CalendarId == calendarId {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeCalendarRepo) GetEditorBySecret(secret string) (*model.Editor, error) {
+	for _, e := range r.editors {
+		if e != nil && e.Secret == secret && e.AcceptedAt != nil {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeCalendarRepo) AcceptInvite(token string) (*model.Editor, error) {
+	for _, e := range r.editors {
+		if e != nil && e.InviteToken != "" && e.InviteToken == token {
+			now := time.Now()
+			e.InviteToken, e.AcceptedAt = "", &now
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeCalendarRepo) SetEditorSecret(editorId int, secret string) error {
+	r.editors[editorId-1].Secret = secret
+	return nil
+}
+
+func (r *fakeCalendarRepo) DeleteEditor(calendarId string, editorId int) error {
+	if e := r.editors[editorId-1]; e != nil && e.CalendarId == calendarId {
+		r.editors[editorId-1] = nil
+	}
+	return nil
+}
+
+func (r *fakeCalendarRepo) AddAuditEntry(entry *model.AuditEntry) error {
+	r.audit = append([]*model.AuditEntry{entry}, r.audit...)
+	return nil
+}
+
+func (r *fakeCalendarRepo) GetAuditEntries(calendarId string, limit int) ([]*model.AuditEntry, error) {
+	result := []*model.AuditEntry{}
+	for _, e := range r.audit {
+		if e.CalendarId == calendarId && len(result) < limit {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeCalendarRepo) AddVersion(version *model.CalendarVersion) error {
+	version.Id = len(r.versions) + 1
+	r.versions = append(r.versions, version)
+	return nil
+}
+
+func (r *fakeCalendarRepo) GetVersions(calendarId string, limit int) ([]*model.CalendarVersion, error) {
+	result := []*model.CalendarVersion{}
+	for i := len(r.versions) - 1; i >= 0; i-- {
+		if r.versions[i].CalendarId == calendarId && len(result) < limit {
+			result = append(result, r.versions[i])
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeCalendarRepo) GetVersion(calendarId string, versionId int) (*model.CalendarVersion, error) {
+	for _, v := range r.versions {
+		if v.CalendarId == calendarId && v.Id == versionId {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeCalendarRepo) AddRetrieval(calendarId string, client string, status int, at time.Time) error {
+	r.retrievals = append(r.retrievals, &model.Retrieval{CalendarId: calendarId, Client: client, Status: status, Count: 1, LastAt: at})
+	return nil
+}
+
+func (r *fakeCalendarRepo) GetRetrievals(calendarId string, since time.Time) ([]*model.Retrieval, error) {
+	result := []*model.Retrieval{}
+	for _, rt := range r.retrievals {
+		if rt.CalendarId == calendarId && !rt.LastAt.Before(since) {
+			result = append(result, rt)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeCalendarRepo) GetClientStats(since time.Time, errorStatus int) ([]*model.ClientStats, error) {
+	return []*model.ClientStats{}, nil
+}
+
+func (r *fakeCalendarRepo) DeleteRetrievals(before time.Time) error {
+	r.retrievals = slices.DeleteFunc(r.retrievals, func(rt *model.Retrieval) bool { return rt.LastAt.Before(before) })
+	return nil
+}
+
+func (r *fakeCalendarRepo) GetCalendarAlias(id string) (string, time.Time, error) {
+	a := r.aliases[id]
+	return a.calendarId, a.expiresAt, nil
+}
+
+type fakeTournamentRepo struct {
+	tournaments []model.Tournament
+}
+
+func (r *fakeTournamentRepo) UpsertTournament(tournament *model.Tournament) error { return nil }
+
+func (r *fakeTournamentRepo) GetAllTournaments() ([]model.Tournament, error) {
+	return r.tournaments, nil
+}
+
+func (r *fakeTournamentRepo) CreateTurnamentHistory(tournament *model.Tournament) error { return nil }
+
+func (r *fakeTournamentRepo) UpsertRegistration(tournamentId int, registration *model.Registration) error {
+	return nil
+}
+
+func (r *fakeTournamentRepo) GetTournamentHistory(id int) ([]*model.Tournament, error) {
+	return []*model.Tournament{}, nil
+}
+
+type fakeGtoService struct {
+	tournaments map[int]*model.Tournament
+}
+
+func (g *fakeGtoService) FetchEventDetails(eventID int) (*model.EventDetails, error) {
+	t := g.tournaments[eventID]
+	return &model.EventDetails{ID: t.Id, Title: t.Title, StartDate: t.StartDate, EndDate: t.EndDate, Series: t.Series,
+		Location: t.Localtion, GeoLocation: t.GeoLocation}, nil
+}
+
+func (g *fakeGtoService) FetchTournaments() (map[int]*model.Tournament, error) {
+	result := map[int]*model.Tournament{}
+	for id, t := range g.tournaments {
+		c := *t
+		result[id] = &c
+	}
+	return result, nil
+}
+
+func newTestIcsService(t *testing.T) *IcsService {
+	s, _ := newTestIcsServiceWithGto(t)
+	return s
+}
+
+func newTestIcsServiceWithGto(t *testing.T) (*IcsService, *fakeGtoService) {
+	start := time.Date(2025, 6, 14, 0, 0, 0, 0, time.UTC)
+	tournaments := []model.Tournament{{
+		Id:          42,
+		Status:      model.TOURNAMENT_STATUS_REGISTRATION,
+		UpdatedAt:   start.Add(-30 * 24 * time.Hour),
+		StartDate:   start,
+		EndDate:     start.Add(24 * time.Hour),
+		Title:       "Summer Open",
+		Localtion:   "Berlin",
+		GeoLocation: "52.52, 13.40",
+		Series:      []string{"Liga"},
+		Registrations: []*model.Registration{
+			{Title: "1. Phase", StartDate: start.Add(-20 * 24 * time.Hour), EndDate: start.Add(-10 * 24 * time.Hour)},
+		},
+	}}
+
+	gto := &fakeGtoService{tournaments: map[int]*model.Tournament{}}
+	for i := range tournaments {
+		t := tournaments[i]
+		gto.tournaments[t.Id] = &t
+	}
+
+	tournamentService, err := NewTournamentService(&fakeTournamentRepo{tournaments: tournaments}, gto)
+	require.NoError(t, err)
+
+	calendarRepo := &fakeCalendarRepo{calendars: map[string]*model.Calendar{
+		"cal": {Id: "cal", Title: "My calendar", Config: &model.SubscriptionConfig{Series: []string{"Liga"}}},
+	}}
+	return NewIcsService(NewCalendarService(calendarRepo), tournamentService), gto
+}
+
+func TestCreateIcsProfiles(t *testing.T) {
+	s := newTestIcsService(t)
+
+	tests := []struct {
+		profile  IcsProfile
+		geo      bool
+		msAllDay bool
+		alarms   bool
+		html     bool
+		url      bool
+	}{
+		{profile: IcsProfileDefault, geo: false, msAllDay: true, alarms: true},
+		{profile: IcsProfileOutlook, geo: false, msAllDay: true, alarms: true},
+		{profile: IcsProfileGoogle, geo: true, msAllDay: false, alarms: false, html: true},
+		{profile: IcsProfileApple, geo: true, msAllDay: false, alarms: true, url: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile.Name, func(t *testing.T) {
+			out, err := s.CreateIcs("cal", tt.profile, FEED_FORMAT_ICS)
+			require.NoError(t, err)
+
+			cal, err := ics.ParseCalendar(strings.NewReader(out.Content))
+			require.NoError(t, err)
+
+			var tournament, registration *ics.VEvent
+			for _, e := range cal.Events() {
+				switch e.Id() {
+				case "tournament-42@dg-cal":
+					tournament = e
+				case "registration-42-0@dg-cal":
+					registration = e
+				}
+			}
+			require.NotNil(t, tournament)
+			require.NotNil(t, registration)
+
+			// All-day events are always encoded as DATE values
+			start := tournament.GetProperty(ics.ComponentPropertyDtStart)
+			assert.Equal(t, []string{"DATE"}, start.ICalParameters["VALUE"])
+			assert.Equal(t, "20250614", start.Value)
+
+			assert.Equal(t, tt.geo, tournament.HasProperty(ics.ComponentPropertyGeo))
+			if tt.geo {
+				assert.Equal(t, "52.52;13.40", tournament.GetProperty(ics.ComponentPropertyGeo).Value)
+			}
+			assert.Equal(t, tt.msAllDay, tournament.HasProperty("X-MICROSOFT-CDO-ALLDAYEVENT"))
+			assert.Equal(t, tt.alarms, len(registration.Alarms()) > 0)
+			assert.Equal(t, tt.url, tournament.HasProperty(ics.ComponentPropertyUrl))
+
+			description := registration.GetProperty(ics.ComponentPropertyDescription).Value
+			assert.Equal(t, tt.html, strings.Contains(description, "<a href="))
+			assert.Contains(t, description, "1. Phase")
+		})
+	}
+}
+
+func TestIcsProfileForUserAgent(t *testing.T) {
+	tests := map[string]string{
+		"Google-Calendar-Importer": IcsProfileGoogle.Name,
+		"Microsoft Office/16.0 (Windows NT 10.0; Microsoft Outlook 16.0.17029)":                      IcsProfileOutlook.Name,
+		"iOS/17.4 (21E219) dataaccessd/1.0":                                                          IcsProfileApple.Name,
+		"macOS/14.4 (23E214) CalendarAgent/988":                                                      IcsProfileApple.Name,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:115.0) Gecko/20100101 Thunderbird/115.9.0": IcsProfileDefault.Name,
+		"": IcsProfileDefault.Name,
+	}
+
+	for ua, expected := range tests {
+		assert.Equal(t, expected, IcsProfileForUserAgent(ua).Name, ua)
+	}
+}
+
+func TestCreateIcsCache(t *testing.T) {
+	s, gto := newTestIcsServiceWithGto(t)
+
+	first, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.ETag)
+	assert.Equal(t, time.Date(2025, 5, 15, 0, 0, 0, 0, time.UTC), first.ModifiedAt)
+
+	second, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Same(t, first, second, "unchanged calendar is served from cache")
+
+	// Profiles are cached separately
+	google, err := s.CreateIcs("cal", IcsProfileGoogle, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ETag, google.ETag)
+
+	// A config change invalidates the feed
+	calendar, err := s.calendarService.GetCalendar(CalendarId("cal"))
+	require.NoError(t, err)
+	calendar.Title = "Renamed"
+	_, err = s.calendarService.UpdateCalendar(calendar)
+	require.NoError(t, err)
+
+	renamed, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ETag, renamed.ETag)
+	assert.Contains(t, renamed.Content, "Renamed")
+
+	// A sync changing an included tournament invalidates the feed
+	changed := *gto.tournaments[42]
+	changed.Title = "Summer Open 2025"
+	changed.UpdatedAt = changed.UpdatedAt.Add(time.Hour)
+	gto.tournaments[42] = &changed
+	require.NoError(t, s.tournamentService.Sync())
+	assert.Equal(t, 1, s.tournamentService.GetGeneration())
+
+	synced, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.NotEqual(t, renamed.ETag, synced.ETag)
+	assert.Contains(t, synced.Content, "Summer Open 2025")
+
+	// A sync without changes keeps the cache
+	require.NoError(t, s.tournamentService.Sync())
+	again, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Same(t, synced, again)
+}
+
+func TestCreateIcsCacheEviction(t *testing.T) {
+	s := newTestIcsService(t)
+	repo := s.calendarService.repo.(*fakeCalendarRepo)
+
+	_, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	_, err = s.CreateIcs("cal", IcsProfileGoogle, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Len(t, s.cache, 2)
+	assert.Equal(t, 1, repo.retrieved, "retrieval time is stored once per interval")
+
+	// Feeds of deleted calendars are dropped
+	require.NoError(t, s.calendarService.DeleteCalendar("cal"))
+	_, err = s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	assert.Equal(t, NotFoundError, err)
+	assert.Empty(t, s.cache)
+
+	// The cache is bounded, the least recently used feed is dropped first
+	for i := range ICS_CACHE_SIZE + 1 {
+		id := fmt.Sprintf("cal%d", i)
+		repo.calendars[id] = &model.Calendar{Id: id, Config: &model.SubscriptionConfig{Series: []string{"Liga"}}}
+		_, err := s.CreateIcs(id, IcsProfileDefault, FEED_FORMAT_ICS)
+		require.NoError(t, err)
+	}
+	assert.Len(t, s.cache, ICS_CACHE_SIZE)
+	assert.NotContains(t, s.cache, "calendar:cal0|"+IcsProfileDefault.Name)
+}
+
+func TestCreatePublicIcs(t *testing.T) {
+	s := newTestIcsService(t)
+
+	series, err := s.CreateSeriesIcs("Liga", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Contains(t, series.Content, "UID:tournament-42@dg-cal", "UIDs match personal calendars")
+	assert.Contains(t, series.Content, "NAME:Liga")
+
+	tournament, err := s.CreateTournamentIcs(42, IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Contains(t, tournament.Content, "UID:tournament-42@dg-cal")
+	assert.Contains(t, tournament.Content, "UID:registration-42-0@dg-cal")
+
+	_, err = s.CreateSeriesIcs("Unknown", IcsProfileDefault, FEED_FORMAT_ICS)
+	assert.Equal(t, NotFoundError, err)
+
+	_, err = s.CreateTournamentIcs(1, IcsProfileDefault, FEED_FORMAT_ICS)
+	assert.Equal(t, NotFoundError, err)
+}
+
+func TestCreateIcsInheritance(t *testing.T) {
+	s := newTestIcsService(t)
+	_, err := s.calendarService.UpdateCalendar(&model.Calendar{Id: "club", Title: "Club", Config: &model.SubscriptionConfig{}})
+	require.NoError(t, err)
+	_, err = s.calendarService.UpdateCalendar(&model.Calendar{Id: "member", Title: "Member", Config: &model.SubscriptionConfig{Inherit: []string{"club"}}})
+	require.NoError(t, err)
+
+	before, err := s.CreateIcs("member", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.NotContains(t, before.Content, "UID:tournament-42@dg-cal")
+
+	// The parent's change shows up in the child at the next fetch
+	club, err := s.calendarService.GetCalendar(CalendarId("club"))
+	require.NoError(t, err)
+	club.Config.Series = []string{"Liga"}
+	_, err = s.calendarService.UpdateCalendar(club)
+	require.NoError(t, err)
+
+	after, err := s.CreateIcs("member", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Contains(t, after.Content, "UID:tournament-42@dg-cal")
+
+	again, err := s.CreateIcs("member", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Same(t, after, again, "unchanged calendars are served from cache")
+
+	m, err := s.calendarService.GetMatcher("member", model.SubscriptionConfig{Inherit: []string{"club"}})
+	require.NoError(t, err)
+	assert.True(t, m.Inherited(s.tournamentService.GetTournament(42)))
+
+	// Local exclusions override inherited tournaments
+	m, err = s.calendarService.GetMatcher("member", model.SubscriptionConfig{Inherit: []string{"club"}, Exclude: []int{42}})
+	require.NoError(t, err)
+	assert.False(t, m.Match(s.tournamentService.GetTournament(42)))
+
+	// club -> member -> club
+	_, err = s.calendarService.GetMatcher("club", model.SubscriptionConfig{Inherit: []string{"member"}})
+	assert.ErrorIs(t, err, InheritanceCycleError)
+	_, err = s.calendarService.GetMatcher("member", model.SubscriptionConfig{Inherit: []string{"member"}})
+	assert.ErrorIs(t, err, InheritanceCycleError)
+}
+
+func TestCreateIcsTasks(t *testing.T) {
+	s := newTestIcsService(t)
+
+	calendar, err := s.calendarService.GetCalendar(CalendarId("cal"))
+	require.NoError(t, err)
+	calendar.Config.Tournaments = []int{42}
+	_, err = s.calendarService.UpdateCalendar(calendar)
+	require.NoError(t, err)
+
+	feed, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.NotContains(t, feed.Content, "BEGIN:VTODO", "tasks are opt-in")
+
+	calendar.Config.Tasks = true
+	_, err = s.calendarService.UpdateCalendar(calendar)
+	require.NoError(t, err)
+
+	feed, err = s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+
+	cal, err := ics.ParseCalendar(strings.NewReader(feed.Content))
+	require.NoError(t, err)
+	require.Len(t, cal.Todos(), 1)
+	assert.Len(t, cal.Events(), 2, "registration events are kept next to the task")
+
+	todo := cal.Todos()[0]
+	assert.Equal(t, "todo-42-0@dg-cal", todo.Id())
+	assert.Equal(t, "Anmelden: Summer Open", todo.GetProperty(ics.ComponentPropertySummary).Value)
+	assert.Equal(t, "20250525T000000Z", todo.GetProperty(ics.ComponentPropertyDtStart).Value)
+	assert.Equal(t, "20250604T000000Z", todo.GetProperty(ics.ComponentPropertyDue).Value)
+	assert.Equal(t, "tournament-42@dg-cal", todo.GetProperty(ics.ComponentPropertyRelatedTo).Value)
+}
+
+func TestCreateIcsAttendance(t *testing.T) {
+	s := newTestIcsService(t)
+
+	calendar, err := s.calendarService.GetCalendar(CalendarId("cal"))
+	require.NoError(t, err)
+	calendar.Config.Tournaments = []int{42}
+	calendar.Config.Tasks = true
+	_, err = s.calendarService.UpdateCalendar(calendar)
+	require.NoError(t, err)
+
+	feed, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Contains(t, feed.Content, "BEGIN:VALARM")
+
+	require.NoError(t, s.calendarService.SetAttendance(calendar, 42, model.SUBSCRIPTION_STATUS_REGISTERED))
+	feed, err = s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Contains(t, feed.Content, "UID:registration-42-0@dg-cal")
+	assert.NotContains(t, feed.Content, "BEGIN:VALARM", "no reminders once registered")
+	assert.Contains(t, feed.Content, "STATUS:COMPLETED")
+
+	require.NoError(t, s.calendarService.SetAttendance(calendar, 42, model.SUBSCRIPTION_STATUS_DECLINED))
+	feed, err = s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.NotContains(t, feed.Content, "BEGIN:VEVENT")
+	assert.NotContains(t, feed.Content, "BEGIN:VTODO")
+
+	require.NoError(t, s.calendarService.SetAttendance(calendar, 42, ""))
+	attendance, err := s.calendarService.GetAttendance(calendar)
+	require.NoError(t, err)
+	assert.Empty(t, attendance)
+	feed, err = s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.Contains(t, feed.Content, "BEGIN:VALARM")
+
+	assert.Error(t, s.calendarService.SetAttendance(calendar, 42, model.SUBSCRIPTION_STATUS_INVITED))
+}
+
+func TestCreateIcsConflicts(t *testing.T) {
+	s := newTestIcsService(t)
+	summer := s.tournamentService.GetTournament(42)
+	s.tournamentService.tournaments[43] = &model.Tournament{Id: 43, Title: "Liga Finale", Series: []string{"Liga"}, StartDate: summer.StartDate, EndDate: summer.StartDate}
+
+	feed, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.NotContains(t, feed.Content, "Überschneidung", "annotations are opt-in")
+
+	calendar, err := s.calendarService.GetCalendar(CalendarId("cal"))
+	require.NoError(t, err)
+	calendar.Config.AnnotateConflicts = true
+	_, err = s.calendarService.UpdateCalendar(calendar)
+	require.NoError(t, err)
+
+	feed, err = s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	cal, err := ics.ParseCalendar(strings.NewReader(feed.Content))
+	require.NoError(t, err)
+	for _, e := range cal.Events() {
+		switch e.Id() {
+		case "tournament-42@dg-cal":
+			assert.True(t, strings.HasPrefix(e.GetProperty(ics.ComponentPropertyDescription).Value, "⚠ Überschneidung mit Liga Finale\n"))
+		case "tournament-43@dg-cal":
+			assert.True(t, strings.HasPrefix(e.GetProperty(ics.ComponentPropertyDescription).Value, "⚠ Überschneidung mit Summer Open\n"))
+		}
+	}
+
+	require.NoError(t, s.calendarService.SetAttendance(calendar, 43, model.SUBSCRIPTION_STATUS_DECLINED))
+	feed, err = s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	assert.NotContains(t, feed.Content, "Überschneidung", "declined tournaments do not conflict")
+}
+
+func TestCreateIcsNotes(t *testing.T) {
+	s := newTestIcsService(t)
+
+	calendar, err := s.calendarService.GetCalendar(CalendarId("cal"))
+	require.NoError(t, err)
+	require.NoError(t, s.calendarService.SetNotes(calendar, map[int]string{42: "  Carpool with Jan,\r\nhotel booked\x00  "}))
+	_, err = s.calendarService.UpdateCalendar(calendar)
+	require.NoError(t, err)
+
+	notes, err := s.calendarService.GetNotes(calendar)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{42: "Carpool with Jan,\nhotel booked"}, notes)
+
+	feed, err := s.CreateIcs("cal", IcsProfileDefault, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	cal, err := ics.ParseCalendar(strings.NewReader(feed.Content))
+	require.NoError(t, err)
+	event := cal.Events()[0]
+	if event.Id() != "tournament-42@dg-cal" {
+		event = cal.Events()[1]
+	}
+	assert.Equal(t, "Carpool with Jan,\nhotel booked\nhttps://turniere.discgolf.de/index.php?p=events&sp=view&id=42", event.GetProperty(ics.ComponentPropertyDescription).Value)
+
+	err = s.calendarService.SetNotes(calendar, map[int]string{42: strings.Repeat("x", NOTE_MAX_LENGTH+1)})
+	assert.Error(t, err)
+
+	require.NoError(t, s.calendarService.SetNotes(calendar, map[int]string{42: ""}))
+	notes, err = s.calendarService.GetNotes(calendar)
+	require.NoError(t, err)
+	assert.Empty(t, notes)
+}
+
+func TestCreateIcsFormats(t *testing.T) {
+	s := newTestIcsService(t)
+
+	text, err := s.CreateIcs("cal", IcsProfileApple, FEED_FORMAT_ICS)
+	require.NoError(t, err)
+	cal, err := ics.ParseCalendar(strings.NewReader(text.Content))
+	require.NoError(t, err)
+	uids := []string{}
+	for _, e := range cal.Events() {
+		uids = append(uids, e.Id())
+	}
+
+	jcal, err := s.CreateIcs("cal", IcsProfileApple, FEED_FORMAT_JCAL)
+	require.NoError(t, err)
+	assert.NotEqual(t, text.ETag, jcal.ETag)
+	assert.Equal(t, text.ModifiedAt, jcal.ModifiedAt)
+
+	var root []any
+	require.NoError(t, json.Unmarshal([]byte(jcal.Content), &root))
+	require.Len(t, root, 3)
+	assert.Equal(t, "vcalendar", root[0])
+
+	jcalUids := []string{}
+	var tournament []any
+	for _, c := range root[2].([]any) {
+		component := c.([]any)
+		assert.Equal(t, "vevent", component[0])
+		for _, p := range component[1].([]any) {
+			property := p.([]any)
+			if property[0] == "uid" {
+				jcalUids = append(jcalUids, property[3].(string))
+				if property[3] == "tournament-42@dg-cal" {
+					tournament = component
+				}
+			}
+		}
+	}
+	assert.Equal(t, uids, jcalUids)
+	require.NotNil(t, tournament)
+	assert.Contains(t, tournament[1], []any{"dtstart", map[string]any{}, "date", "2025-06-14"})
+	assert.Contains(t, tournament[1], []any{"geo", map[string]any{}, "float", []any{52.52, 13.40}})
+	assert.Contains(t, tournament[1], []any{"sequence", map[string]any{}, "integer", float64(0)})
+	assert.Contains(t, tournament[1], []any{"dtstamp", map[string]any{}, "date-time", "2025-05-15T00:00:00Z"})
+
+	xcal, err := s.CreateIcs("cal", IcsProfileApple, FEED_FORMAT_XCAL)
+	require.NoError(t, err)
+
+	var doc struct {
+		XMLName xml.Name `xml:"urn:ietf:params:xml:ns:icalendar-2.0 icalendar"`
+		Events  []struct {
+			Uid     string `xml:"properties>uid>text"`
+			DtStart string `xml:"properties>dtstart>date"`
+			Lat     string `xml:"properties>geo>latitude"`
+			Alarms  []struct {
+				Trigger string `xml:"properties>trigger>duration"`
+			} `xml:"components>valarm"`
+		} `xml:"vcalendar>components>vevent"`
+	}
+	require.NoError(t, xml.Unmarshal([]byte(xcal.Content), &doc))
+
+	xcalUids := []string{}
+	for _, e := range doc.Events {
+		xcalUids = append(xcalUids, e.Uid)
+	}
+	assert.Equal(t, uids, xcalUids)
+	assert.Equal(t, "2025-06-14", doc.Events[0].DtStart)
+	assert.Equal(t, "52.52", doc.Events[0].Lat)
+	assert.Equal(t, "-PT15M", doc.Events[1].Alarms[0].Trigger)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+)
+
+// TournamentMatcher decides which tournaments belong to a calendar.
+type TournamentMatcher struct {
+	config   model.SubscriptionConfig
+	title    *regexp.Regexp
+	location *regexp.Regexp
+	parents  []*TournamentMatcher
+	// updatedAt is the latest change of an inherited calendar
+	updatedAt time.Time
+}
+
+// NewTournamentMatcher validates the rules of config and compiles its patterns.
+func NewTournamentMatcher(config model.SubscriptionConfig) (*TournamentMatcher, error) {
+	m := TournamentMatcher{config: config}
+	rules := config.Rules
+
+	if rules.From != nil && rules.To != nil && rules.To.Before(*rules.From) {
+		return nil, fmt.Errorf("date window ends before it starts")
+	}
+
+	if rules.Regex {
+		var err error
+		if rules.Title != "" {
+			if m.title, err = regexp.Compile("(?i)" + rules.Title); err != nil {
+				return nil, fmt.Errorf("invalid title pattern: %w", err)
+			}
+		}
+		if rules.Location != "" {
+			if m.location, err = regexp.Compile("(?i)" + rules.Location); err != nil {
+				return nil, fmt.Errorf("invalid location pattern: %w", err)
+			}
+		}
+	}
+	return &m, nil
+}
+
+// Match reports whether t is part of the calendar. Explicit tournaments always
+// match, exclusions win over series, rules and inherited calendars.
+func (m *TournamentMatcher) Match(t *model.Tournament) bool {
+	if t == nil {
+		return false
+	}
+	if slices.Contains(m.config.Tournaments, t.Id) {
+		return true
+	}
+	if slices.Contains(m.config.Exclude, t.Id) {
+		return false
+	}
+	return m.matchLocal(t) || m.matchParents(t)
+}
+
+// Inherited reports whether t is only part of the calendar because an
+// inherited calendar contains it.
+func (m *TournamentMatcher) Inherited(t *model.Tournament) bool {
+	return m.Match(t) && !slices.Contains(m.config.Tournaments, t.Id) && !m.matchLocal(t)
+}
+
+// UpdatedAt returns when an inherited calendar was last changed.
+func (m *TournamentMatcher) UpdatedAt() time.Time {
+	return m.updatedAt
+}
+
+func (m *TournamentMatcher) matchLocal(t *model.Tournament) bool {
+	if len(m.config.Series) > 0 {
+		if !slices.ContainsFunc(t.Series, func(s string) bool { return slices.Contains(m.config.Series, s) }) {
+			return false
+		}
+	} else if !m.HasRules() {
+		return false
+	}
+	return m.matchRules(t)
+}
+
+func (m *TournamentMatcher) matchParents(t *model.Tournament) bool {
+	for _, p := range m.parents {
+		if p.Match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRules reports whether the rules select tournaments on their own, without
+// a series.
+func (m *TournamentMatcher) HasRules() bool {
+	r := m.config.Rules
+	return len(r.PdgaTiers) > 0 || r.DRatingOnly || r.From != nil || r.To != nil ||
+		r.Title != "" || r.Location != "" || len(r.Status) > 0
+}
+
+func (m *TournamentMatcher) matchRules(t *model.Tournament) bool {
+	r := m.config.Rules
+
+	if len(r.PdgaTiers) > 0 && !slices.Contains(r.PdgaTiers, t.PdgaTier) {
+		return false
+	}
+	if r.DRatingOnly && !t.DRating {
+		return false
+	}
+	if len(r.Status) > 0 && !slices.Contains(r.Status, t.Status) {
+		return false
+	}
+
+	// The window is inclusive and matches tournaments overlapping it
+	if r.From != nil && dateOnly(t.EndDate).Before(dateOnly(*r.From)) {
+		return false
+	}
+	if r.To != nil && dateOnly(t.StartDate).After(dateOnly(*r.To)) {
+		return false
+	}
+
+	return m.matchText(m.title, r.Title, t.Title) && m.matchText(m.location, r.Location, t.Localtion)
+}
+
+func (m *TournamentMatcher) matchText(re *regexp.Regexp, pattern string, text string) bool {
+	if pattern == "" {
+		return true
+	}
+	if re != nil {
+		return re.MatchString(text)
+	}
+	return strings.Contains(strings.ToLower(text), strings.ToLower(pattern))
+}
+
+// dateOnly drops the time of day so dates compare equal regardless of the
+// location they were parsed in.
+func dateOnly(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTournamentMatcher(t *testing.T) {
+	date := func(s string) *time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		require.NoError(t, err)
+		return &d
+	}
+
+	tournament := &model.Tournament{
+		Id:        7,
+		Status:    model.TOURNAMENT_STATUS_ANNOUNCED,
+		StartDate: *date("2025-06-14"),
+		EndDate:   *date("2025-06-15"),
+		Title:     "Summer Open 2025",
+		Localtion: "Berlin",
+		Series:    []string{"Liga"},
+		PdgaTier:  "B",
+		DRating:   true,
+	}
+
+	tests := []struct {
+		name   string
+		config model.SubscriptionConfig
+		match  bool
+	}{
+		{"empty config", model.SubscriptionConfig{}, false},
+		{"series", model.SubscriptionConfig{Series: []string{"Liga"}}, true},
+		{"other series", model.SubscriptionConfig{Series: []string{"Cup"}}, false},
+		{"explicit", model.SubscriptionConfig{Tournaments: []int{7}}, true},
+		{"explicit wins over exclusion", model.SubscriptionConfig{Tournaments: []int{7}, Exclude: []int{7}}, true},
+		{"exclusion wins over series", model.SubscriptionConfig{Series: []string{"Liga"}, Exclude: []int{7}}, false},
+		{"tier", model.SubscriptionConfig{Rules: model.SubscriptionRules{PdgaTiers: []string{"A", "B"}}}, true},
+		{"other tier", model.SubscriptionConfig{Rules: model.SubscriptionRules{PdgaTiers: []string{"A"}}}, false},
+		{"rules narrow series", model.SubscriptionConfig{Series: []string{"Liga"}, Rules: model.SubscriptionRules{PdgaTiers: []string{"C"}}}, false},
+		{"d-rating", model.SubscriptionConfig{Rules: model.SubscriptionRules{DRatingOnly: true}}, true},
+		{"status", model.SubscriptionConfig{Rules: model.SubscriptionRules{Status: []string{model.TOURNAMENT_STATUS_ANNOUNCED}}}, true},
+		{"other status", model.SubscriptionConfig{Rules: model.SubscriptionRules{Status: []string{model.TOURNAMENT_STATUS_DONE}}}, false},
+		{"window overlaps end", model.SubscriptionConfig{Rules: model.SubscriptionRules{From: date("2025-06-15")}}, true},
+		{"window after", model.SubscriptionConfig{Rules: model.SubscriptionRules{From: date("2025-06-16")}}, false},
+		{"window overlaps start", model.SubscriptionConfig{Rules: model.SubscriptionRules{To: date("2025-06-14")}}, true},
+		{"window before", model.SubscriptionConfig{Rules: model.SubscriptionRules{From: date("2025-06-01"), To: date("2025-06-13")}}, false},
+		{"title substring", model.SubscriptionConfig{Rules: model.SubscriptionRules{Title: "summer"}}, true},
+		{"title substring is literal", model.SubscriptionConfig{Rules: model.SubscriptionRules{Title: "summer.*2025"}}, false},
+		{"title regex", model.SubscriptionConfig{Rules: model.SubscriptionRules{Title: "summer.*2025", Regex: true}}, true},
+		{"location regex", model.SubscriptionConfig{Rules: model.SubscriptionRules{Location: "^(hamburg|münchen)$", Regex: true}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewTournamentMatcher(tt.config)
+			require.NoError(t, err)
+			assert.Equal(t, tt.match, m.Match(tournament))
+		})
+	}
+}
+
+func TestTournamentMatcherInvalid(t *testing.T) {
+	_, err := NewTournamentMatcher(model.SubscriptionConfig{Rules: model.SubscriptionRules{Title: "(", Regex: true}})
+	assert.Error(t, err)
+
+	from := time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	_, err = NewTournamentMatcher(model.SubscriptionConfig{Rules: model.SubscriptionRules{From: &from, To: &to}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,443 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	dgmail "github.com/resterle/dg-cal/v2/mail"
+	"github.com/resterle/dg-cal/v2/model"
+)
+
+// MAIL_MAX_ATTEMPTS is the number of times a message is tried before it is given up.
+const MAIL_MAX_ATTEMPTS = 8
+
+// REGISTRATION_REMINDER is how long before a registration phase opens its reminder is sent.
+const REGISTRATION_REMINDER = 24 * time.Hour
+
+// EMAIL_REQUEST_INTERVAL is the minimum time between two confirmation mails
+// to the same address or for the same calendar.
+const EMAIL_REQUEST_INTERVAL = 15 * time.Minute
+
+// EMAIL_TOKEN_VALIDITY is how long the link of a confirmation mail works.
+const EMAIL_TOKEN_VALIDITY = 24 * time.Hour
+
+// RECOVERY_INTERVAL is the minimum time between two recovery mails to the same address.
+const RECOVERY_INTERVAL = 15 * time.Minute
+
+// RECOVERY_TOKEN_VALIDITY is how long the link of a recovery mail that
+// renews the edit codes can be used.
+const RECOVERY_TOKEN_VALIDITY = 24 * time.Hour
+
+var InvalidEmailError = errors.New("invalid email address")
+var TooManyEmailRequestsError = errors.New("too many email requests, try again later")
+
+type NotificationRepo interface {
+	SetPendingEmail(calendarId string, email string, token string, expiresAt time.Time) error
+	ConfirmEmail(token string, unsubscribeToken string, now time.Time) (*model.Calendar, error)
+	GetUnsubscribeToken(calendarId string) (string, error)
+	ClearEmail(calendarId string) error
+	Unsubscribe(unsubscribeToken string) (bool, error)
+	EnqueueMail(msg *model.OutboxMessage) error
+	GetDueMails(now time.Time, maxAttempts int) ([]*model.OutboxMessage, error)
+	MarkMailSent(id int, sentAt time.Time) error
+	MarkMailFailed(id int, nextAttemptAt time.Time, lastError string) error
+	GetEditIdsByEmail(email string) (map[string]string, error)
+	SetRecoveryToken(email string, token string, expiresAt time.Time) error
+	RedeemRecoveryToken(token string, now time.Time) ([]string, error)
+}
+
+// NotificationService mails calendar owners about changes of their
+// tournaments. Messages go through a persistent outbox and are delivered by
+// DeliverMail.
+type NotificationService struct {
+	repo              NotificationRepo
+	calendarService   *CalendarService
+	tournamentService *TournamentService
+	sender            dgmail.Sender
+	baseUrl           string
+	mu                sync.Mutex
+	emailRequests     *throttle
+	recoveries        *throttle
+}
+
+func NewNotificationService(repo NotificationRepo, calendarService *CalendarService, tournamentService *TournamentService, sender dgmail.Sender, baseUrl string) *NotificationService {
+	s := &NotificationService{
+		repo:              repo,
+		calendarService:   calendarService,
+		tournamentService: tournamentService,
+		sender:            sender,
+		baseUrl:           strings.TrimSuffix(baseUrl, "/"),
+		emailRequests:     newThrottle(EMAIL_REQUEST_INTERVAL),
+		recoveries:        newThrottle(RECOVERY_INTERVAL),
+	}
+	tournamentService.AddChangeListener(s.notifyChanges)
+	return s
+}
+
+// RequestEmail sends a confirmation link to email. The address is only used
+// for notifications once the link was opened. An empty email removes the
+// address of the calendar. Confirmation mails are sent at most once per
+// EMAIL_REQUEST_INTERVAL for an address and for a calendar.
+func (s *NotificationService) RequestEmail(calendar *model.Calendar, email string, now time.Time) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return s.repo.ClearEmail(calendar.Id)
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" {
+		return InvalidEmailError
+	}
+
+	if !s.emailRequests.allow(now, "calendar:"+calendar.Id, "address:"+strings.ToLower(address.Address)) {
+		return TooManyEmailRequestsError
+	}
+
+	token := generateSecret()
+	if err := s.repo.SetPendingEmail(calendar.Id, address.Address, token, now.Add(EMAIL_TOKEN_VALIDITY)); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hallo,\n\n"+
+		"für den Kalender \"%s\" wurden Benachrichtigungen an diese Adresse angefordert.\n"+
+		"Bitte bestätige die Adresse bis zum %s über folgenden Link:\n\n%s/calendar/email/confirm/%s\n\n"+
+		"Wenn du das nicht warst, kannst du diese E-Mail ignorieren.\n",
+		calendar.Title, formatMailTime(now.Add(EMAIL_TOKEN_VALIDITY)), s.baseUrl, token)
+
+	return s.repo.EnqueueMail(&model.OutboxMessage{
+		To:      address.Address,
+		Subject: fmt.Sprintf("Benachrichtigungen für %s bestätigen", calendar.Title),
+		Body:    body,
+	})
+}
+
+// ConfirmEmail activates the address waiting for token and returns its
+// calendar, or nil if the token is unknown or expired.
+func (s *NotificationService) ConfirmEmail(token string, now time.Time) (*model.Calendar, error) {
+	return s.repo.ConfirmEmail(token, generateSecret(), now)
+}
+
+// Unsubscribe removes the address of the calendar with the unsubscribe token
+// and reports whether there was one.
+func (s *NotificationService) Unsubscribe(token string) (bool, error) {
+	return s.repo.Unsubscribe(token)
+}
+
+// RecoverEditLinks mails the edit links of all calendars with the confirmed
+// address email, along with a one-time link to renew their edit codes.
+// Requests for the same address are answered at most once per
+// RECOVERY_INTERVAL, and no error tells whether any calendar uses the
+// address.
+func (s *NotificationService) RecoverEditLinks(email string, now time.Time) error {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return InvalidEmailError
+	}
+
+	if !s.recoveries.allow(now, strings.ToLower(address.Address)) {
+		log.Printf("Skipping recovery for %s, requested too often", address.Address)
+		return nil
+	}
+
+	editIds, err := s.repo.GetEditIdsByEmail(address.Address)
+	if err != nil || len(editIds) == 0 {
+		return err
+	}
+
+	token := generateSecret()
+	if err := s.repo.SetRecoveryToken(address.Address, token, now.Add(RECOVERY_TOKEN_VALIDITY)); err != nil {
+		return err
+	}
+
+	links, err := s.editLinks(editIds)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Hallo,\n\nhier sind die Links zum Bearbeiten deiner Kalender:\n\n%s\n\n"+
+		"Falls jemand anderes diese Links kennen könnte, kannst du bis zum %s neue Zugangscodes erzeugen. "+
+		"Die alten Codes funktionieren danach nicht mehr:\n%s/calendar/recover/%s\n\n"+
+		"Wenn du das nicht angefordert hast, kannst du diese E-Mail ignorieren.\n",
+		links, formatMailTime(now.Add(RECOVERY_TOKEN_VALIDITY)), s.baseUrl, token)
+
+	return s.repo.EnqueueMail(&model.OutboxMessage{To: address.Address, Subject: "Deine Kalender", Body: body})
+}
+
+// RenewEditCodes gives the calendars of a recovery mail new edit codes and
+// mails their new edit links. It reports false if token is unknown, expired
+// or was used already.
+func (s *NotificationService) RenewEditCodes(token string, now time.Time) (bool, error) {
+	ids, err := s.repo.RedeemRecoveryToken(token, now)
+	if err != nil || len(ids) == 0 {
+		return false, err
+	}
+
+	email := ""
+	editIds := map[string]string{}
+	for _, id := range ids {
+		calendar, err := s.calendarService.GetCalendar(CalendarId(id))
+		if err != nil {
+			return false, err
+		}
+		if calendar == nil {
+			continue
+		}
+		if editIds[id], err = s.calendarService.RotateEditId(calendar); err != nil {
+			return false, err
+		}
+		email = calendar.Email
+	}
+
+	if len(editIds) == 0 {
+		return false, nil
+	}
+
+	links, err := s.editLinks(editIds)
+	if err != nil {
+		return false, err
+	}
+	body := "Hallo,\n\ndie Zugangscodes deiner Kalender wurden erneuert, die alten Codes funktionieren nicht mehr. " +
+		"Hier sind die neuen Links zum Bearbeiten:\n\n" + links + "\n"
+	return true, s.repo.EnqueueMail(&model.OutboxMessage{To: email, Subject: "Neue Zugangscodes für deine Kalender", Body: body})
+}
+
+// editLinks lists the titles and edit links of the calendars by their edit
+// ids.
+func (s *NotificationService) editLinks(editIds map[string]string) (string, error) {
+	lines := []string{}
+	for id, editId := range editIds {
+		calendar, err := s.calendarService.GetCalendar(CalendarId(id))
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("%s\n%s/calendar/edit/%s", calendar.Title, s.baseUrl, editId))
+	}
+	slices.Sort(lines)
+	return strings.Join(lines, "\n\n"), nil
+}
+
+// WarnDeletion tells the owner of a flagged calendar that it is deleted at
+// deleteAt unless it is used again. Calendars without an address are skipped.
+func (s *NotificationService) WarnDeletion(calendar *model.Calendar, deleteAt time.Time) error {
+	if calendar.Email == "" || calendar.FlaggedAt == nil {
+		return nil
+	}
+
+	body := fmt.Sprintf("Hallo,\n\ndein Kalender \"%s\" wird seit längerer Zeit nicht mehr abgerufen und wird am %s gelöscht.\n\n"+
+		"Um das zu verhindern, abonniere ihn in einer Kalender-App oder speichere ihn einmal:\n%s/calendar/edit\n",
+		calendar.Title, formatMailDates(deleteAt, deleteAt), s.baseUrl)
+	return s.enqueue(calendar, fmt.Sprintf("Kalender wird gelöscht: %s", calendar.Title), body,
+		fmt.Sprintf("retention:%s:%d", calendar.Id, calendar.FlaggedAt.Unix()))
+}
+
+// NotifyRegistrations queues a reminder for every registration phase opening
+// within REGISTRATION_REMINDER of now. Reminders are sent once per phase and
+// calendar, and not for tournaments the owner declined or registered for.
+func (s *NotificationService) NotifyRegistrations(now time.Time) error {
+	return s.forEachSubscriber(func(calendar *model.Calendar, matcher *TournamentMatcher, attendance map[int]string) error {
+		for _, t := range s.tournamentService.GetMatchingTournaments(matcher) {
+			if attendance[t.Id] != "" && attendance[t.Id] != model.SUBSCRIPTION_STATUS_PLANNED {
+				continue
+			}
+			if t.Status == model.TOURNAMENT_STATUS_CANCELLED {
+				continue
+			}
+
+			for _, reg := range t.Registrations {
+				if !reg.StartDate.After(now) || reg.StartDate.After(now.Add(REGISTRATION_REMINDER)) {
+					continue
+				}
+
+				body := fmt.Sprintf("Die Anmeldung \"%s\" für %s öffnet am %s.\n\n%s\n",
+					reg.Title, t.Title, formatMailTime(reg.StartDate), tournamentLink(t.Id))
+				err := s.enqueue(calendar, fmt.Sprintf("Anmeldung öffnet: %s", t.Title), body,
+					fmt.Sprintf("registration:%s:%d:%d", calendar.Id, t.Id, reg.StartDate.Unix()))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// DeliverMail sends the due messages of the outbox. Failed messages are
+// retried with exponential backoff until MAIL_MAX_ATTEMPTS is reached.
+func (s *NotificationService) DeliverMail(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages, err := s.repo.GetDueMails(now, MAIL_MAX_ATTEMPTS)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		err := s.sender.Send(dgmail.Message{To: m.To, Subject: m.Subject, Body: m.Body})
+		if err == nil {
+			err = s.repo.MarkMailSent(m.Id, now)
+		} else {
+			log.Printf("Sending mail %d to %s failed (attempt %d): %s", m.Id, m.To, m.Attempts+1, err.Error())
+			err = s.repo.MarkMailFailed(m.Id, now.Add(time.Minute<<m.Attempts), err.Error())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyChanges queues one mail per calendar listing the tournaments whose
+// date or location changed or which were cancelled.
+func (s *NotificationService) notifyChanges(changes []TournamentChange) {
+	relevant := []TournamentChange{}
+	for _, c := range changes {
+		if describeChange(c) != "" {
+			relevant = append(relevant, c)
+		}
+	}
+	if len(relevant) == 0 {
+		return
+	}
+
+	err := s.forEachSubscriber(func(calendar *model.Calendar, matcher *TournamentMatcher, attendance map[int]string) error {
+		lines := []string{}
+		for _, c := range relevant {
+			if !matcher.Match(c.Old) && !matcher.Match(c.New) {
+				continue
+			}
+			if attendance[c.New.Id] == model.SUBSCRIPTION_STATUS_DECLINED {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s\n%s", c.New.Title, describeChange(c), tournamentLink(c.New.Id)))
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+
+		body := fmt.Sprintf("In deinem Kalender \"%s\" haben sich Turniere geändert:\n\n%s\n",
+			calendar.Title, strings.Join(lines, "\n\n"))
+		return s.enqueue(calendar, fmt.Sprintf("Änderungen in %s", calendar.Title), body, "")
+	})
+	if err != nil {
+		log.Printf("Could not queue change notifications: %s", err.Error())
+	}
+}
+
+func (s *NotificationService) forEachSubscriber(f func(calendar *model.Calendar, matcher *TournamentMatcher, attendance map[int]string) error) error {
+	calendars, err := s.calendarService.GetAllCalendars()
+	if err != nil {
+		return err
+	}
+
+	for _, calendar := range calendars {
+		if calendar.Email == "" || calendar.Config == nil {
+			continue
+		}
+
+		matcher, err := s.calendarService.GetMatcher(calendar.Id, *calendar.Config)
+		if err != nil {
+			log.Printf("Skipping notifications for calendar %s: %s", calendar.Id, err.Error())
+			continue
+		}
+		attendance, err := s.calendarService.GetAttendance(calendar)
+		if err != nil {
+			return err
+		}
+
+		if err := f(calendar, matcher, attendance); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *NotificationService) enqueue(calendar *model.Calendar, subject string, body string, dedupeKey string) error {
+	token, err := s.repo.GetUnsubscribeToken(calendar.Id)
+	if err != nil {
+		return err
+	}
+
+	body += fmt.Sprintf("\n-- \nKeine Benachrichtigungen mehr erhalten: %s/calendar/email/unsubscribe/%s\n", s.baseUrl, token)
+	return s.repo.EnqueueMail(&model.OutboxMessage{To: calendar.Email, Subject: subject, Body: body, DedupeKey: dedupeKey})
+}
+
+// describeChange summarizes the changes owners are notified about, it is
+// empty for other changes and new tournaments.
+func describeChange(c TournamentChange) string {
+	if c.Old == nil || c.New == nil {
+		return ""
+	}
+
+	parts := []string{}
+	if c.New.Status == model.TOURNAMENT_STATUS_CANCELLED && c.Old.Status != model.TOURNAMENT_STATUS_CANCELLED {
+		parts = append(parts, "abgesagt")
+	}
+	if !dateOnly(c.Old.StartDate).Equal(dateOnly(c.New.StartDate)) || !dateOnly(c.Old.EndDate).Equal(dateOnly(c.New.EndDate)) {
+		parts = append(parts, fmt.Sprintf("Datum geändert von %s auf %s",
+			formatMailDates(c.Old.StartDate, c.Old.EndDate), formatMailDates(c.New.StartDate, c.New.EndDate)))
+	}
+	if c.Old.Localtion != c.New.Localtion {
+		parts = append(parts, fmt.Sprintf("Ort geändert von %s auf %s", c.Old.Localtion, c.New.Localtion))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func tournamentLink(id int) string {
+	return fmt.Sprintf("https://turniere.discgolf.de/index.php?p=events&sp=view&id=%d", id)
+}
+
+var mailLocation, _ = time.LoadLocation("Europe/Berlin")
+
+func formatMailTime(t time.Time) string {
+	if mailLocation != nil {
+		t = t.In(mailLocation)
+	}
+	return t.Format("02.01.2006 15:04 Uhr")
+}
+
+func formatMailDates(start time.Time, end time.Time) string {
+	if dateOnly(start).Equal(dateOnly(end)) {
+		return start.Format("02.01.2006")
+	}
+	return fmt.Sprintf("%s–%s", start.Format("02.01."), end.Format("02.01.2006"))
+}
+
+// throttle remembers when keys were last used to limit how often mails are
+// sent for them.
+type throttle struct {
+	interval time.Duration
+	usedAt   map[string]time.Time
+	mu       sync.Mutex
+}
+
+func newThrottle(interval time.Duration) *throttle {
+	return &throttle{interval: interval, usedAt: map[string]time.Time{}}
+}
+
+// allow reports whether none of keys was used within the interval before now
+// and marks all of them as used if so.
+func (t *throttle) allow(now time.Time, keys ...string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, usedAt := range t.usedAt {
+		if now.Sub(usedAt) >= t.interval {
+			delete(t.usedAt, key)
+		}
+	}
+	for _, key := range keys {
+		if _, ok := t.usedAt[key]; ok {
+			return false
+		}
+	}
+	for _, key := range keys {
+		t.usedAt[key] = now
+	}
+	return true
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/mail"
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotificationRepo struct {
+	calendars map[string]*model.Calendar
+	tokens    map[string]string
+	expiresAt map[string]time.Time
+	outbox    []*model.OutboxMessage
+	editIds   map[string]string
+	// recoveryExpiresAt is when the recovery tokens expire
+	recoveryExpiresAt time.Time
+}
+
+func (r *fakeNotificationRepo) SetPendingEmail(calendarId string, email string, token string, expiresAt time.Time) error {
+	r.calendars[calendarId].PendingEmail = email
+	r.tokens["confirm:"+token] = calendarId
+	r.expiresAt["confirm:"+token] = expiresAt
+	return nil
+}
+
+func (r *fakeNotificationRepo) ConfirmEmail(token string, unsubscribeToken string, now time.Time) (*model.Calendar, error) {
+	id, ok := r.tokens["confirm:"+token]
+	if !ok || r.expiresAt["confirm:"+token].Before(now) {
+		return nil, nil
+	}
+	delete(r.tokens, "confirm:"+token)
+	c := r.calendars[id]
+	c.Email, c.PendingEmail = c.PendingEmail, ""
+	r.tokens["unsubscribe:"+unsubscribeToken] = id
+	return c, nil
+}
+
+func (r *fakeNotificationRepo) GetUnsubscribeToken(calendarId string) (string, error) {
+	for k, id := range r.tokens {
+		if id == calendarId && k[:12] == "unsubscribe:" {
+			return k[12:], nil
+		}
+	}
+	return "", nil
+}
+
+func (r *fakeNotificationRepo) ClearEmail(calendarId string) error {
+	r.calendars[calendarId].Email = ""
+	r.calendars[calendarId].PendingEmail = ""
+	return nil
+}
+
+func (r *fakeNotificationRepo) Unsubscribe(unsubscribeToken string) (bool, error) {
+	id, ok := r.tokens["unsubscribe:"+unsubscribeToken]
+	if !ok {
+		return false, nil
+	}
+	delete(r.tokens, "unsubscribe:"+unsubscribeToken)
+	return true, r.ClearEmail(id)
+}
+
+func (r *fakeNotificationRepo) EnqueueMail(msg *model.OutboxMessage) error {
+	for _, m := range r.outbox {
+		if msg.DedupeKey != "" && m.DedupeKey == msg.DedupeKey {
+			return nil
+		}
+	}
+	c := *msg
+	c.Id = len(r.outbox) + 1
+	r.outbox = append(r.outbox, &c)
+	return nil
+}
+
+func (r *fakeNotificationRepo) GetDueMails(now time.Time, maxAttempts int) ([]*model.OutboxMessage, error) {
+	result := []*model.OutboxMessage{}
+	for _, m := range r.outbox {
+		if m.SentAt == nil && m.Attempts < maxAttempts && !m.NextAttemptAt.After(now) {
+			c := *m
+			result = append(result, &c)
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeNotificationRepo) MarkMailSent(id int, sentAt time.Time) error {
+	r.outbox[id-1].SentAt = &sentAt
+	r.outbox[id-1].Attempts++
+	return nil
+}
+
+func (r *fakeNotificationRepo) MarkMailFailed(id int, nextAttemptAt time.Time, lastError string) error {
+	r.outbox[id-1].Attempts++
+	r.outbox[id-1].NextAttemptAt = nextAttemptAt
+	r.outbox[id-1].LastError = lastError
+	return nil
+}
+
+func (r *fakeNotificationRepo) GetEditIdsByEmail(email string) (map[string]string, error) {
+	result := map[string]string{}
+	for id, c := range r.calendars {
+		if c.Email != "" && strings.EqualFold(c.Email, email) {
+			result[id] = r.editIds[id]
+		}
+	}
+	return result, nil
+}
+
+func (r *fakeNotificationRepo) SetRecoveryToken(email string, token string, expiresAt time.Time) error {
+	for id, c := range r.calendars {
+		if c.Email != "" && strings.EqualFold(c.Email, email) {
+			r.tokens["recovery:"+token] = id
+		}
+	}
+	r.recoveryExpiresAt = expiresAt
+	return nil
+}
+
+func (r *fakeNotificationRepo) RedeemRecoveryToken(token string, now time.Time) ([]string, error) {
+	ids := []string{}
+	if now.After(r.recoveryExpiresAt) {
+		return ids, nil
+	}
+	if id, ok := r.tokens["recovery:"+token]; ok {
+		delete(r.tokens, "recovery:"+token)
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+type fakeSender struct {
+	sent []mail.Message
+	err  error
+}
+
+func (s *fakeSender) Send(msg mail.Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+func newTestNotificationService(t *testing.T) (*NotificationService, *fakeNotificationRepo, *fakeSender, *fakeGtoService) {
+	ics, gto := newTestIcsServiceWithGto(t)
+	repo := &fakeNotificationRepo{tokens: map[string]string{}, expiresAt: map[string]time.Time{}, editIds: map[string]string{"cal": "secret"}}
+	repo.calendars = ics.calendarService.repo.(*fakeCalendarRepo).calendars
+	sender := &fakeSender{}
+	return NewNotificationService(repo, ics.calendarService, ics.tournamentService, sender, "https://example.com/"), repo, sender, gto
+}
+
+func TestNotificationEmailConfirmation(t *testing.T) {
+	s, repo, _, _ := newTestNotificationService(t)
+	calendar := repo.calendars["cal"]
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.ErrorIs(t, s.RequestEmail(calendar, "not an address", now), InvalidEmailError)
+	assert.ErrorIs(t, s.RequestEmail(calendar, "Max <max@example.com>", now), InvalidEmailError)
+
+	require.NoError(t, s.RequestEmail(calendar, " max@example.com ", now))
+	assert.Equal(t, "max@example.com", calendar.PendingEmail)
+	assert.Empty(t, calendar.Email, "the address is only used once confirmed")
+	require.Len(t, repo.outbox, 1)
+	assert.Equal(t, "max@example.com", repo.outbox[0].To)
+	assert.Contains(t, repo.outbox[0].Body, "https://example.com/calendar/email/confirm/")
+
+	c, err := s.ConfirmEmail("unknown", now)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+
+	var token string
+	for k := range repo.tokens {
+		token = k[len("confirm:"):]
+	}
+	c, err = s.ConfirmEmail(token, now.Add(EMAIL_TOKEN_VALIDITY+time.Second))
+	require.NoError(t, err)
+	assert.Nil(t, c, "expired tokens are rejected")
+
+	c, err = s.ConfirmEmail(token, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, "max@example.com", calendar.Email)
+
+	unsubscribeToken, _ := repo.GetUnsubscribeToken("cal")
+	ok, err := s.Unsubscribe(unsubscribeToken)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, calendar.Email)
+
+	ok, err = s.Unsubscribe(unsubscribeToken)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestNotificationEmailThrottle(t *testing.T) {
+	s, repo, _, _ := newTestNotificationService(t)
+	calendar := repo.calendars["cal"]
+	repo.calendars["other"] = &model.Calendar{Id: "other", Title: "Other"}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, s.RequestEmail(calendar, "max@example.com", now))
+	// Per calendar and per address
+	assert.ErrorIs(t, s.RequestEmail(calendar, "erika@example.com", now.Add(time.Minute)), TooManyEmailRequestsError)
+	assert.ErrorIs(t, s.RequestEmail(repo.calendars["other"], "MAX@example.com", now.Add(time.Minute)), TooManyEmailRequestsError)
+	// Removing the address is not limited
+	require.NoError(t, s.RequestEmail(calendar, "", now.Add(time.Minute)))
+	assert.Len(t, repo.outbox, 1)
+
+	require.NoError(t, s.RequestEmail(calendar, "max@example.com", now.Add(EMAIL_REQUEST_INTERVAL)))
+	assert.Len(t, repo.outbox, 2)
+}
+
+func TestNotificationChanges(t *testing.T) {
+	s, repo, _, gto := newTestNotificationService(t)
+	repo.calendars["cal"].Email = "max@example.com"
+	repo.tokens["unsubscribe:secret"] = "cal"
+
+	gto.tournaments[42].UpdatedAt = time.Now()
+	require.NoError(t, s.tournamentService.Sync())
+	assert.Empty(t, repo.outbox, "changes of other fields are not notified")
+
+	gto.tournaments[42].UpdatedAt = time.Now().Add(time.Minute)
+	gto.tournaments[42].StartDate = gto.tournaments[42].StartDate.Add(7 * 24 * time.Hour)
+	gto.tournaments[42].EndDate = gto.tournaments[42].EndDate.Add(7 * 24 * time.Hour)
+	gto.tournaments[42].Localtion = "Potsdam"
+	require.NoError(t, s.tournamentService.Sync())
+
+	require.Len(t, repo.outbox, 1)
+	m := repo.outbox[0]
+	assert.Equal(t, "max@example.com", m.To)
+	assert.Contains(t, m.Body, "Datum geändert von 14.06.–15.06.2025 auf 21.06.–22.06.2025")
+	assert.Contains(t, m.Body, "Ort geändert von Berlin auf Potsdam")
+	assert.Contains(t, m.Body, "https://example.com/calendar/email/unsubscribe/secret")
+
+	repo.calendars["cal"].Config.Exclude = []int{42}
+	gto.tournaments[42].UpdatedAt = time.Now().Add(2 * time.Minute)
+	gto.tournaments[42].Status = model.TOURNAMENT_STATUS_CANCELLED
+	require.NoError(t, s.tournamentService.Sync())
+	assert.Len(t, repo.outbox, 1, "tournaments outside the calendar are not notified")
+}
+
+func TestNotificationRegistrations(t *testing.T) {
+	s, repo, _, _ := newTestNotificationService(t)
+	repo.calendars["cal"].Email = "max@example.com"
+
+	opening := s.tournamentService.GetTournament(42).Registrations[0].StartDate
+
+	require.NoError(t, s.NotifyRegistrations(opening.Add(-25*time.Hour)))
+	assert.Empty(t, repo.outbox)
+
+	require.NoError(t, s.NotifyRegistrations(opening.Add(-23*time.Hour)))
+	require.NoError(t, s.NotifyRegistrations(opening.Add(-time.Hour)))
+	require.Len(t, repo.outbox, 1, "each phase is only reminded once")
+	assert.Contains(t, repo.outbox[0].Body, "1. Phase")
+
+	repo.outbox = nil
+	calendar := repo.calendars["cal"]
+	require.NoError(t, s.calendarService.SetAttendance(calendar, 42, model.SUBSCRIPTION_STATUS_REGISTERED))
+	require.NoError(t, s.NotifyRegistrations(opening.Add(-time.Hour)))
+	assert.Empty(t, repo.outbox, "no reminders for tournaments the owner registered for")
+}
+
+func TestRecoverEditLinks(t *testing.T) {
+	s, repo, _, _ := newTestNotificationService(t)
+	repo.calendars["cal"].Email = "max@example.com"
+	now := time.Now()
+
+	assert.ErrorIs(t, s.RecoverEditLinks("nobody", now), InvalidEmailError)
+
+	require.NoError(t, s.RecoverEditLinks("other@example.com", now))
+	assert.Empty(t, repo.outbox, "unknown addresses get no mail")
+
+	require.NoError(t, s.RecoverEditLinks("Max@Example.com", now))
+	require.Len(t, repo.outbox, 1)
+	assert.Contains(t, repo.outbox[0].Body, "https://example.com/calendar/edit/secret")
+
+	require.NoError(t, s.RecoverEditLinks("max@example.com", now.Add(time.Minute)))
+	assert.Len(t, repo.outbox, 1, "recovery is rate limited per address")
+
+	require.NoError(t, s.RecoverEditLinks("max@example.com", now.Add(RECOVERY_INTERVAL)))
+	require.Len(t, repo.outbox, 2)
+	assert.Contains(t, repo.outbox[1].Body, "https://example.com/calendar/edit/secret", "requesting links does not change them")
+}
+
+func TestRenewEditCodes(t *testing.T) {
+	s, repo, _, _ := newTestNotificationService(t)
+	calendars := s.calendarService.repo.(*fakeCalendarRepo)
+	repo.calendars["cal"].Email = "max@example.com"
+	now := time.Now()
+
+	require.NoError(t, s.RecoverEditLinks("max@example.com", now))
+	require.Len(t, repo.outbox, 1)
+	link := regexp.MustCompile(`https://example.com/calendar/recover/(\S+)`).FindStringSubmatch(repo.outbox[0].Body)
+	require.NotNil(t, link, repo.outbox[0].Body)
+
+	ok, err := s.RenewEditCodes("unknown", now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = s.RenewEditCodes(link[1], now.Add(RECOVERY_TOKEN_VALIDITY+time.Minute))
+	require.NoError(t, err)
+	assert.False(t, ok, "expired")
+	assert.Empty(t, calendars.editIds["cal"])
+
+	ok, err = s.RenewEditCodes(link[1], now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	editId := calendars.editIds["cal"]
+	assert.NotEmpty(t, editId, "the edit code is rotated")
+	require.Len(t, repo.outbox, 2)
+	assert.Equal(t, "max@example.com", repo.outbox[1].To)
+	assert.Contains(t, repo.outbox[1].Body, "https://example.com/calendar/edit/"+editId)
+
+	ok, err = s.RenewEditCodes(link[1], now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, ok, "the link works once")
+	assert.Equal(t, editId, calendars.editIds["cal"])
+}
+
+func TestDeliverMail(t *testing.T) {
+	s, repo, sender, _ := newTestNotificationService(t)
+	now := time.Now()
+	require.NoError(t, repo.EnqueueMail(&model.OutboxMessage{To: "max@example.com", Subject: "Hallo", NextAttemptAt: now}))
+
+	sender.err = errors.New("connection refused")
+	require.NoError(t, s.DeliverMail(now))
+	assert.Equal(t, 1, repo.outbox[0].Attempts)
+	assert.Equal(t, "connection refused", repo.outbox[0].LastError)
+
+	require.NoError(t, s.DeliverMail(now))
+	assert.Equal(t, 1, repo.outbox[0].Attempts, "failed messages are retried later")
+
+	sender.err = nil
+	require.NoError(t, s.DeliverMail(now.Add(time.Minute)))
+	require.Len(t, sender.sent, 1)
+	assert.NotNil(t, repo.outbox[0].SentAt)
+
+	require.NoError(t, s.DeliverMail(now.Add(time.Hour)))
+	assert.Len(t, sender.sent, 1, "sent messages are not sent again")
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+)
+
+const RETENTION_FLAG = "FLAG"
+const RETENTION_UNFLAG = "UNFLAG"
+const RETENTION_DELETE = "DELETE"
+const RETENTION_PURGE = "PURGE"
+
+// RETENTION_REASON_UNUSED calendars were never retrieved after creation,
+// RETENTION_REASON_INACTIVE ones were not retrieved for a long time.
+const RETENTION_REASON_UNUSED = "UNUSED"
+const RETENTION_REASON_INACTIVE = "INACTIVE"
+
+// RETENTION_MODE_OFF leaves calendars alone, RETENTION_MODE_DRY_RUN only logs
+// the steps a run would take and RETENTION_MODE_ON takes them.
+const RETENTION_MODE_OFF = "off"
+const RETENTION_MODE_DRY_RUN = "dry-run"
+const RETENTION_MODE_ON = "on"
+
+var RetentionModes = []string{RETENTION_MODE_OFF, RETENTION_MODE_DRY_RUN, RETENTION_MODE_ON}
+
+type RetentionRepo interface {
+	GetCalendars() ([]*model.Calendar, error)
+	GetDeletedCalendars() ([]*model.Calendar, error)
+	SetFlaggedAt(calendarId string, flaggedAt *time.Time) error
+	SoftDeleteCalendar(calendarId string, deletedAt time.Time) error
+	PurgeCalendar(id string) error
+}
+
+// RetentionPolicy decides when calendars count as abandoned. Abandoned
+// calendars are flagged and their owners warned, after Grace they are
+// deleted, and after another Grace they are purged.
+type RetentionPolicy struct {
+	// Mode is one of RetentionModes
+	Mode string
+	// UnusedAfter is how long a calendar may exist without being retrieved
+	UnusedAfter time.Duration
+	// InactiveAfter is how long a calendar may go without being retrieved
+	InactiveAfter time.Duration
+	Grace         time.Duration
+}
+
+// RetentionAction is a step of the retention policy for one calendar.
+type RetentionAction struct {
+	Calendar *model.Calendar
+	Action   string
+	Reason   string
+	// DeleteAt is when a flagged calendar is deleted
+	DeleteAt time.Time
+}
+
+type RetentionService struct {
+	repo          RetentionRepo
+	notifications *NotificationService
+	policy        RetentionPolicy
+}
+
+func NewRetentionService(repo RetentionRepo, notifications *NotificationService, policy RetentionPolicy) *RetentionService {
+	return &RetentionService{repo: repo, notifications: notifications, policy: policy}
+}
+
+func (s *RetentionService) Policy() RetentionPolicy {
+	return s.policy
+}
+
+// Plan returns the steps a run at now would take, without taking them.
+func (s *RetentionService) Plan(now time.Time) ([]RetentionAction, error) {
+	calendars, err := s.repo.GetCalendars()
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []RetentionAction{}
+	for _, c := range calendars {
+		reason := s.policy.reason(c, now)
+		switch {
+		case c.FlaggedAt == nil && reason != "":
+			actions = append(actions, RetentionAction{Calendar: c, Action: RETENTION_FLAG, Reason: reason, DeleteAt: now.Add(s.policy.Grace)})
+		case c.FlaggedAt == nil:
+		case reason == "" || usedSince(c, *c.FlaggedAt):
+			actions = append(actions, RetentionAction{Calendar: c, Action: RETENTION_UNFLAG})
+		case !now.Before(c.FlaggedAt.Add(s.policy.Grace)):
+			actions = append(actions, RetentionAction{Calendar: c, Action: RETENTION_DELETE, Reason: reason})
+		}
+	}
+
+	deleted, err := s.repo.GetDeletedCalendars()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range deleted {
+		// Only calendars deleted by the policy are purged, they keep their flag
+		if c.FlaggedAt != nil && !now.Before(c.DeletedAt.Add(s.policy.Grace)) {
+			actions = append(actions, RetentionAction{Calendar: c, Action: RETENTION_PURGE})
+		}
+	}
+	return actions, nil
+}
+
+// Run takes the steps of the retention policy due at now and returns the ones
+// taken. In RETENTION_MODE_DRY_RUN the steps are only logged and in
+// RETENTION_MODE_OFF nothing is done. A step failing for one calendar is
+// logged and does not stop the others.
+func (s *RetentionService) Run(now time.Time) ([]RetentionAction, error) {
+	if s.policy.Mode != RETENTION_MODE_ON && s.policy.Mode != RETENTION_MODE_DRY_RUN {
+		return []RetentionAction{}, nil
+	}
+
+	actions, err := s.Plan(now)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.policy.Mode == RETENTION_MODE_DRY_RUN {
+		for _, a := range actions {
+			log.Printf("Retention (dry run): %s calendar %s %s", a.Action, a.Calendar.Id, a.Reason)
+		}
+		return []RetentionAction{}, nil
+	}
+
+	taken := []RetentionAction{}
+	for _, a := range actions {
+		if err := s.apply(a, now); err != nil {
+			log.Printf("Retention: could not %s calendar %s: %s", a.Action, a.Calendar.Id, err.Error())
+			continue
+		}
+		log.Printf("Retention: %s calendar %s %s", a.Action, a.Calendar.Id, a.Reason)
+		taken = append(taken, a)
+	}
+	return taken, nil
+}
+
+func (s *RetentionService) apply(a RetentionAction, now time.Time) error {
+	switch a.Action {
+	case RETENTION_FLAG:
+		if err := s.repo.SetFlaggedAt(a.Calendar.Id, &now); err != nil {
+			return err
+		}
+		a.Calendar.FlaggedAt = &now
+		return s.notifications.WarnDeletion(a.Calendar, a.DeleteAt)
+	case RETENTION_UNFLAG:
+		return s.repo.SetFlaggedAt(a.Calendar.Id, nil)
+	case RETENTION_DELETE:
+		return s.repo.SoftDeleteCalendar(a.Calendar.Id, now)
+	case RETENTION_PURGE:
+		return s.repo.PurgeCalendar(a.Calendar.Id)
+	}
+	return nil
+}
+
+// reason returns why calendar counts as abandoned at now, or an empty string
+// if it does not.
+func (p RetentionPolicy) reason(calendar *model.Calendar, now time.Time) string {
+	if calendar.RetrievedAt == nil {
+		if calendar.CreatedAt.Before(now.Add(-p.UnusedAfter)) {
+			return RETENTION_REASON_UNUSED
+		}
+		return ""
+	}
+	if calendar.RetrievedAt.Before(now.Add(-p.InactiveAfter)) {
+		return RETENTION_REASON_INACTIVE
+	}
+	return ""
+}
+
+// usedSince reports whether the calendar was retrieved or saved after t.
+func usedSince(calendar *model.Calendar, t time.Time) bool {
+	return (calendar.RetrievedAt != nil && calendar.RetrievedAt.After(t)) || calendar.UpdatedAt.After(t)
+}
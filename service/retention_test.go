@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetention(t *testing.T) {
+	notifications, repo, _, _ := newTestNotificationService(t)
+	calendarRepo := notifications.calendarService.repo.(*fakeCalendarRepo)
+	day := 24 * time.Hour
+	now := time.Now()
+	retrievedAt := now.Add(-400 * day)
+	repo.calendars["cal"].Email = "max@example.com"
+	repo.calendars["cal"].CreatedAt = now.Add(-500 * day)
+	repo.calendars["cal"].UpdatedAt = now.Add(-500 * day)
+	repo.calendars["cal"].RetrievedAt = &retrievedAt
+	repo.calendars["new"] = &model.Calendar{Id: "new", Title: "New", CreatedAt: now.Add(-day), Config: &model.SubscriptionConfig{}}
+	repo.calendars["unused"] = &model.Calendar{Id: "unused", Title: "Unused", CreatedAt: now.Add(-40 * day), Config: &model.SubscriptionConfig{}}
+
+	s := NewRetentionService(calendarRepo, notifications, RetentionPolicy{Mode: RETENTION_MODE_ON, UnusedAfter: 30 * day, InactiveAfter: 365 * day, Grace: 14 * day})
+
+	actions, err := s.Plan(now)
+	require.NoError(t, err)
+	require.Len(t, actions, 2)
+	assert.Nil(t, repo.calendars["cal"].FlaggedAt, "planning changes nothing")
+	assert.Empty(t, repo.outbox)
+
+	actions, err = s.Run(now)
+	require.NoError(t, err)
+	require.Len(t, actions, 2)
+	reasons := map[string]string{}
+	for _, a := range actions {
+		assert.Equal(t, RETENTION_FLAG, a.Action)
+		reasons[a.Calendar.Id] = a.Reason
+	}
+	assert.Equal(t, map[string]string{"cal": RETENTION_REASON_INACTIVE, "unused": RETENTION_REASON_UNUSED}, reasons)
+	require.NotNil(t, repo.calendars["cal"].FlaggedAt)
+	require.Len(t, repo.outbox, 1, "only owners with an address are warned")
+	assert.Contains(t, repo.outbox[0].Body, "wird am "+now.Add(14*day).Format("02.01.2006")+" gelöscht")
+
+	actions, err = s.Run(now.Add(day))
+	require.NoError(t, err)
+	assert.Empty(t, actions, "nothing happens during the grace period")
+
+	retrievedAt = now.Add(2 * day)
+	actions, err = s.Run(now.Add(3 * day))
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, RETENTION_UNFLAG, actions[0].Action)
+	assert.Nil(t, repo.calendars["cal"].FlaggedAt, "retrieving the calendar keeps it")
+
+	actions, err = s.Run(now.Add(14 * day))
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, RETENTION_DELETE, actions[0].Action)
+	assert.NotNil(t, repo.calendars["unused"].DeletedAt)
+	c, err := calendarRepo.GetCalendarById("unused")
+	require.NoError(t, err)
+	assert.Nil(t, c, "deleted calendars are hidden")
+
+	actions, err = s.Run(now.Add(28 * day))
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, RETENTION_PURGE, actions[0].Action)
+	assert.NotContains(t, repo.calendars, "unused")
+}
+
+// failingRetentionRepo fails to flag the calendar with id fail.
+type failingRetentionRepo struct {
+	*fakeCalendarRepo
+	fail string
+}
+
+func (r *failingRetentionRepo) SetFlaggedAt(calendarId string, flaggedAt *time.Time) error {
+	if calendarId == r.fail {
+		return errors.New("database is locked")
+	}
+	return r.fakeCalendarRepo.SetFlaggedAt(calendarId, flaggedAt)
+}
+
+func TestRetentionModes(t *testing.T) {
+	notifications, repo, _, _ := newTestNotificationService(t)
+	calendarRepo := notifications.calendarService.repo.(*fakeCalendarRepo)
+	day := 24 * time.Hour
+	now := time.Now()
+	repo.calendars["cal"].CreatedAt = now.Add(-40 * day)
+	repo.calendars["unused"] = &model.Calendar{Id: "unused", Title: "Unused", CreatedAt: now.Add(-40 * day), Config: &model.SubscriptionConfig{}}
+	policy := RetentionPolicy{UnusedAfter: 30 * day, InactiveAfter: 365 * day, Grace: 14 * day}
+
+	for _, mode := range []string{"", RETENTION_MODE_OFF, RETENTION_MODE_DRY_RUN} {
+		policy.Mode = mode
+		actions, err := NewRetentionService(calendarRepo, notifications, policy).Run(now)
+		require.NoError(t, err)
+		assert.Empty(t, actions, mode)
+		assert.Nil(t, repo.calendars["unused"].FlaggedAt, mode)
+	}
+
+	// A failing calendar does not stop the others
+	policy.Mode = RETENTION_MODE_ON
+	s := NewRetentionService(&failingRetentionRepo{calendarRepo, "cal"}, notifications, policy)
+	actions, err := s.Run(now)
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, "unused", actions[0].Calendar.Id)
+	assert.Nil(t, repo.calendars["cal"].FlaggedAt)
+	assert.NotNil(t, repo.calendars["unused"].FlaggedAt)
+
+	// Only calendars deleted by the policy are purged, not those in the trash
+	flaggedAt := now.Add(-30 * day)
+	repo.calendars["trashed"] = &model.Calendar{Id: "trashed", Title: "Trashed", CreatedAt: now.Add(-40 * day), FlaggedAt: &flaggedAt, Config: &model.SubscriptionConfig{}}
+	require.NoError(t, notifications.calendarService.DeleteCalendar("trashed"))
+	actions, err = s.Plan(now.Add(30 * day))
+	require.NoError(t, err)
+	for _, a := range actions {
+		assert.NotEqual(t, "trashed", a.Calendar.Id)
+	}
+}
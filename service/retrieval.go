@@ -0,0 +1,68 @@
+package service
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+)
+
+// RETRIEVAL_RETENTION is how long the daily fetch counts of feeds are kept.
+const RETRIEVAL_RETENTION = 90 * 24 * time.Hour
+
+// ACTIVE_CLIENT_WINDOW is how recently a client must have fetched a feed to
+// count as subscribed.
+const ACTIVE_CLIENT_WINDOW = 7 * 24 * time.Hour
+
+// FeedStats summarizes who fetches the feed of a calendar.
+type FeedStats struct {
+	// Clients that fetched the feed successfully within ACTIVE_CLIENT_WINDOW
+	Clients         []string
+	LastRetrievedAt *time.Time
+	Retrievals      int
+	Errors          int
+}
+
+// RecordRetrieval counts a fetch of the calendar feed with the client
+// classified from its User-Agent.
+func (s *CalendarService) RecordRetrieval(calendarId string, userAgent string, status int, at time.Time) error {
+	return s.repo.AddRetrieval(calendarId, ClientFromUserAgent(userAgent), status, at)
+}
+
+// GetFeedStats returns the fetches of the calendar feed within
+// ACTIVE_CLIENT_WINDOW before now.
+func (s *CalendarService) GetFeedStats(calendar *model.Calendar, now time.Time) (*FeedStats, error) {
+	retrievals, err := s.repo.GetRetrievals(calendar.Id, now.Add(-ACTIVE_CLIENT_WINDOW))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := FeedStats{Clients: []string{}}
+	for _, rt := range retrievals {
+		stats.Retrievals += rt.Count
+		if rt.Status >= http.StatusBadRequest {
+			stats.Errors += rt.Count
+			continue
+		}
+		if !slices.Contains(stats.Clients, rt.Client) {
+			stats.Clients = append(stats.Clients, rt.Client)
+		}
+		if stats.LastRetrievedAt == nil || rt.LastAt.After(*stats.LastRetrievedAt) {
+			stats.LastRetrievedAt = &rt.LastAt
+		}
+	}
+	slices.Sort(stats.Clients)
+	return &stats, nil
+}
+
+// GetClientStats sums up the fetches of all feeds since RETRIEVAL_RETENTION
+// before now by client.
+func (s *CalendarService) GetClientStats(now time.Time) ([]*model.ClientStats, error) {
+	return s.repo.GetClientStats(now.Add(-RETRIEVAL_RETENTION), http.StatusBadRequest)
+}
+
+// PruneRetrievals removes fetch counts older than RETRIEVAL_RETENTION.
+func (s *CalendarService) PruneRetrievals(now time.Time) error {
+	return s.repo.DeleteRetrievals(now.Add(-RETRIEVAL_RETENTION))
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedStats(t *testing.T) {
+	s, repo := newTestCalendarService()
+	calendar := repo.calendars["cal"]
+	now := time.Now()
+
+	require.NoError(t, s.RecordRetrieval("cal", "Google-Calendar-Importer", http.StatusOK, now.Add(-8*24*time.Hour)))
+	require.NoError(t, s.RecordRetrieval("cal", "iOS/17.0 (21A329) dataaccessd/1.0", http.StatusOK, now.Add(-2*time.Hour)))
+	require.NoError(t, s.RecordRetrieval("cal", "Microsoft Office/16.0", http.StatusNotModified, now.Add(-3*time.Hour)))
+	require.NoError(t, s.RecordRetrieval("cal", "curl/8.0", http.StatusInternalServerError, now.Add(-time.Hour)))
+	require.NoError(t, s.RecordRetrieval("child", "Thunderbird/115", http.StatusOK, now))
+
+	stats, err := s.GetFeedStats(calendar, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{CLIENT_APPLE, CLIENT_OUTLOOK}, stats.Clients, "old and failed fetches do not count as subscribed")
+	assert.Equal(t, 3, stats.Retrievals)
+	assert.Equal(t, 1, stats.Errors)
+	require.NotNil(t, stats.LastRetrievedAt)
+	assert.Equal(t, now.Add(-2*time.Hour), *stats.LastRetrievedAt)
+
+	require.NoError(t, s.PruneRetrievals(now.Add(RETRIEVAL_RETENTION-7*24*time.Hour)))
+	assert.Len(t, repo.retrievals, 4, "counts older than the retention are removed")
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"log"
 	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/resterle/dg-cal/v2/model"
@@ -26,6 +27,15 @@ type TournamentService struct {
 	gtoService  GtoService
 	repo        TournamentRepo
 	lastSync    *time.Time
+	generation  atomic.Int64
+	listeners   []func([]TournamentChange)
+}
+
+// TournamentChange describes a tournament stored by a sync. Old is nil for
+// tournaments seen for the first time.
+type TournamentChange struct {
+	Old *model.Tournament
+	New *model.Tournament
 }
 
 func NewTournamentService(repo TournamentRepo, gtoService GtoService) (*TournamentService, error) {
@@ -67,6 +77,11 @@ func (s *TournamentService) GetTournamentsForSeries(series []string) []*model.To
 	})
 }
 
+// GetMatchingTournaments returns the tournaments accepted by m.
+func (s *TournamentService) GetMatchingTournaments(m *TournamentMatcher) []*model.Tournament {
+	return s.getTournaments(m.Match)
+}
+
 func (s *TournamentService) GetAllSeries(active ...bool) []string {
 	if len(active) != 1 {
 		active = []bool{true}
@@ -93,6 +108,16 @@ func (s *TournamentService) GetTournamentHistory(id int) ([]*model.Tournament, e
 	return s.repo.GetTournamentHistory(id)
 }
 
+// AddChangeListener registers f to be called with the tournaments changed by each sync.
+func (s *TournamentService) AddChangeListener(f func([]TournamentChange)) {
+	s.listeners = append(s.listeners, f)
+}
+
+// GetGeneration returns a counter that is incremented by every sync that changed a tournament.
+func (s *TournamentService) GetGeneration() int {
+	return int(s.generation.Load())
+}
+
 func (s *TournamentService) Sync() error {
 	log.Printf("Tournament sync start")
 	gtoTournaments, err := s.gtoService.FetchTournaments()
@@ -100,6 +125,9 @@ func (s *TournamentService) Sync() error {
 		return err
 	}
 
+	changes := []TournamentChange{}
+	defer func() { s.notify(changes) }()
+
 	for _, fetchedTournament := range gtoTournaments {
 		storedTournament := s.tournaments[fetchedTournament.Id]
 		if storedTournament == nil || storedTournament.UpdatedAt.Before(fetchedTournament.UpdatedAt) {
@@ -121,6 +149,7 @@ func (s *TournamentService) Sync() error {
 
 			s.tournaments[fetchedTournament.Id] = fetchedTournament
 			s.repo.UpsertTournament(fetchedTournament)
+			changes = append(changes, TournamentChange{Old: storedTournament, New: fetchedTournament})
 
 			for _, p := range details.RegistrationPhases {
 				r := model.Registration{Title: p.Name, StartDate: p.StartDate, EndDate: p.EndDate}
@@ -150,6 +179,16 @@ func (s *TournamentService) GetLastSync() *time.Time {
 	return &t
 }
 
+func (s *TournamentService) notify(changes []TournamentChange) {
+	if len(changes) == 0 {
+		return
+	}
+	s.generation.Add(1)
+	for _, f := range s.listeners {
+		f(changes)
+	}
+}
+
 func (s *TournamentService) getTournaments(filter func(*model.Tournament) bool) []*model.Tournament {
 	result := []*model.Tournament{}
 	for _, t := range s.tournaments {
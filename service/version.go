@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+)
+
+// VERSION_LIST_LENGTH is the number of versions shown for a calendar.
+const VERSION_LIST_LENGTH = 30
+
+var VersionNotFoundError = errors.New("version not found")
+
+// CalendarVersion is a stored version with the tournaments and series it
+// added and removed compared to the version before.
+type CalendarVersion struct {
+	*model.CalendarVersion
+	AddedTournaments   []int
+	RemovedTournaments []int
+	AddedSeries        []string
+	RemovedSeries      []string
+	// Current is set if the calendar still has this title and config
+	Current bool
+	// Initial is set for the first version of the calendar
+	Initial bool
+}
+
+// GetVersions returns the latest versions of the calendar, newest first.
+func (s *CalendarService) GetVersions(calendar *model.Calendar) ([]CalendarVersion, error) {
+	versions, err := s.repo.GetVersions(calendar.Id, VERSION_LIST_LENGTH+1)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []CalendarVersion{}
+	for i, v := range versions[:min(len(versions), VERSION_LIST_LENGTH)] {
+		version := CalendarVersion{CalendarVersion: v}
+		previous := &model.SubscriptionConfig{}
+		if i+1 < len(versions) {
+			previous = versions[i+1].Config
+		} else {
+			version.Initial = true
+		}
+		version.AddedTournaments, version.RemovedTournaments = listDiff(previous.Tournaments, v.Config.Tournaments)
+		version.AddedSeries, version.RemovedSeries = listDiff(previous.Series, v.Config.Series)
+		result = append(result, version)
+	}
+	if len(result) > 0 {
+		result[0].Current = sameVersion(result[0].CalendarVersion, calendar)
+	}
+	return result, nil
+}
+
+// RestoreVersion sets the title and config of calendar to the ones of a
+// previous version. The restore is recorded as a change of editor.
+func (s *CalendarService) RestoreVersion(calendar *model.Calendar, editor *model.Editor, versionId int) error {
+	version, err := s.repo.GetVersion(calendar.Id, versionId)
+	if err != nil {
+		return err
+	}
+	if version == nil {
+		return VersionNotFoundError
+	}
+
+	// Inherited calendars may have changed since, so the config is checked
+	// like a submitted one
+	config := *version.Config
+	if _, err := s.GetMatcher(calendar.Id, config); err != nil {
+		return err
+	}
+
+	oldTitle, oldConfig := calendar.Title, *calendar.Config
+	calendar.Title = version.Title
+	calendar.Config = &config
+	if _, err := s.UpdateCalendar(calendar); err != nil {
+		return err
+	}
+	return s.RecordChange(calendar, editor, oldTitle, oldConfig)
+}
+
+// addVersion stores the current title and config of calendar. Calendars from
+// before versioning get the previous title and config as first version, so
+// the first change can be undone as well.
+func (s *CalendarService) addVersion(calendar *model.Calendar, editor *model.Editor, oldTitle string, old model.SubscriptionConfig, now time.Time) error {
+	versions, err := s.repo.GetVersions(calendar.Id, 1)
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 {
+		if err := s.repo.AddVersion(&model.CalendarVersion{CalendarId: calendar.Id, Title: oldTitle, Config: &old, CreatedAt: calendar.CreatedAt}); err != nil {
+			return err
+		}
+	}
+
+	config := *calendar.Config
+	return s.repo.AddVersion(&model.CalendarVersion{
+		CalendarId: calendar.Id,
+		Title:      calendar.Title,
+		Config:     &config,
+		Editor:     editor.Name,
+		CreatedAt:  now,
+	})
+}
+
+func sameVersion(version *model.CalendarVersion, calendar *model.Calendar) bool {
+	a, _ := json.Marshal(version.Config)
+	b, _ := json.Marshal(calendar.Config)
+	return version.Title == calendar.Title && string(a) == string(b)
+}
+
+// listDiff returns the values of new missing in old and the values of old
+// missing in new.
+func listDiff[T comparable](old []T, new []T) ([]T, []T) {
+	added, removed := []T{}, []T{}
+	for _, v := range new {
+		if !slices.Contains(old, v) {
+			added = append(added, v)
+		}
+	}
+	for _, v := range old {
+		if !slices.Contains(new, v) {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
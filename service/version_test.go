@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersions(t *testing.T) {
+	s, repo := newTestCalendarService()
+	calendar := repo.calendars["cal"]
+	editor := &model.Editor{Name: "Anna", Role: model.EDITOR_ROLE_EDITOR}
+
+	change := func(config model.SubscriptionConfig) {
+		oldTitle, old := calendar.Title, *calendar.Config
+		calendar.Config = &config
+		_, err := s.UpdateCalendar(calendar)
+		require.NoError(t, err)
+		require.NoError(t, s.RecordChange(calendar, editor, oldTitle, old))
+	}
+	change(model.SubscriptionConfig{Series: []string{"Liga", "Cup"}, Tournaments: []int{42}})
+	change(model.SubscriptionConfig{})
+
+	versions, err := s.GetVersions(calendar)
+	require.NoError(t, err)
+	require.Len(t, versions, 3, "the config before the first change is kept")
+	assert.True(t, versions[0].Current)
+	assert.Equal(t, []int{42}, versions[0].RemovedTournaments)
+	assert.Equal(t, []string{"Liga", "Cup"}, versions[0].RemovedSeries)
+	assert.Equal(t, []int{42}, versions[1].AddedTournaments)
+	assert.Equal(t, []string{"Cup"}, versions[1].AddedSeries)
+	assert.Empty(t, versions[1].RemovedSeries)
+	assert.Equal(t, "Anna", versions[1].Editor)
+	assert.Equal(t, []string{"Liga"}, versions[2].AddedSeries)
+	assert.False(t, versions[2].Current)
+	assert.True(t, versions[2].Initial)
+	assert.False(t, versions[1].Initial)
+
+	require.NoError(t, s.RestoreVersion(calendar, editor, versions[2].Id))
+	assert.Equal(t, []string{"Liga"}, calendar.Config.Series)
+	versions, err = s.GetVersions(calendar)
+	require.NoError(t, err)
+	require.Len(t, versions, 4, "restoring adds a version")
+	assert.True(t, versions[0].Current)
+	assert.Equal(t, []string{"Liga"}, versions[0].AddedSeries)
+
+	assert.ErrorIs(t, s.RestoreVersion(calendar, editor, 99), VersionNotFoundError)
+}
+
+func TestCreateCalendarVersion(t *testing.T) {
+	s, repo := newTestCalendarService()
+
+	_, err := s.CreateCalendar("New", model.SubscriptionConfig{Series: []string{"Cup"}})
+	require.NoError(t, err)
+	require.Len(t, repo.versions, 1)
+
+	versions, err := s.GetVersions(repo.calendars[repo.versions[0].CalendarId])
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.True(t, versions[0].Current)
+	assert.Equal(t, []string{"Cup"}, versions[0].AddedSeries)
+}
@@ -0,0 +1,620 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/resterle/dg-cal/v2/service"
+)
+
+const API_DEFAULT_PAGE_SIZE = 50
+const API_MAX_PAGE_SIZE = 200
+
+// API_MAX_BODY_SIZE limits the JSON documents posted to the API.
+const API_MAX_BODY_SIZE = 1 << 20
+
+// Codes of ApiError, clients should rely on them rather than on messages.
+const API_ERROR_INVALID_REQUEST = "invalid_request"
+const API_ERROR_INVALID_PARAMETER = "invalid_parameter"
+const API_ERROR_UNSUPPORTED_MEDIA_TYPE = "unsupported_media_type"
+const API_ERROR_UNAUTHORIZED = "unauthorized"
+const API_ERROR_FORBIDDEN = "forbidden"
+const API_ERROR_NOT_FOUND = "not_found"
+const API_ERROR_TOO_MANY_REQUESTS = "too_many_requests"
+const API_ERROR_INTERNAL = "internal_error"
+
+type ApiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ApiErrorResponse struct {
+	Error ApiError `json:"error"`
+}
+
+type ApiPagination struct {
+	Page    int `json:"page"`
+	PerPage int `json:"perPage"`
+	Total   int `json:"total"`
+	Pages   int `json:"pages"`
+}
+
+// ApiPage is the response of all list endpoints.
+type ApiPage[T any] struct {
+	Data       []T           `json:"data"`
+	Pagination ApiPagination `json:"pagination"`
+}
+
+type ApiRegistration struct {
+	Title     string    `json:"title"`
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+}
+
+type ApiTournament struct {
+	Id            int               `json:"id"`
+	Title         string            `json:"title"`
+	Status        string            `json:"status"`
+	StartDate     time.Time         `json:"startDate"`
+	EndDate       time.Time         `json:"endDate"`
+	Location      string            `json:"location"`
+	GeoLocation   string            `json:"geoLocation,omitempty"`
+	Series        []string          `json:"series"`
+	PdgaTier      string            `json:"pdgaTier,omitempty"`
+	PdgaId        string            `json:"pdgaId,omitempty"`
+	DRating       bool              `json:"dRating"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+	Registrations []ApiRegistration `json:"registrations"`
+}
+
+// ApiTournamentDetail adds the earlier states of the tournament, newest
+// first.
+type ApiTournamentDetail struct {
+	ApiTournament
+	History []ApiTournament `json:"history"`
+}
+
+type ApiRules struct {
+	PdgaTiers   []string `json:"pdgaTiers"`
+	DRatingOnly bool     `json:"dRatingOnly"`
+	// From and To are dates like 2026-05-01
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Location string   `json:"location,omitempty"`
+	Regex    bool     `json:"regex"`
+	Status   []string `json:"status"`
+}
+
+// ApiCalendarConfig is the model.SubscriptionConfig of a calendar.
+type ApiCalendarConfig struct {
+	Tournaments       []int    `json:"tournaments"`
+	Series            []string `json:"series"`
+	Tasks             bool     `json:"tasks"`
+	Rules             ApiRules `json:"rules"`
+	Exclude           []int    `json:"exclude"`
+	Inherit           []string `json:"inherit"`
+	ConflictWindow    int      `json:"conflictWindow"`
+	AnnotateConflicts bool     `json:"annotateConflicts"`
+}
+
+type ApiCalendar struct {
+	// Id is the public id of the calendar, part of its FeedUrl
+	Id          string            `json:"id"`
+	Title       string            `json:"title"`
+	FeedUrl     string            `json:"feedUrl"`
+	Role        string            `json:"role"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	RetrievedAt *time.Time        `json:"retrievedAt"`
+	Config      ApiCalendarConfig `json:"config"`
+}
+
+// ApiCalendarInput creates or replaces a calendar.
+type ApiCalendarInput struct {
+	Title  string             `json:"title"`
+	Config *ApiCalendarConfig `json:"config"`
+}
+
+// ApiCreatedCalendar holds the edit code of a new calendar, the bearer token
+// for all further requests. It is not shown again.
+type ApiCreatedCalendar struct {
+	EditCode string      `json:"editCode"`
+	Calendar ApiCalendar `json:"calendar"`
+}
+
+type apiRoute struct {
+	pattern string
+	// group is the RateLimiter group of the route
+	group   string
+	handler func(app *WebApp) http.HandlerFunc
+}
+
+// apiRoutes are the /api/v1 endpoints, see RegisterApiRoutes.
+var apiRoutes = []apiRoute{
+	{"GET /api/v1/tournaments", "api", func(app *WebApp) http.HandlerFunc { return app.ApiTournamentsHandler }},
+	{"GET /api/v1/tournaments/{id}", "api", func(app *WebApp) http.HandlerFunc { return app.ApiTournamentHandler }},
+	{"GET /api/v1/series", "api", func(app *WebApp) http.HandlerFunc { return app.ApiSeriesHandler }},
+	{"POST /api/v1/calendars", "create", func(app *WebApp) http.HandlerFunc { return app.ApiCreateCalendarHandler }},
+	{"GET /api/v1/calendar", "edit", func(app *WebApp) http.HandlerFunc { return app.ApiCalendarHandler }},
+	{"PUT /api/v1/calendar", "edit", func(app *WebApp) http.HandlerFunc { return app.ApiUpdateCalendarHandler }},
+	{"DELETE /api/v1/calendar", "edit", func(app *WebApp) http.HandlerFunc { return app.ApiDeleteCalendarHandler }},
+	{"GET /api/v1/calendar/tournaments", "edit", func(app *WebApp) http.HandlerFunc { return app.ApiCalendarTournamentsHandler }},
+	{"/api/v1/", "api", func(app *WebApp) http.HandlerFunc { return app.ApiNotFoundHandler }},
+}
+
+// RegisterApiRoutes adds the /api/v1 endpoints to mux, limited by the
+// groups of apiRoutes.
+func (app *WebApp) RegisterApiRoutes(mux *http.ServeMux) {
+	for _, route := range apiRoutes {
+		mux.Handle(route.pattern, app.limits.Limit(route.group, route.handler(app)))
+	}
+}
+
+// ApiTournamentsHandler lists the tournaments by start date, filtered by the
+// query parameters from, to, status, series, tier, drating, q and location.
+func (app *WebApp) ApiTournamentsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, perPage, err := apiPageParams(query)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_PARAMETER, err.Error())
+		return
+	}
+	matcher, err := apiTournamentFilter(query)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_PARAMETER, err.Error())
+		return
+	}
+
+	tournaments := app.tournamentService.GetTournaments()
+	if matcher != nil {
+		tournaments = app.tournamentService.GetMatchingTournaments(matcher)
+	}
+	sortByStartDate(tournaments)
+
+	result := []ApiTournament{}
+	for _, t := range tournaments {
+		result = append(result, apiTournament(t))
+	}
+	app.addCachingHeader(w)
+	writeJson(w, http.StatusOK, apiPage(result, page, perPage))
+}
+
+// ApiTournamentHandler returns a tournament with its registration phases and
+// history.
+func (app *WebApp) ApiTournamentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_PARAMETER, "Invalid tournament ID")
+		return
+	}
+	tournament := app.tournamentService.GetTournament(id)
+	if tournament == nil {
+		writeApiError(w, http.StatusNotFound, API_ERROR_NOT_FOUND, "Tournament not found")
+		return
+	}
+
+	history, err := app.tournamentService.GetTournamentHistory(id)
+	if err != nil {
+		log.Printf("Failed to get history of tournament %d: %v", id, err)
+		writeApiError(w, http.StatusInternalServerError, API_ERROR_INTERNAL, "Failed to retrieve tournament history")
+		return
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].UpdatedAt.After(history[j].UpdatedAt) })
+
+	result := ApiTournamentDetail{ApiTournament: apiTournament(tournament), History: []ApiTournament{}}
+	for _, t := range history {
+		result.History = append(result.History, apiTournament(t))
+	}
+	app.addCachingHeader(w)
+	writeJson(w, http.StatusOK, result)
+}
+
+// ApiSeriesHandler lists the names of the series with upcoming tournaments,
+// or with active=false of all series.
+func (app *WebApp) ApiSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, perPage, err := apiPageParams(query)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_PARAMETER, err.Error())
+		return
+	}
+	active := true
+	if query.Get("active") != "" {
+		if active, err = apiBool(query, "active"); err != nil {
+			writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_PARAMETER, err.Error())
+			return
+		}
+	}
+
+	series := app.tournamentService.GetAllSeries(active)
+	sort.Strings(series)
+	app.addCachingHeader(w)
+	writeJson(w, http.StatusOK, apiPage(series, page, perPage))
+}
+
+func (app *WebApp) ApiCreateCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	title, config, ok := app.readApiCalendar(w, r, nil)
+	if !ok {
+		return
+	}
+
+	editCode, err := app.calendaeService.CreateCalendar(title, config)
+	if err != nil {
+		log.Printf("Failed to create calendar: %v", err)
+		writeApiError(w, http.StatusInternalServerError, API_ERROR_INTERNAL, "Failed to create calendar")
+		return
+	}
+	calendar, editor, err := app.calendaeService.GetEditor(editCode)
+	if err != nil || calendar == nil {
+		log.Printf("Failed to get created calendar: %v", err)
+		writeApiError(w, http.StatusInternalServerError, API_ERROR_INTERNAL, "Failed to create calendar")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", "/api/v1/calendar")
+	writeJson(w, http.StatusCreated, ApiCreatedCalendar{EditCode: editCode, Calendar: apiCalendar(r, calendar, editor)})
+}
+
+func (app *WebApp) ApiCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	calendar, editor, ok := app.apiEditorAccess(w, r, model.EDITOR_ROLE_VIEWER)
+	if !ok {
+		return
+	}
+	writeJson(w, http.StatusOK, apiCalendar(r, calendar, editor))
+}
+
+// ApiUpdateCalendarHandler replaces the title and config of the calendar,
+// like saving the edit page.
+func (app *WebApp) ApiUpdateCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	calendar, editor, ok := app.apiEditorAccess(w, r, model.EDITOR_ROLE_EDITOR)
+	if !ok {
+		return
+	}
+	title, config, ok := app.readApiCalendar(w, r, calendar)
+	if !ok {
+		return
+	}
+
+	oldTitle, oldConfig := calendar.Title, *calendar.Config
+	calendar.Title = title
+	calendar.Config = &config
+	if _, err := app.calendaeService.UpdateCalendar(calendar); err != nil {
+		log.Printf("Failed to update calendar %s: %v", calendar.Id, err)
+		writeApiError(w, http.StatusInternalServerError, API_ERROR_INTERNAL, "Failed to update calendar")
+		return
+	}
+	if err := app.calendaeService.RecordChange(calendar, editor, oldTitle, oldConfig); err != nil {
+		log.Printf("Could not record change of calendar %s: %s", calendar.Id, err.Error())
+	}
+	writeJson(w, http.StatusOK, apiCalendar(r, calendar, editor))
+}
+
+// ApiDeleteCalendarHandler moves the calendar to the trash, admins can
+// still restore it until it is purged.
+func (app *WebApp) ApiDeleteCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	calendar, _, ok := app.apiEditorAccess(w, r, model.EDITOR_ROLE_OWNER)
+	if !ok {
+		return
+	}
+	if err := app.calendaeService.DeleteCalendar(calendar.Id); err != nil {
+		log.Printf("Failed to delete calendar %s: %v", calendar.Id, err)
+		writeApiError(w, http.StatusInternalServerError, API_ERROR_INTERNAL, "Failed to delete calendar")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ApiCalendarTournamentsHandler lists the tournaments of the calendar feed.
+func (app *WebApp) ApiCalendarTournamentsHandler(w http.ResponseWriter, r *http.Request) {
+	calendar, _, ok := app.apiEditorAccess(w, r, model.EDITOR_ROLE_VIEWER)
+	if !ok {
+		return
+	}
+	page, perPage, err := apiPageParams(r.URL.Query())
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_PARAMETER, err.Error())
+		return
+	}
+
+	matcher, err := app.calendaeService.GetMatcher(calendar.Id, *calendar.Config)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_REQUEST, "Invalid calendar config: "+err.Error())
+		return
+	}
+	tournaments := app.tournamentService.GetMatchingTournaments(matcher)
+	sortByStartDate(tournaments)
+
+	result := []ApiTournament{}
+	for _, t := range tournaments {
+		result = append(result, apiTournament(t))
+	}
+	writeJson(w, http.StatusOK, apiPage(result, page, perPage))
+}
+
+func (app *WebApp) ApiNotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeApiError(w, http.StatusNotFound, API_ERROR_NOT_FOUND, "Unknown endpoint")
+}
+
+// apiEditorAccess resolves the bearer token to its calendar and editor, like
+// editorAccess does with the secret in the path of the web pages.
+func (app *WebApp) apiEditorAccess(w http.ResponseWriter, r *http.Request, role string) (*model.Calendar, *model.Editor, bool) {
+	w.Header().Set("Cache-Control", "no-store")
+	if wait := app.limits.LockedOut(r, time.Now()); wait > 0 {
+		tooManyRequests(w, r, wait)
+		return nil, nil, false
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token = strings.TrimSpace(token); !found || token == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeApiError(w, http.StatusUnauthorized, API_ERROR_UNAUTHORIZED, "Edit code required as bearer token")
+		return nil, nil, false
+	}
+
+	calendar, editor, err := app.calendaeService.GetEditor(token)
+	if err != nil {
+		log.Printf("Failed to get editor: %v", err)
+		writeApiError(w, http.StatusInternalServerError, API_ERROR_INTERNAL, "Failed to retrieve calendar")
+		return nil, nil, false
+	}
+	if calendar == nil {
+		app.limits.Failed(r, time.Now())
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeApiError(w, http.StatusUnauthorized, API_ERROR_UNAUTHORIZED, "Unknown edit code")
+		return nil, nil, false
+	}
+	if !service.HasRole(editor, role) {
+		writeApiError(w, http.StatusForbidden, API_ERROR_FORBIDDEN, "Not allowed for your role")
+		return nil, nil, false
+	}
+	return calendar, editor, true
+}
+
+// readApiCalendar decodes and validates the ApiCalendarInput posted for the
+// calendar, which is nil for new calendars. Without a config in the input the
+// calendar keeps its config.
+func (app *WebApp) readApiCalendar(w http.ResponseWriter, r *http.Request, calendar *model.Calendar) (string, model.SubscriptionConfig, bool) {
+	id, config := "", model.SubscriptionConfig{Tournaments: []int{}, Series: []string{}}
+	if calendar != nil {
+		id, config = calendar.Id, *calendar.Config
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeApiError(w, http.StatusUnsupportedMediaType, API_ERROR_UNSUPPORTED_MEDIA_TYPE, "Content-Type must be application/json")
+		return "", config, false
+	}
+
+	var input ApiCalendarInput
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, API_MAX_BODY_SIZE))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_REQUEST, "Invalid JSON: "+err.Error())
+		return "", config, false
+	}
+
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_REQUEST, "Title is required")
+		return "", config, false
+	}
+	if input.Config != nil {
+		var err error
+		if config, err = subscriptionConfigFromApi(*input.Config); err == nil {
+			_, err = app.formMatcher(id, config)
+		}
+		if err != nil {
+			writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_REQUEST, err.Error())
+			return "", config, false
+		}
+	}
+	return title, config, true
+}
+
+// subscriptionConfigFromApi checks what the edit form checks in
+// subscriptionConfigFromForm.
+func subscriptionConfigFromApi(c ApiCalendarConfig) (model.SubscriptionConfig, error) {
+	config := model.SubscriptionConfig{
+		Tournaments:       nonNil(c.Tournaments),
+		Series:            nonNil(c.Series),
+		Tasks:             c.Tasks,
+		Exclude:           nonNil(c.Exclude),
+		Inherit:           nonNil(c.Inherit),
+		ConflictWindow:    c.ConflictWindow,
+		AnnotateConflicts: c.AnnotateConflicts,
+		Rules: model.SubscriptionRules{
+			PdgaTiers:   c.Rules.PdgaTiers,
+			DRatingOnly: c.Rules.DRatingOnly,
+			Title:       strings.TrimSpace(c.Rules.Title),
+			Location:    strings.TrimSpace(c.Rules.Location),
+			Regex:       c.Rules.Regex,
+			Status:      c.Rules.Status,
+		},
+	}
+
+	err := validateSubscriptionConfig(&config, c.Rules.From, c.Rules.To)
+	return config, err
+}
+
+// apiTournamentFilter builds a matcher from the filter parameters, it is nil
+// without filters.
+func apiTournamentFilter(query url.Values) (*service.TournamentMatcher, error) {
+	config := model.SubscriptionConfig{
+		Series: query["series"],
+		Rules: model.SubscriptionRules{
+			PdgaTiers: query["tier"],
+			Title:     strings.TrimSpace(query.Get("q")),
+			Location:  strings.TrimSpace(query.Get("location")),
+			Status:    query["status"],
+		},
+	}
+
+	var err error
+	if config.Rules.DRatingOnly, err = apiBool(query, "drating"); err != nil {
+		return nil, err
+	}
+	if err := validateSubscriptionConfig(&config, query.Get("from"), query.Get("to")); err != nil {
+		return nil, err
+	}
+
+	matcher, err := service.NewTournamentMatcher(config)
+	if err != nil || (len(config.Series) == 0 && !matcher.HasRules()) {
+		return nil, err
+	}
+	return matcher, nil
+}
+
+// apiPageParams reads page, starting at 1, and perPage.
+func apiPageParams(query url.Values) (int, int, error) {
+	page, perPage := 1, API_DEFAULT_PAGE_SIZE
+	for name, value := range map[string]*int{"page": &page, "perPage": &perPage} {
+		s := query.Get(name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid %s %q", name, s)
+		}
+		*value = n
+	}
+	if perPage > API_MAX_PAGE_SIZE {
+		return 0, 0, fmt.Errorf("perPage must not exceed %d", API_MAX_PAGE_SIZE)
+	}
+	return page, perPage, nil
+}
+
+func apiPage[T any](items []T, page int, perPage int) ApiPage[T] {
+	// Pages past the end are empty, checked first as the offset of a large
+	// page overflows
+	start := len(items)
+	if page-1 <= len(items)/perPage {
+		start = min((page-1)*perPage, len(items))
+	}
+	end := min(start+perPage, len(items))
+	return ApiPage[T]{
+		Data: append([]T{}, items[start:end]...),
+		Pagination: ApiPagination{
+			Page:    page,
+			PerPage: perPage,
+			Total:   len(items),
+			Pages:   (len(items) + perPage - 1) / perPage,
+		},
+	}
+}
+
+func apiBool(query url.Values, name string) (bool, error) {
+	value := query.Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return b, nil
+}
+
+func apiTournament(t *model.Tournament) ApiTournament {
+	result := ApiTournament{
+		Id:            t.Id,
+		Title:         t.Title,
+		Status:        t.Status,
+		StartDate:     t.StartDate,
+		EndDate:       t.EndDate,
+		Location:      t.Localtion,
+		GeoLocation:   t.GeoLocation,
+		Series:        nonNil(t.Series),
+		PdgaTier:      t.PdgaTier,
+		PdgaId:        t.PdgaId,
+		DRating:       t.DRating,
+		UpdatedAt:     t.UpdatedAt,
+		Registrations: []ApiRegistration{},
+	}
+	for _, reg := range t.Registrations {
+		result.Registrations = append(result.Registrations, ApiRegistration{Title: reg.Title, StartDate: reg.StartDate, EndDate: reg.EndDate})
+	}
+	return result
+}
+
+func apiCalendar(r *http.Request, calendar *model.Calendar, editor *model.Editor) ApiCalendar {
+	config := calendar.Config
+	rules := ApiRules{
+		PdgaTiers:   nonNil(config.Rules.PdgaTiers),
+		DRatingOnly: config.Rules.DRatingOnly,
+		Title:       config.Rules.Title,
+		Location:    config.Rules.Location,
+		Regex:       config.Rules.Regex,
+		Status:      nonNil(config.Rules.Status),
+	}
+	if config.Rules.From != nil {
+		rules.From = config.Rules.From.Format("2006-01-02")
+	}
+	if config.Rules.To != nil {
+		rules.To = config.Rules.To.Format("2006-01-02")
+	}
+
+	scheme := "http"
+	if isHttps(r) {
+		scheme = "https"
+	}
+	return ApiCalendar{
+		Id:          calendar.Id,
+		Title:       calendar.Title,
+		FeedUrl:     scheme + "://" + r.Host + "/ical/" + calendar.Id,
+		Role:        editor.Role,
+		CreatedAt:   calendar.CreatedAt,
+		UpdatedAt:   calendar.UpdatedAt,
+		RetrievedAt: calendar.RetrievedAt,
+		Config: ApiCalendarConfig{
+			Tournaments:       nonNil(config.Tournaments),
+			Series:            nonNil(config.Series),
+			Tasks:             config.Tasks,
+			Rules:             rules,
+			Exclude:           nonNil(config.Exclude),
+			Inherit:           nonNil(config.Inherit),
+			ConflictWindow:    config.ConflictWindow,
+			AnnotateConflicts: config.AnnotateConflicts,
+		},
+	}
+}
+
+// nonNil makes empty lists encode as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+func sortByStartDate(tournaments []*model.Tournament) {
+	sort.Slice(tournaments, func(i, j int) bool {
+		if tournaments[i].StartDate.Equal(tournaments[j].StartDate) {
+			return tournaments[i].Id < tournaments[j].Id
+		}
+		return tournaments[i].StartDate.Before(tournaments[j].StartDate)
+	})
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func writeApiError(w http.ResponseWriter, status int, code string, message string) {
+	writeJson(w, status, ApiErrorResponse{Error: ApiError{Code: code, Message: message}})
+}
@@ -0,0 +1,275 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/db"
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/resterle/dg-cal/v2/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+var apiTestStart = time.Date(2030, 5, 1, 10, 0, 0, 0, time.UTC)
+
+// apiTestGto has three tournaments, the third one cancelled.
+type apiTestGto struct{}
+
+func (g *apiTestGto) FetchEventDetails(id int) (*model.EventDetails, error) {
+	start := apiTestStart.AddDate(0, 0, 7*id)
+	details := &model.EventDetails{
+		ID:        id,
+		Title:     fmt.Sprintf("Open %d", id),
+		StartDate: start,
+		EndDate:   start.Add(24 * time.Hour),
+		Location:  "Berlin",
+		Series:    []string{"Liga Nord"},
+		PDGATier:  "C",
+		RegistrationPhases: []model.RegistrationPhase{
+			{Name: "Phase 1", StartDate: start.AddDate(0, -1, 0), EndDate: start.AddDate(0, 0, -7)},
+		},
+	}
+	if id == 2 {
+		details.Series = []string{"Liga Süd"}
+		details.PDGATier = "B"
+		details.DRatingConsideration = true
+	}
+	return details, nil
+}
+
+func (g *apiTestGto) FetchTournaments() (map[int]*model.Tournament, error) {
+	return map[int]*model.Tournament{
+		1: {Id: 1, Status: model.TOURNAMENT_STATUS_REGISTRATION, UpdatedAt: apiTestStart},
+		2: {Id: 2, Status: model.TOURNAMENT_STATUS_ANNOUNCED, UpdatedAt: apiTestStart},
+		3: {Id: 3, Status: model.TOURNAMENT_STATUS_CANCELLED, UpdatedAt: apiTestStart},
+	}, nil
+}
+
+// newApiTestServer serves the API and GraphQL of an app backed by the real
+// services and a temporary database.
+func newApiTestServer(t *testing.T) (*httptest.Server, *service.CalendarService) {
+	repo, err := db.NewRepo(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(repo.Close)
+
+	tournaments, err := service.NewTournamentService(repo, &apiTestGto{})
+	require.NoError(t, err)
+	require.NoError(t, tournaments.Sync())
+	calendars := service.NewCalendarService(repo)
+
+	app := NewWebApp(tournaments, calendars, nil, nil, nil, nil, NewRateLimiter(nil, ""), time.Minute)
+	mux := http.NewServeMux()
+	app.RegisterApiRoutes(mux)
+	mux.HandleFunc("GET /graphql", app.GraphqlHandler)
+	mux.HandleFunc("POST /graphql", app.GraphqlHandler)
+	server := httptest.NewServer(SecurityMiddleware(mux))
+	t.Cleanup(server.Close)
+	return server, calendars
+}
+
+// apiRequest sends body as JSON and decodes the response into result, if
+// given.
+func apiRequest(t *testing.T, server *httptest.Server, method string, path string, token string, body string, result any) *http.Response {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r, err := http.NewRequest(method, server.URL+path, reader)
+	require.NoError(t, err)
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := server.Client().Do(r)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), path)
+	}
+	if result != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	}
+	return resp
+}
+
+func assertApiError(t *testing.T, server *httptest.Server, method string, path string, token string, body string, status int, code string) {
+	var result ApiErrorResponse
+	resp := apiRequest(t, server, method, path, token, body, &result)
+	assert.Equal(t, status, resp.StatusCode, "%s %s", method, path)
+	assert.Equal(t, code, result.Error.Code, "%s %s", method, path)
+	assert.NotEmpty(t, result.Error.Message)
+}
+
+func TestApiTournaments(t *testing.T) {
+	server, _ := newApiTestServer(t)
+
+	ids := func(query string) []int {
+		var page ApiPage[ApiTournament]
+		resp := apiRequest(t, server, http.MethodGet, "/api/v1/tournaments"+query, "", "", &page)
+		require.Equal(t, http.StatusOK, resp.StatusCode, query)
+		ids := []int{}
+		for _, t := range page.Data {
+			ids = append(ids, t.Id)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []int{1, 2, 3}, ids(""), "sorted by start date")
+	assert.Equal(t, []int{2}, ids("?series=Liga+S%C3%BCd"))
+	assert.Equal(t, []int{1, 3}, ids("?tier=C"))
+	assert.Equal(t, []int{2}, ids("?drating=true"))
+	assert.Equal(t, []int{1, 2}, ids("?status=REGISTRATION&status=ANNOUNCED"))
+	assert.Equal(t, []int{2, 3}, ids("?from=2030-05-15"))
+	assert.Equal(t, []int{1}, ids("?to=2030-05-08"))
+	assert.Equal(t, []int{3}, ids("?q=open+3"))
+	assert.Equal(t, []int{}, ids("?location=Hamburg"))
+
+	var page ApiPage[ApiTournament]
+	apiRequest(t, server, http.MethodGet, "/api/v1/tournaments?perPage=2&page=2", "", "", &page)
+	assert.Equal(t, ApiPagination{Page: 2, PerPage: 2, Total: 3, Pages: 2}, page.Pagination)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, 3, page.Data[0].Id)
+	apiRequest(t, server, http.MethodGet, "/api/v1/tournaments?page=5", "", "", &page)
+	assert.Empty(t, page.Data)
+	assert.Equal(t, 3, page.Pagination.Total)
+	resp := apiRequest(t, server, http.MethodGet, "/api/v1/tournaments?page=4611686018427387905&perPage=2", "", "", &page)
+	require.Equal(t, http.StatusOK, resp.StatusCode, "offset overflows")
+	assert.Empty(t, page.Data)
+
+	for _, query := range []string{"?page=0", "?perPage=x", "?perPage=1000", "?from=May", "?drating=maybe", "?from=2030-06-01&to=2030-05-01"} {
+		assertApiError(t, server, http.MethodGet, "/api/v1/tournaments"+query, "", "", http.StatusBadRequest, API_ERROR_INVALID_PARAMETER)
+	}
+}
+
+func TestApiTournament(t *testing.T) {
+	server, _ := newApiTestServer(t)
+
+	var tournament ApiTournamentDetail
+	resp := apiRequest(t, server, http.MethodGet, "/api/v1/tournaments/2", "", "", &tournament)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Open 2", tournament.Title)
+	assert.Equal(t, []string{"Liga Süd"}, tournament.Series)
+	assert.True(t, tournament.DRating)
+	require.Len(t, tournament.Registrations, 1)
+	assert.Equal(t, "Phase 1", tournament.Registrations[0].Title)
+	assert.NotNil(t, tournament.History)
+
+	assertApiError(t, server, http.MethodGet, "/api/v1/tournaments/99", "", "", http.StatusNotFound, API_ERROR_NOT_FOUND)
+	assertApiError(t, server, http.MethodGet, "/api/v1/tournaments/x", "", "", http.StatusBadRequest, API_ERROR_INVALID_PARAMETER)
+	assertApiError(t, server, http.MethodGet, "/api/v1/unknown", "", "", http.StatusNotFound, API_ERROR_NOT_FOUND)
+}
+
+func TestApiSeries(t *testing.T) {
+	server, _ := newApiTestServer(t)
+
+	var page ApiPage[string]
+	resp := apiRequest(t, server, http.MethodGet, "/api/v1/series", "", "", &page)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"Liga Nord", "Liga Süd"}, page.Data)
+	assert.Equal(t, 2, page.Pagination.Total)
+
+	assertApiError(t, server, http.MethodGet, "/api/v1/series?active=x", "", "", http.StatusBadRequest, API_ERROR_INVALID_PARAMETER)
+}
+
+func TestApiCalendar(t *testing.T) {
+	server, calendars := newApiTestServer(t)
+
+	assertApiError(t, server, http.MethodPost, "/api/v1/calendars", "", `{"title": ""}`, http.StatusBadRequest, API_ERROR_INVALID_REQUEST)
+	assertApiError(t, server, http.MethodPost, "/api/v1/calendars", "", `{"title": "Cal", "color": "red"}`, http.StatusBadRequest, API_ERROR_INVALID_REQUEST)
+	assertApiError(t, server, http.MethodPost, "/api/v1/calendars", "", `{"title": "Cal", "config": {"rules": {"from": "May"}}}`, http.StatusBadRequest, API_ERROR_INVALID_REQUEST)
+	assertApiError(t, server, http.MethodPost, "/api/v1/calendars", "", `{"title": "Cal", "config": {"inherit": ["missing"]}}`, http.StatusBadRequest, API_ERROR_INVALID_REQUEST)
+
+	// Forms can't post JSON, cross-site requests need no CSRF token
+	resp, err := server.Client().Post(server.URL+"/api/v1/calendars", "application/x-www-form-urlencoded", strings.NewReader("title=Cal"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	var created ApiCreatedCalendar
+	resp = apiRequest(t, server, http.MethodPost, "/api/v1/calendars", "", `{"title": " Club ", "config": {"series": ["Liga Nord"]}}`, &created)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NotEmpty(t, created.EditCode)
+	assert.Equal(t, "Club", created.Calendar.Title)
+	assert.Equal(t, model.EDITOR_ROLE_OWNER, created.Calendar.Role)
+	assert.Equal(t, server.URL+"/ical/"+created.Calendar.Id, created.Calendar.FeedUrl)
+	assert.Equal(t, []string{"Liga Nord"}, created.Calendar.Config.Series)
+	assert.Equal(t, []int{}, created.Calendar.Config.Tournaments)
+
+	assertApiError(t, server, http.MethodGet, "/api/v1/calendar", "", "", http.StatusUnauthorized, API_ERROR_UNAUTHORIZED)
+	assertApiError(t, server, http.MethodGet, "/api/v1/calendar", "guessed", "", http.StatusUnauthorized, API_ERROR_UNAUTHORIZED)
+
+	var calendar ApiCalendar
+	resp = apiRequest(t, server, http.MethodGet, "/api/v1/calendar", created.EditCode, "", &calendar)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, created.Calendar, calendar)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	var page ApiPage[ApiTournament]
+	apiRequest(t, server, http.MethodGet, "/api/v1/calendar/tournaments", created.EditCode, "", &page)
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, 1, page.Data[0].Id)
+
+	resp = apiRequest(t, server, http.MethodPut, "/api/v1/calendar", created.EditCode, `{"title": "Club 2", "config": {"tournaments": [2], "rules": {"from": "2030-05-20"}}}`, &calendar)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Club 2", calendar.Title)
+	assert.Equal(t, []int{2}, calendar.Config.Tournaments)
+	assert.Equal(t, "2030-05-20", calendar.Config.Rules.From)
+	apiRequest(t, server, http.MethodGet, "/api/v1/calendar/tournaments", created.EditCode, "", &page)
+	require.Len(t, page.Data, 2)
+	assert.Equal(t, 2, page.Data[0].Id)
+	assert.Equal(t, 3, page.Data[1].Id)
+
+	resp = apiRequest(t, server, http.MethodPut, "/api/v1/calendar", created.EditCode, `{"title": "Club 2", "config": {"tournaments": [2], "rules": {"from": "2030-05-20", "to": "2030-05-20"}}}`, &calendar)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "2030-05-20", calendar.Config.Rules.From, "single day")
+	assert.Equal(t, "2030-05-20", calendar.Config.Rules.To)
+
+	resp = apiRequest(t, server, http.MethodPut, "/api/v1/calendar", created.EditCode, `{"title": "Club 3"}`, &calendar)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Club 3", calendar.Title)
+	assert.Equal(t, []int{2}, calendar.Config.Tournaments, "without config the config is kept")
+	assert.Equal(t, "2030-05-20", calendar.Config.Rules.From)
+
+	// Invited viewers may read, but not change the calendar
+	stored, _, err := calendars.GetEditor(created.EditCode)
+	require.NoError(t, err)
+	viewer, err := calendars.InviteEditor(stored, "Max", model.EDITOR_ROLE_VIEWER)
+	require.NoError(t, err)
+	_, err = calendars.AcceptInvite(viewer.InviteToken)
+	require.NoError(t, err)
+	resp = apiRequest(t, server, http.MethodGet, "/api/v1/calendar", viewer.Secret, "", &calendar)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, model.EDITOR_ROLE_VIEWER, calendar.Role)
+	assertApiError(t, server, http.MethodPut, "/api/v1/calendar", viewer.Secret, `{"title": "Mine"}`, http.StatusForbidden, API_ERROR_FORBIDDEN)
+	assertApiError(t, server, http.MethodDelete, "/api/v1/calendar", viewer.Secret, "", http.StatusForbidden, API_ERROR_FORBIDDEN)
+
+	audit, err := calendars.GetAuditLog(stored)
+	require.NoError(t, err)
+	assert.Len(t, audit, 3, "changes recorded")
+
+	resp = apiRequest(t, server, http.MethodDelete, "/api/v1/calendar", created.EditCode, "", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assertApiError(t, server, http.MethodGet, "/api/v1/calendar", created.EditCode, "", http.StatusUnauthorized, API_ERROR_UNAUTHORIZED)
+}
+
+func TestApiLockout(t *testing.T) {
+	server, _ := newApiTestServer(t)
+
+	for range LOCKOUT_FREE_FAILURES + 1 {
+		assertApiError(t, server, http.MethodGet, "/api/v1/calendar", "guessed", "", http.StatusUnauthorized, API_ERROR_UNAUTHORIZED)
+	}
+	assertApiError(t, server, http.MethodGet, "/api/v1/calendar", "guessed", "", http.StatusTooManyRequests, API_ERROR_TOO_MANY_REQUESTS)
+}
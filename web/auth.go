@@ -0,0 +1,212 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/service"
+)
+
+const ADMIN_SESSION_COOKIE = "dgcal_admin"
+
+type AdminServiceInterface interface {
+	Login(username string, password string, now time.Time) (string, error)
+	Session(token string, now time.Time) (string, error)
+	Logout(token string) error
+}
+
+// AdminAuth decides who may use the admin pages. Either local users log in
+// with a password and get a session cookie, or an upstream proxy
+// authenticates them and passes the user name in proxyHeader.
+type AdminAuth struct {
+	admins      AdminServiceInterface
+	proxyHeader string
+	// proxyUsers limits the users accepted from the proxy, all are if empty
+	proxyUsers []string
+}
+
+func NewLocalAdminAuth(admins AdminServiceInterface) *AdminAuth {
+	return &AdminAuth{admins: admins}
+}
+
+// NewProxyAdminAuth trusts the header set by the proxy, which must strip it
+// from the requests of clients.
+func NewProxyAdminAuth(header string, users []string) *AdminAuth {
+	return &AdminAuth{proxyHeader: header, proxyUsers: users}
+}
+
+// user returns the admin making the request, or an empty string.
+func (a *AdminAuth) user(r *http.Request) string {
+	if a.proxyHeader != "" {
+		user := strings.TrimSpace(r.Header.Get(a.proxyHeader))
+		if user == "" || (len(a.proxyUsers) > 0 && !slices.Contains(a.proxyUsers, user)) {
+			return ""
+		}
+		return user
+	}
+
+	cookie, err := r.Cookie(ADMIN_SESSION_COOKIE)
+	if err != nil {
+		return ""
+	}
+	user, err := a.admins.Session(cookie.Value, time.Now())
+	if err != nil {
+		log.Printf("Failed to get admin session: %v", err)
+		return ""
+	}
+	return user
+}
+
+type adminRoute struct {
+	pattern string
+	handler func(app *WebApp) http.HandlerFunc
+}
+
+// adminRoutes are only served to admins, see RegisterAdminRoutes.
+var adminRoutes = []adminRoute{
+	{"GET /admin", func(app *WebApp) http.HandlerFunc { return app.AdminHandler }},
+	{"POST /admin/calendar/delete/{id}", func(app *WebApp) http.HandlerFunc { return app.DeleteCalendarHandler }},
+	{"POST /admin/calendar/restore/{id}", func(app *WebApp) http.HandlerFunc { return app.RestoreCalendarHandler }},
+	{"POST /admin/calendar/purge/{id}", func(app *WebApp) http.HandlerFunc { return app.PurgeCalendarHandler }},
+	{"GET /admin/trash", func(app *WebApp) http.HandlerFunc { return app.AdminTrashHandler }},
+	{"GET /admin/calendar/{id}", func(app *WebApp) http.HandlerFunc { return app.AdminViewCalendarHandler }},
+	{"POST /admin/calendar/{id}", func(app *WebApp) http.HandlerFunc { return app.AdminUpdateCalendarHandler }},
+	{"GET /admin/retention", func(app *WebApp) http.HandlerFunc { return app.AdminRetentionHandler }},
+	{"GET /admin/limits", func(app *WebApp) http.HandlerFunc { return app.AdminLimitsHandler }},
+	{"GET /admin/tournaments", func(app *WebApp) http.HandlerFunc { return app.AdminTournamentsHandler }},
+	{"GET /admin/tournament/{id}/history", func(app *WebApp) http.HandlerFunc { return app.AdminTournamentHistoryHandler }},
+	// Unknown admin pages are not found for admins only
+	{"/admin/", func(app *WebApp) http.HandlerFunc { return app.NotFoundHandler }},
+}
+
+// RegisterAdminRoutes adds the admin pages behind RequireAdmin, and the
+// login and logout pages, to mux. Logins are limited by the "login" group.
+func (app *WebApp) RegisterAdminRoutes(mux *http.ServeMux) {
+	for _, route := range adminRoutes {
+		mux.Handle(route.pattern, app.RequireAdmin(route.handler(app)))
+	}
+	mux.HandleFunc("GET /admin/login", app.AdminLoginFormHandler)
+	mux.Handle("POST /admin/login", app.limits.Limit("login", app.AdminLoginHandler))
+	mux.HandleFunc("POST /admin/logout", app.AdminLogoutHandler)
+}
+
+// RequireAdmin only passes requests of admins on to next. Others are sent
+// to the login page, or rejected if they can't log in here.
+func (app *WebApp) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.auth.user(r) != "" {
+			// Admin pages show edit codes, they must not end up in caches
+			w.Header().Set("Cache-Control", "no-store")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if app.auth.proxyHeader != "" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Login required", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/admin/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+	})
+}
+
+// adminNext is where to go after logging in, only admin pages are allowed.
+func adminNext(next string) string {
+	u, err := url.Parse(next)
+	if err != nil || u.Scheme != "" || u.Host != "" || (u.Path != "/admin" && !strings.HasPrefix(u.Path, "/admin/")) {
+		return "/admin"
+	}
+	return next
+}
+
+func (app *WebApp) AdminLoginFormHandler(w http.ResponseWriter, r *http.Request) {
+	app.renderAdminLogin(w, r, http.StatusOK, "")
+}
+
+func (app *WebApp) AdminLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if app.auth.proxyHeader != "" {
+		http.Error(w, "Login is handled by the proxy", http.StatusNotFound)
+		return
+	}
+
+	token, err := app.auth.admins.Login(r.FormValue("username"), r.FormValue("password"), time.Now())
+	if errors.Is(err, service.InvalidLoginError) {
+		app.renderAdminLogin(w, r, http.StatusUnauthorized, "admin_login.invalid")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to log in admin: %v", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ADMIN_SESSION_COOKIE,
+		Value:    token,
+		Path:     "/admin",
+		MaxAge:   int(service.ADMIN_SESSION_DURATION.Seconds()),
+		HttpOnly: true,
+		Secure:   isHttps(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, adminNext(r.FormValue("next")), http.StatusSeeOther)
+}
+
+func (app *WebApp) AdminLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(ADMIN_SESSION_COOKIE); err == nil && app.auth.admins != nil {
+		if err := app.auth.admins.Logout(cookie.Value); err != nil {
+			log.Printf("Failed to log out admin: %v", err)
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ADMIN_SESSION_COOKIE,
+		Path:     "/admin",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHttps(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/?lang="+url.QueryEscape(GetLanguageFromContext(r.Context())), http.StatusSeeOther)
+}
+
+func (app *WebApp) renderAdminLogin(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if app.auth.proxyHeader != "" {
+		http.Error(w, "Login is handled by the proxy", http.StatusNotFound)
+		return
+	}
+
+	data := struct {
+		Lang      string
+		CsrfToken string
+		Next      string
+		Message   string
+	}{
+		Lang:      GetLanguageFromContext(r.Context()),
+		CsrfToken: csrfToken(w, r),
+		Next:      adminNext(r.FormValue("next")),
+		Message:   message,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := app.templates.ExecuteTemplate(w, "admin-login.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
+// isHttps tells whether the request reached us, or the proxy in front of
+// us, through TLS.
+func isHttps(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
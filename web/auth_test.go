@@ -0,0 +1,182 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAdminService struct {
+	sessions map[string]string
+}
+
+func (s *fakeAdminService) Login(username string, password string, now time.Time) (string, error) {
+	if username != "max" || password != "correct horse battery" {
+		return "", service.InvalidLoginError
+	}
+	s.sessions["token"] = username
+	return "token", nil
+}
+
+func (s *fakeAdminService) Session(token string, now time.Time) (string, error) {
+	return s.sessions[token], nil
+}
+
+func (s *fakeAdminService) Logout(token string) error {
+	delete(s.sessions, token)
+	return nil
+}
+
+// newAdminTestApp has no services, admin handlers reached by a test panic.
+func newAdminTestApp(auth *AdminAuth) (*WebApp, *http.ServeMux) {
+	app := NewWebApp(nil, nil, nil, nil, nil, auth, NewRateLimiter(nil, ""), time.Minute)
+	mux := http.NewServeMux()
+	app.RegisterAdminRoutes(mux)
+	return &app, mux
+}
+
+var wildcard = regexp.MustCompile(`\{[^}]+\}`)
+
+// adminRequest requests a page matching the pattern of the route.
+func adminRequest(route adminRoute) *http.Request {
+	method, path, found := strings.Cut(route.pattern, " ")
+	if !found {
+		method, path = http.MethodGet, route.pattern+"unknown"
+	}
+	return httptest.NewRequest(method, wildcard.ReplaceAllString(path, "1"), nil)
+}
+
+func TestAdminRoutesRequireLogin(t *testing.T) {
+	admins := &fakeAdminService{sessions: map[string]string{"token": "max"}}
+	_, mux := newAdminTestApp(NewLocalAdminAuth(admins))
+
+	for _, route := range adminRoutes {
+		t.Run(route.pattern, func(t *testing.T) {
+			for _, cookie := range []*http.Cookie{nil, {Name: ADMIN_SESSION_COOKIE, Value: "guessed"}} {
+				r := adminRequest(route)
+				if cookie != nil {
+					r.AddCookie(cookie)
+				}
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, r)
+
+				if r.Method == http.MethodGet {
+					assert.Equal(t, http.StatusSeeOther, w.Code)
+					assert.Equal(t, "/admin/login?next="+url.QueryEscape(r.URL.RequestURI()), w.Header().Get("Location"))
+				} else {
+					assert.Equal(t, http.StatusUnauthorized, w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminRoutesRequireProxyUser(t *testing.T) {
+	_, mux := newAdminTestApp(NewProxyAdminAuth("X-Forwarded-User", []string{"max"}))
+
+	for _, route := range adminRoutes {
+		t.Run(route.pattern, func(t *testing.T) {
+			for _, user := range []string{"", "moritz"} {
+				r := adminRequest(route)
+				r.Header.Set("X-Forwarded-User", user)
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, r)
+				assert.Equal(t, http.StatusForbidden, w.Code)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/login", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "no local login behind a proxy")
+}
+
+func TestRequireAdmin(t *testing.T) {
+	admins := &fakeAdminService{sessions: map[string]string{"token": "max"}}
+	local, _ := newAdminTestApp(NewLocalAdminAuth(admins))
+	proxy, _ := newAdminTestApp(NewProxyAdminAuth("X-Forwarded-User", nil))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	r.AddCookie(&http.Cookie{Name: ADMIN_SESSION_COOKIE, Value: "token"})
+	w := httptest.NewRecorder()
+	local.RequireAdmin(ok).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	r = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	r.Header.Set("X-Forwarded-User", "max")
+	w = httptest.NewRecorder()
+	local.RequireAdmin(ok).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code, "proxy header ignored for local users")
+
+	w = httptest.NewRecorder()
+	proxy.RequireAdmin(ok).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAdminLoginLogout(t *testing.T) {
+	admins := &fakeAdminService{sessions: map[string]string{}}
+	_, mux := newAdminTestApp(NewLocalAdminAuth(admins))
+
+	login := func(password string, next string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"max"}, "password": {password}, "next": {next}}
+		r := httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := login("wrong", "/admin/trash")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Benutzername oder Passwort ist falsch.")
+	for _, cookie := range w.Result().Cookies() {
+		assert.NotEqual(t, ADMIN_SESSION_COOKIE, cookie.Name)
+	}
+
+	w = login("correct horse battery", "/admin/trash")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/admin/trash", w.Header().Get("Location"))
+	require.Len(t, w.Result().Cookies(), 1)
+	cookie := w.Result().Cookies()[0]
+	assert.Equal(t, ADMIN_SESSION_COOKIE, cookie.Name)
+	assert.Equal(t, "token", cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite)
+
+	w = login("correct horse battery", "https://evil.example.com/admin")
+	assert.Equal(t, "/admin", w.Header().Get("Location"), "only redirects to admin pages")
+
+	r := httptest.NewRequest(http.MethodPost, "/admin/logout", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	require.Len(t, w.Result().Cookies(), 1)
+	assert.Equal(t, -1, w.Result().Cookies()[0].MaxAge)
+	assert.Empty(t, admins.sessions, "session ended")
+}
+
+func TestAdminNext(t *testing.T) {
+	for next, expected := range map[string]string{
+		"":                         "/admin",
+		"/admin":                   "/admin",
+		"/admin?deleted=cal":       "/admin?deleted=cal",
+		"/admin/calendar/cal":      "/admin/calendar/cal",
+		"/administrator":           "/admin",
+		"/calendar/new":            "/admin",
+		"//evil.example.com/admin": "/admin",
+		"https://evil.example.com": "/admin",
+	} {
+		assert.Equal(t, expected, adminNext(next), next)
+	}
+}
@@ -29,3 +29,54 @@ function toggleFilters() {
         textSpan.textContent = row.classList.contains('mobile-open') ? hideText : showText;
     }
 }
+
+// Pages bind their behavior through data attributes instead of inline event
+// handlers, which the Content-Security-Policy forbids
+document.addEventListener('click', function(e) {
+    if (e.target.closest('.mobile-menu-toggle')) {
+        toggleMobileMenu();
+    } else if (e.target.closest('.filters-toggle')) {
+        toggleFilters();
+    } else if (e.target.matches('[data-select-on-click]')) {
+        e.target.select();
+    } else if (e.target.closest('[data-copy]')) {
+        copyToClipboard(e.target.closest('[data-copy]'));
+    }
+});
+
+document.addEventListener('change', function(e) {
+    if (e.target.matches('.lang-select')) {
+        changeLanguage(e.target.value);
+    } else if (e.target.matches('[data-autosubmit]')) {
+        e.target.form.submit();
+    }
+});
+
+// Forms with data-confirm ask before they are submitted
+document.addEventListener('submit', function(e) {
+    const message = e.target.dataset.confirm;
+    if (message && !confirm(message)) {
+        e.preventDefault();
+    }
+});
+
+// Copy the value or text of the element with the id in data-copy, the button
+// shows data-copied for a moment
+function copyToClipboard(button) {
+    const source = document.getElementById(button.dataset.copy);
+    const text = 'value' in source ? source.value : source.textContent;
+    navigator.clipboard
+        .writeText(text.trim())
+        .then(() => {
+            const originalText = button.textContent;
+            button.textContent = button.dataset.copied;
+            button.classList.add('copied');
+            setTimeout(() => {
+                button.textContent = originalText;
+                button.classList.remove('copied');
+            }, 2000);
+        })
+        .catch((err) => {
+            alert('Failed to copy: ' + err);
+        });
+}
@@ -0,0 +1,561 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/resterle/dg-cal/v2/service"
+)
+
+// GRAPHQL_MAX_DEPTH limits the nesting of fields in a query, introspection
+// fields aside.
+const GRAPHQL_MAX_DEPTH = 8
+
+// GRAPHQL_MAX_COMPLEXITY limits the number of fields a query may resolve,
+// estimated by graphqlComplexity before it runs.
+const GRAPHQL_MAX_COMPLEXITY = 50000
+
+// GRAPHQL_LIST_SIZE is the estimated size of lists without a first argument,
+// like the registration phases of a tournament.
+const GRAPHQL_LIST_SIZE = 5
+
+const GRAPHQL_ERROR_TOO_COMPLEX = "QUERY_TOO_COMPLEX"
+const GRAPHQL_ERROR_TOO_DEEP = "QUERY_TOO_DEEP"
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// graphqlRegistration is a registration phase along with its tournament.
+type graphqlRegistration struct {
+	*model.Registration
+	tournament *model.Tournament
+}
+
+// newGraphqlSchema builds the read-only schema of /graphql on top of the
+// services. Calendars are only found by their public id, like their feeds.
+func newGraphqlSchema(tournaments TournamentServiceInterface, calendars CalendarServiceInterface) (graphql.Schema, error) {
+	var tournamentType, seriesType *graphql.Object
+
+	pageArgs := graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: API_DEFAULT_PAGE_SIZE,
+			Description:  fmt.Sprintf("Number of items, at most %d", API_MAX_PAGE_SIZE),
+		},
+		"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0, Description: "Number of items to skip"},
+	}
+
+	registrationType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Registration",
+		Description: "A registration phase of a tournament",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"title": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(graphqlRegistration).Title, nil
+					},
+				},
+				"startDate": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.DateTime),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(graphqlRegistration).StartDate, nil
+					},
+				},
+				"endDate": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.DateTime),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(graphqlRegistration).EndDate, nil
+					},
+				},
+				"tournament": &graphql.Field{
+					Type: graphql.NewNonNull(tournamentType),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(graphqlRegistration).tournament, nil
+					},
+				},
+			}
+		}),
+	})
+
+	tournamentType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Tournament",
+		Description: "A tournament of turniere.discgolf.de",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"title": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"status": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "PROVISIONAL, ANNOUNCED, REGISTRATION, IN PROGESS, DONE or CANCELLED",
+				},
+				"startDate": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"endDate":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"location": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.String),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return p.Source.(*model.Tournament).Localtion, nil
+					},
+				},
+				"geoLocation": &graphql.Field{
+					Type:        graphql.String,
+					Description: "Latitude and longitude, e.g. 52.5,13.4",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return optionalString(p.Source.(*model.Tournament).GeoLocation), nil
+					},
+				},
+				"pdgaTier": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return optionalString(p.Source.(*model.Tournament).PdgaTier), nil
+					},
+				},
+				"pdgaId": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return optionalString(p.Source.(*model.Tournament).PdgaId), nil
+					},
+				},
+				"dRating": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.Boolean),
+					Description: "Considered for the German rating",
+				},
+				"updatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"series": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(seriesType))),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return nonNil(p.Source.(*model.Tournament).Series), nil
+					},
+				},
+				"registrations": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(registrationType))),
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						t := p.Source.(*model.Tournament)
+						result := []graphqlRegistration{}
+						for _, r := range t.Registrations {
+							result = append(result, graphqlRegistration{Registration: r, tournament: t})
+						}
+						return result, nil
+					},
+				},
+				"history": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tournamentType))),
+					Description: "Earlier states of the tournament, newest first",
+					Args:        pageArgs,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						history, err := tournaments.GetTournamentHistory(p.Source.(*model.Tournament).Id)
+						if err != nil {
+							return nil, err
+						}
+						slices.SortFunc(history, func(a, b *model.Tournament) int { return b.UpdatedAt.Compare(a.UpdatedAt) })
+						return graphqlPage(history, p.Args)
+					},
+				},
+			}
+		}),
+	})
+
+	seriesType = graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Series",
+		Description: "A series of tournaments, like a league",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source, nil
+				},
+			},
+			"tournaments": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tournamentType))),
+				Description: "Tournaments of the series by start date",
+				Args:        pageArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					matcher, err := service.NewTournamentMatcher(model.SubscriptionConfig{Series: []string{p.Source.(string)}})
+					if err != nil {
+						return nil, err
+					}
+					result := tournaments.GetMatchingTournaments(matcher)
+					sortByStartDate(result)
+					return graphqlPage(result, p.Args)
+				},
+			},
+		},
+	})
+
+	calendarType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Calendar",
+		Description: "A calendar as seen by the subscribers of its feed",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "Public id of the calendar, part of its feed URL",
+			},
+			"title":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"updatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"series": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(seriesType))),
+				Description: "Series the calendar subscribes to",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return nonNil(p.Source.(*model.Calendar).Config.Series), nil
+				},
+			},
+			"tournaments": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tournamentType))),
+				Description: "Tournaments in the feed by start date",
+				Args:        pageArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					calendar := p.Source.(*model.Calendar)
+					matcher, err := calendars.GetMatcher(calendar.Id, *calendar.Config)
+					if err != nil {
+						return nil, err
+					}
+					result := tournaments.GetMatchingTournaments(matcher)
+					sortByStartDate(result)
+					return graphqlPage(result, p.Args)
+				},
+			},
+		},
+	})
+
+	tournamentsArgs := graphql.FieldConfigArgument{
+		"series":   &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"tier":     &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String)), Description: "PDGA tiers, e.g. B"},
+		"status":   &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"dRating":  &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Only tournaments considered for the German rating"},
+		"q":        &graphql.ArgumentConfig{Type: graphql.String, Description: "Part of the title, case insensitive"},
+		"location": &graphql.ArgumentConfig{Type: graphql.String, Description: "Part of the location, case insensitive"},
+		"from":     &graphql.ArgumentConfig{Type: graphql.String, Description: "Only tournaments ending on or after this date, like 2026-05-01"},
+		"to":       &graphql.ArgumentConfig{Type: graphql.String, Description: "Only tournaments starting on or before this date"},
+	}
+	for name, arg := range pageArgs {
+		tournamentsArgs[name] = arg
+	}
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"tournament": &graphql.Field{
+				Type: tournamentType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					if t := tournaments.GetTournament(p.Args["id"].(int)); t != nil {
+						return t, nil
+					}
+					return nil, nil
+				},
+			},
+			"tournaments": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tournamentType))),
+				Description: "Tournaments by start date, filtered like /api/v1/tournaments",
+				Args:        tournamentsArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					query := url.Values{}
+					for _, name := range []string{"series", "tier", "status"} {
+						if values, ok := p.Args[name].([]any); ok {
+							for _, v := range values {
+								query.Add(name, v.(string))
+							}
+						}
+					}
+					for _, name := range []string{"q", "location", "from", "to"} {
+						if value, ok := p.Args[name].(string); ok {
+							query.Set(name, value)
+						}
+					}
+					if dRating, ok := p.Args["dRating"].(bool); ok {
+						query.Set("drating", strconv.FormatBool(dRating))
+					}
+					matcher, err := apiTournamentFilter(query)
+					if err != nil {
+						return nil, err
+					}
+
+					result := tournaments.GetTournaments()
+					if matcher != nil {
+						result = tournaments.GetMatchingTournaments(matcher)
+					}
+					sortByStartDate(result)
+					return graphqlPage(result, p.Args)
+				},
+			},
+			"series": &graphql.Field{
+				Type: seriesType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					name := p.Args["name"].(string)
+					if slices.Contains(tournaments.GetAllSeries(false), name) {
+						return name, nil
+					}
+					return nil, nil
+				},
+			},
+			"allSeries": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(seriesType))),
+				Description: "Series in alphabetical order",
+				Args: graphql.FieldConfigArgument{
+					"active": &graphql.ArgumentConfig{
+						Type:         graphql.Boolean,
+						DefaultValue: true,
+						Description:  "Only series with tournaments that are neither done nor cancelled",
+					},
+					"first":  pageArgs["first"],
+					"offset": pageArgs["offset"],
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					series := tournaments.GetAllSeries(p.Args["active"].(bool))
+					slices.Sort(series)
+					return graphqlPage(series, p.Args)
+				},
+			},
+			"calendar": &graphql.Field{
+				Type: calendarType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{
+						Type:        graphql.NewNonNull(graphql.String),
+						Description: "Public id of the calendar, part of its feed URL",
+					},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					calendar, err := calendars.GetCalendar(service.CalendarId(p.Args["id"].(string)))
+					if err != nil || calendar == nil {
+						return nil, err
+					}
+					return calendar, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// GraphqlHandler runs read-only GraphQL queries, sent as JSON by POST or as
+// query parameters by GET. Queries beyond GRAPHQL_MAX_DEPTH or
+// GRAPHQL_MAX_COMPLEXITY are rejected before they run.
+func (app *WebApp) GraphqlHandler(w http.ResponseWriter, r *http.Request) {
+	var request graphqlRequest
+	if r.Method == http.MethodPost {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/json" {
+			writeGraphqlError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, API_MAX_BODY_SIZE)).Decode(&request); err != nil {
+			writeGraphqlError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+			return
+		}
+	} else {
+		query := r.URL.Query()
+		request.Query = query.Get("query")
+		request.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				writeGraphqlError(w, http.StatusBadRequest, "Invalid variables: "+err.Error())
+				return
+			}
+		}
+	}
+	if strings.TrimSpace(request.Query) == "" {
+		writeGraphqlError(w, http.StatusBadRequest, "Query is required")
+		return
+	}
+
+	writeJson(w, http.StatusOK, app.runGraphql(r, request))
+}
+
+func (app *WebApp) runGraphql(r *http.Request, request graphqlRequest) *graphql.Result {
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(request.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+	}
+	if validation := graphql.ValidateDocument(&app.graphqlSchema, document, nil); !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+	if err := graphqlComplexity(&app.graphqlSchema, document, request.OperationName, request.Variables); err != nil {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{*err}}
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        app.graphqlSchema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       r.Context(),
+	})
+}
+
+// graphqlComplexity estimates the fields resolved by the operation: one for
+// each field, times the first argument for the fields of list items.
+// Introspection is bounded by the schema and not counted.
+func graphqlComplexity(schema *graphql.Schema, document *ast.Document, operationName string, variables map[string]any) *gqlerrors.FormattedError {
+	fragments := map[string]*ast.FragmentDefinition{}
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch d := definition.(type) {
+		case *ast.FragmentDefinition:
+			fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operationName == "" || (d.Name != nil && d.Name.Value == operationName) {
+				operation = d
+			}
+		}
+	}
+	if operation == nil {
+		// Left to Execute to report
+		return nil
+	}
+
+	defaults := map[string]any{}
+	for _, definition := range operation.VariableDefinitions {
+		if value, ok := definition.DefaultValue.(*ast.IntValue); ok {
+			defaults[definition.Variable.Name.Value] = value.Value
+		}
+	}
+
+	var cost func(set *ast.SelectionSet, parent *graphql.Object, depth int) (int, *gqlerrors.FormattedError)
+	cost = func(set *ast.SelectionSet, parent *graphql.Object, depth int) (int, *gqlerrors.FormattedError) {
+		total := 0
+		for _, selection := range set.Selections {
+			var fields int
+			var err *gqlerrors.FormattedError
+			switch s := selection.(type) {
+			case *ast.Field:
+				name := s.Name.Value
+				if strings.HasPrefix(name, "__") {
+					continue
+				}
+				if depth > GRAPHQL_MAX_DEPTH {
+					return 0, graphqlLimitError(GRAPHQL_ERROR_TOO_DEEP, fmt.Sprintf("Query is nested deeper than %d fields", GRAPHQL_MAX_DEPTH))
+				}
+				definition := parent.Fields()[name]
+				fields = 1
+				if s.SelectionSet != nil {
+					object, _ := graphql.GetNamed(definition.Type).(*graphql.Object)
+					children, err := cost(s.SelectionSet, object, depth+1)
+					if err != nil {
+						return 0, err
+					}
+					fields += children * graphqlListSize(definition, s, variables, defaults)
+				}
+			case *ast.InlineFragment:
+				fields, err = cost(s.SelectionSet, graphqlFragmentType(schema, s.TypeCondition, parent), depth)
+			case *ast.FragmentSpread:
+				fragment := fragments[s.Name.Value]
+				fields, err = cost(fragment.SelectionSet, graphqlFragmentType(schema, fragment.TypeCondition, parent), depth)
+			}
+			if err != nil {
+				return 0, err
+			}
+			if total += fields; total > GRAPHQL_MAX_COMPLEXITY {
+				return 0, graphqlLimitError(GRAPHQL_ERROR_TOO_COMPLEX, fmt.Sprintf("Query resolves more than %d fields, ask for fewer items with first", GRAPHQL_MAX_COMPLEXITY))
+			}
+		}
+		return total, nil
+	}
+
+	_, err := cost(operation.SelectionSet, schema.QueryType(), 1)
+	return err
+}
+
+// graphqlListSize is the number of items estimated for a field, 1 unless it
+// is a list.
+func graphqlListSize(definition *graphql.FieldDefinition, field *ast.Field, variables map[string]any, defaults map[string]any) int {
+	t := definition.Type
+	if nonNull, ok := t.(*graphql.NonNull); ok {
+		t = nonNull.OfType
+	}
+	if _, ok := t.(*graphql.List); !ok {
+		return 1
+	}
+
+	for _, arg := range definition.Args {
+		if arg.Name() != "first" {
+			continue
+		}
+		size, _ := arg.DefaultValue.(int)
+		for _, a := range field.Arguments {
+			if a.Name.Value != "first" {
+				continue
+			}
+			var value any = a.Value.GetValue()
+			if variable, ok := a.Value.(*ast.Variable); ok {
+				name := variable.Name.Value
+				value = defaults[name]
+				if v, ok := variables[name]; ok {
+					value = v
+				}
+			}
+			switch v := value.(type) {
+			case string:
+				size, _ = strconv.Atoi(v)
+			case float64:
+				size = int(v)
+			case int:
+				size = v
+			}
+		}
+		// Larger values fail in the resolver
+		return min(max(size, 1), API_MAX_PAGE_SIZE)
+	}
+	return GRAPHQL_LIST_SIZE
+}
+
+func graphqlFragmentType(schema *graphql.Schema, condition *ast.Named, parent *graphql.Object) *graphql.Object {
+	if condition == nil {
+		return parent
+	}
+	if object, ok := schema.Type(condition.Name.Value).(*graphql.Object); ok {
+		return object
+	}
+	return parent
+}
+
+// graphqlPage applies the first and offset arguments.
+func graphqlPage[T any](items []T, args map[string]any) ([]T, error) {
+	first, offset := args["first"].(int), args["offset"].(int)
+	if first < 0 || first > API_MAX_PAGE_SIZE {
+		return nil, fmt.Errorf("first must be between 0 and %d", API_MAX_PAGE_SIZE)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("offset must not be negative")
+	}
+	start := min(offset, len(items))
+	end := min(start+first, len(items))
+	return items[start:end], nil
+}
+
+func optionalString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func graphqlLimitError(code string, message string) *gqlerrors.FormattedError {
+	return &gqlerrors.FormattedError{Message: message, Extensions: map[string]any{"code": code}}
+}
+
+func writeGraphqlError(w http.ResponseWriter, status int, message string) {
+	writeJson(w, status, graphql.Result{Errors: []gqlerrors.FormattedError{{Message: message}}})
+}
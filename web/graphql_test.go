@@ -0,0 +1,365 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql/testutil"
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/resterle/dg-cal/v2/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type graphqlTestError struct {
+	Message    string         `json:"message"`
+	Extensions map[string]any `json:"extensions"`
+}
+
+type graphqlTestResult struct {
+	Data   json.RawMessage    `json:"data"`
+	Errors []graphqlTestError `json:"errors"`
+}
+
+// graphqlQuery posts query and decodes the data of the response into data,
+// if given.
+func graphqlQuery(t *testing.T, server *httptest.Server, query string, variables map[string]any, data any) graphqlTestResult {
+	t.Helper()
+	body, err := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	require.NoError(t, err)
+
+	var result graphqlTestResult
+	resp := apiRequest(t, server, http.MethodPost, "/graphql", "", string(body), &result)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	if data != nil {
+		require.Empty(t, result.Errors)
+		require.NoError(t, json.Unmarshal(result.Data, data))
+	}
+	return result
+}
+
+// introspectionTypeRef is the type of a field or argument as returned by
+// introspection.
+type introspectionTypeRef struct {
+	Kind   string                `json:"kind"`
+	Name   string                `json:"name"`
+	OfType *introspectionTypeRef `json:"ofType"`
+}
+
+// String writes the type like the schema language, e.g. [Tournament!]!
+func (r *introspectionTypeRef) String() string {
+	switch r.Kind {
+	case "NON_NULL":
+		return r.OfType.String() + "!"
+	case "LIST":
+		return "[" + r.OfType.String() + "]"
+	}
+	return r.Name
+}
+
+type introspectionField struct {
+	Name string                `json:"name"`
+	Type *introspectionTypeRef `json:"type"`
+	Args []struct {
+		Name         string                `json:"name"`
+		Type         *introspectionTypeRef `json:"type"`
+		DefaultValue *string               `json:"defaultValue"`
+	} `json:"args"`
+}
+
+type introspectionSchema struct {
+	Schema struct {
+		QueryType        *struct{ Name string } `json:"queryType"`
+		MutationType     *struct{ Name string } `json:"mutationType"`
+		SubscriptionType *struct{ Name string } `json:"subscriptionType"`
+		Types            []struct {
+			Kind   string               `json:"kind"`
+			Name   string               `json:"name"`
+			Fields []introspectionField `json:"fields"`
+		} `json:"types"`
+	} `json:"__schema"`
+}
+
+// signatures describes the fields of a type like the schema language, with
+// the arguments sorted by name, e.g.
+// history(first: Int = 50, offset: Int = 0): [Tournament!]!
+func (s *introspectionSchema) signatures(name string) []string {
+	for _, t := range s.Schema.Types {
+		if t.Name != name {
+			continue
+		}
+		var result []string
+		for _, field := range t.Fields {
+			var args []string
+			for _, arg := range field.Args {
+				a := arg.Name + ": " + arg.Type.String()
+				if arg.DefaultValue != nil {
+					a += " = " + *arg.DefaultValue
+				}
+				args = append(args, a)
+			}
+			slices.Sort(args)
+			signature := field.Name
+			if len(args) > 0 {
+				signature += "(" + strings.Join(args, ", ") + ")"
+			}
+			result = append(result, signature+": "+field.Type.String())
+		}
+		return result
+	}
+	return nil
+}
+
+func TestGraphqlIntrospection(t *testing.T) {
+	server, _ := newApiTestServer(t)
+
+	var schema introspectionSchema
+	graphqlQuery(t, server, testutil.IntrospectionQuery, nil, &schema)
+
+	require.NotNil(t, schema.Schema.QueryType)
+	assert.Equal(t, "Query", schema.Schema.QueryType.Name)
+	assert.Nil(t, schema.Schema.MutationType, "read-only")
+	assert.Nil(t, schema.Schema.SubscriptionType)
+
+	page := "first: Int = 50, offset: Int = 0"
+	for name, fields := range map[string][]string{
+		"Query": {
+			"tournament(id: Int!): Tournament",
+			"tournaments(dRating: Boolean, first: Int = 50, from: String, location: String, offset: Int = 0, q: String, series: [String!], status: [String!], tier: [String!], to: String): [Tournament!]!",
+			"series(name: String!): Series",
+			"allSeries(active: Boolean = true, " + page + "): [Series!]!",
+			"calendar(id: String!): Calendar",
+		},
+		"Tournament": {
+			"id: Int!",
+			"title: String!",
+			"status: String!",
+			"startDate: DateTime!",
+			"endDate: DateTime!",
+			"location: String!",
+			"geoLocation: String",
+			"pdgaTier: String",
+			"pdgaId: String",
+			"dRating: Boolean!",
+			"updatedAt: DateTime!",
+			"series: [Series!]!",
+			"registrations: [Registration!]!",
+			"history(" + page + "): [Tournament!]!",
+		},
+		"Registration": {
+			"title: String!",
+			"startDate: DateTime!",
+			"endDate: DateTime!",
+			"tournament: Tournament!",
+		},
+		"Series": {
+			"name: String!",
+			"tournaments(" + page + "): [Tournament!]!",
+		},
+		"Calendar": {
+			"id: String!",
+			"title: String!",
+			"updatedAt: DateTime!",
+			"series: [Series!]!",
+			"tournaments(" + page + "): [Tournament!]!",
+		},
+	} {
+		assert.ElementsMatch(t, fields, schema.signatures(name), name)
+	}
+
+	var typ struct {
+		Type struct {
+			Description string `json:"description"`
+			Fields      []struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+			} `json:"fields"`
+		} `json:"__type"`
+	}
+	graphqlQuery(t, server, `{ __type(name: "Calendar") { description fields { name description } } }`, nil, &typ)
+	assert.NotEmpty(t, typ.Type.Description)
+	assert.Len(t, typ.Type.Fields, 5)
+}
+
+func TestGraphqlQuery(t *testing.T) {
+	server, _ := newApiTestServer(t)
+
+	var data struct {
+		AllSeries []struct {
+			Name        string
+			Tournaments []struct {
+				Id            int
+				Location      string
+				PdgaTier      *string
+				GeoLocation   *string
+				Series        []struct{ Name string }
+				Registrations []struct {
+					Title      string
+					StartDate  string
+					Tournament struct{ Id int }
+				}
+				History []struct{ Status string }
+			}
+		}
+	}
+	graphqlQuery(t, server, `{
+		allSeries(active: false, first: 10) {
+			name
+			tournaments(first: 10) {
+				id location pdgaTier geoLocation
+				series { name }
+				registrations { title startDate tournament { id } }
+				history(first: 5) { status }
+			}
+		}
+	}`, nil, &data)
+
+	require.Len(t, data.AllSeries, 2)
+	assert.Equal(t, "Liga Nord", data.AllSeries[0].Name)
+	nord := data.AllSeries[0].Tournaments
+	require.Len(t, nord, 2)
+	assert.Equal(t, []int{1, 3}, []int{nord[0].Id, nord[1].Id})
+	assert.Equal(t, "Berlin", nord[0].Location)
+	require.NotNil(t, nord[0].PdgaTier)
+	assert.Equal(t, "C", *nord[0].PdgaTier)
+	assert.Nil(t, nord[0].GeoLocation)
+	assert.Equal(t, "Liga Nord", nord[0].Series[0].Name)
+	require.Len(t, nord[0].Registrations, 1)
+	assert.Equal(t, "Phase 1", nord[0].Registrations[0].Title)
+	assert.Equal(t, "2030-04-08T10:00:00Z", nord[0].Registrations[0].StartDate)
+	assert.Equal(t, 1, nord[0].Registrations[0].Tournament.Id)
+	assert.NotNil(t, nord[0].History)
+
+	var filtered struct {
+		Tournaments []struct{ Id int }
+		Tournament  *struct{ Title string }
+		Missing     *struct{ Title string }
+		Series      *struct{ Name string }
+		Unknown     *struct{ Name string }
+	}
+	graphqlQuery(t, server, `query($tiers: [String!]) {
+		tournaments(tier: $tiers, dRating: true, first: 1) { id }
+		tournament(id: 3) { title }
+		missing: tournament(id: 99) { title }
+		series(name: "Liga Süd") { name }
+		unknown: series(name: "Liga West") { name }
+	}`, map[string]any{"tiers": []string{"B"}}, &filtered)
+	require.Len(t, filtered.Tournaments, 1)
+	assert.Equal(t, 2, filtered.Tournaments[0].Id)
+	require.NotNil(t, filtered.Tournament)
+	assert.Equal(t, "Open 3", filtered.Tournament.Title)
+	assert.Nil(t, filtered.Missing)
+	require.NotNil(t, filtered.Series)
+	assert.Nil(t, filtered.Unknown)
+
+	result := graphqlQuery(t, server, `{ tournaments(from: "May") { id } }`, nil, nil)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Message, "invalid date")
+
+	result = graphqlQuery(t, server, fmt.Sprintf(`{ tournaments(first: %d) { id } }`, API_MAX_PAGE_SIZE+1), nil, nil)
+	require.Len(t, result.Errors, 1)
+	assert.Contains(t, result.Errors[0].Message, "first must be")
+}
+
+func TestGraphqlCalendar(t *testing.T) {
+	server, calendars := newApiTestServer(t)
+
+	editId, err := calendars.CreateCalendar("Süden", model.SubscriptionConfig{Series: []string{"Liga Süd"}, Tournaments: []int{1}})
+	require.NoError(t, err)
+	calendar, err := calendars.GetCalendar(service.CalendarEditId(editId))
+	require.NoError(t, err)
+
+	query := `query($id: String!) { calendar(id: $id) { id title series { name } tournaments { id } } }`
+	var data struct {
+		Calendar *struct {
+			Id          string
+			Title       string
+			Series      []struct{ Name string }
+			Tournaments []struct{ Id int }
+		}
+	}
+	graphqlQuery(t, server, query, map[string]any{"id": calendar.Id}, &data)
+	require.NotNil(t, data.Calendar)
+	assert.Equal(t, calendar.Id, data.Calendar.Id)
+	assert.Equal(t, "Süden", data.Calendar.Title)
+	assert.Equal(t, []struct{ Name string }{{"Liga Süd"}}, data.Calendar.Series)
+	assert.Equal(t, []struct{ Id int }{{1}, {2}}, data.Calendar.Tournaments)
+
+	data.Calendar = nil
+	graphqlQuery(t, server, query, map[string]any{"id": editId}, &data)
+	assert.Nil(t, data.Calendar, "not found by the edit code")
+
+	require.NoError(t, calendars.DeleteCalendar(calendar.Id))
+	graphqlQuery(t, server, query, map[string]any{"id": calendar.Id}, &data)
+	assert.Nil(t, data.Calendar, "deleted")
+}
+
+func TestGraphqlLimits(t *testing.T) {
+	server, _ := newApiTestServer(t)
+
+	code := func(result graphqlTestResult) string {
+		require.Len(t, result.Errors, 1)
+		assert.JSONEq(t, "null", string(result.Data), "not executed")
+		return fmt.Sprint(result.Errors[0].Extensions["code"])
+	}
+
+	// 200 series with 200 tournaments each
+	tooMany := `{ allSeries(first: 200) { tournaments(first: 200) { id title } } }`
+	assert.Equal(t, GRAPHQL_ERROR_TOO_COMPLEX, code(graphqlQuery(t, server, tooMany, nil, nil)))
+
+	variables := `query($n: Int = 200) { allSeries(first: $n) { tournaments(first: $n) { id title } } }`
+	assert.Equal(t, GRAPHQL_ERROR_TOO_COMPLEX, code(graphqlQuery(t, server, variables, nil, nil)), "default of the variable")
+	assert.Empty(t, graphqlQuery(t, server, variables, map[string]any{"n": 10}, nil).Errors)
+
+	fragments := `{ allSeries(first: 200) { ...t } } fragment t on Series { tournaments(first: 200) { id title } }`
+	assert.Equal(t, GRAPHQL_ERROR_TOO_COMPLEX, code(graphqlQuery(t, server, fragments, nil, nil)), "through fragments")
+
+	assert.Empty(t, graphqlQuery(t, server, `{ allSeries { tournaments { id registrations { title } } } }`, nil, nil).Errors, "defaults are fine")
+	assert.Equal(t, GRAPHQL_ERROR_TOO_COMPLEX, code(graphqlQuery(t, server, `{ allSeries { tournaments { id history { id } } } }`, nil, nil)), "nested defaults aren't")
+
+	deep := "{ tournament(id: 1) { " + strings.Repeat("registrations { tournament { ", 4) + "id" + strings.Repeat(" } }", 4) + " } }"
+	assert.Equal(t, GRAPHQL_ERROR_TOO_DEEP, code(graphqlQuery(t, server, deep, nil, nil)))
+
+	assert.Empty(t, graphqlQuery(t, server, testutil.IntrospectionQuery, nil, nil).Errors, "introspection isn't limited")
+}
+
+func TestGraphqlHandler(t *testing.T) {
+	server, _ := newApiTestServer(t)
+
+	var result graphqlTestResult
+	resp := apiRequest(t, server, http.MethodGet, "/graphql?"+url.Values{
+		"query":     {"query($id: Int!) { tournament(id: $id) { title } }"},
+		"variables": {`{"id": 2}`},
+	}.Encode(), "", "", &result)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"tournament": {"title": "Open 2"}}`, string(result.Data))
+
+	result = graphqlQuery(t, server, `mutation { deleteCalendar(id: "x") }`, nil, nil)
+	assert.NotEmpty(t, result.Errors, "no mutations")
+	result = graphqlQuery(t, server, `{ tournament(id: 1) { rating } }`, nil, nil)
+	assert.NotEmpty(t, result.Errors, "validated")
+	result = graphqlQuery(t, server, `{ tournament(id: 1) {`, nil, nil)
+	assert.NotEmpty(t, result.Errors, "parsed")
+
+	for body, status := range map[string]int{
+		`{"query": ""}`: http.StatusBadRequest,
+		`{"query": `:    http.StatusBadRequest,
+	} {
+		result = graphqlTestResult{}
+		resp = apiRequest(t, server, http.MethodPost, "/graphql", "", body, &result)
+		assert.Equal(t, status, resp.StatusCode, body)
+		assert.NotEmpty(t, result.Errors, body)
+	}
+
+	// Cross-site forms can't post JSON, no CSRF token needed
+	resp, err := server.Client().Post(server.URL+"/graphql", "application/x-www-form-urlencoded", strings.NewReader("query={__typename}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
@@ -0,0 +1,78 @@
+const inputs = [
+    document.getElementById("group1"),
+    document.getElementById("group2"),
+    document.getElementById("group3"),
+    document.getElementById("group4"),
+];
+const submitBtn = document.getElementById("submitBtn");
+const errorMessage = document.getElementById("errorMessage");
+const editIdInput = document.getElementById("editId");
+
+// Auto-focus next input when current is filled
+inputs.forEach((input, index) => {
+    input.addEventListener("input", function (e) {
+        const value = e.target.value.toLowerCase();
+        e.target.value = value;
+
+        if (value.length === 4 && index < inputs.length - 1) {
+            inputs[index + 1].focus();
+        }
+
+        checkFormComplete();
+    });
+
+    // Handle backspace to go to previous input
+    input.addEventListener("keydown", function (e) {
+        if (
+            e.key === "Backspace" &&
+            e.target.value === "" &&
+            index > 0
+        ) {
+            inputs[index - 1].focus();
+        }
+    });
+
+    // Handle paste across all inputs
+    input.addEventListener("paste", function (e) {
+        e.preventDefault();
+        const pastedText = e.clipboardData
+            .getData("text")
+            .toLowerCase()
+            .replace(/[^a-z0-9]/g, "");
+
+        if (pastedText.length >= 16) {
+            inputs[0].value = pastedText.substr(0, 4);
+            inputs[1].value = pastedText.substr(4, 4);
+            inputs[2].value = pastedText.substr(8, 4);
+            inputs[3].value = pastedText.substr(12, 4);
+            checkFormComplete();
+        }
+    });
+});
+
+function checkFormComplete() {
+    const allFilled = inputs.every(
+        (input) => input.value.length === 4,
+    );
+    submitBtn.disabled = !allFilled;
+
+    if (allFilled) {
+        errorMessage.style.display = "none";
+        // Construct the edit ID
+        const editId = inputs.map((input) => input.value).join("");
+        editIdInput.value = editId;
+    }
+}
+
+// Prevent form submission if not complete
+document
+    .getElementById("accessForm")
+    .addEventListener("submit", function (e) {
+        if (submitBtn.disabled) {
+            e.preventDefault();
+            errorMessage.style.display = "block";
+        }
+    });
+
+// Focus first input on load
+inputs[0].focus();
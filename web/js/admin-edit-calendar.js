@@ -0,0 +1,66 @@
+let seriesSet = new Set(
+    Array.from(document.querySelectorAll("#seriesTags .series-tag"), (tag) => tag.dataset.series),
+);
+
+// Initialize form with existing series as hidden inputs
+document.addEventListener("DOMContentLoaded", function () {
+    seriesSet.forEach((series) => {
+        const hiddenInput = document.createElement("input");
+        hiddenInput.type = "hidden";
+        hiddenInput.name = "series";
+        hiddenInput.value = series;
+        hiddenInput.id = `series-${series.replace(/[^a-zA-Z0-9]/g, '_')}`;
+        document.getElementById("editForm").appendChild(hiddenInput);
+    });
+
+    document.getElementById("addSeries").addEventListener("click", addSeries);
+    document.getElementById("seriesTags").addEventListener("click", function (e) {
+        const tag = e.target.closest("button") && e.target.closest(".series-tag");
+        if (tag) {
+            removeSeries(tag, tag.dataset.series);
+        }
+    });
+});
+
+// Safe helper to create series tags without innerHTML
+function createSeriesTag(series) {
+    const tag = document.createElement("span");
+    tag.className = "series-tag";
+    tag.dataset.series = series;
+    tag.appendChild(document.createTextNode(series + " "));
+    const btn = document.createElement("button");
+    btn.type = "button";
+    btn.textContent = "×";
+    tag.appendChild(btn);
+    return tag;
+}
+
+function addSeries() {
+    const dropdown = document.getElementById("seriesDropdown");
+    const series = dropdown.value.trim();
+
+    if (series && !seriesSet.has(series)) {
+        seriesSet.add(series);
+        const tagsDiv = document.getElementById("seriesTags");
+        tagsDiv.appendChild(createSeriesTag(series));
+
+        // Add hidden input for form submission
+        const hiddenInput = document.createElement("input");
+        hiddenInput.type = "hidden";
+        hiddenInput.name = "series";
+        hiddenInput.value = series;
+        hiddenInput.id = `series-${series.replace(/[^a-zA-Z0-9]/g, '_')}`;
+        document.getElementById("editForm").appendChild(hiddenInput);
+
+        dropdown.selectedIndex = 0;
+    }
+}
+
+function removeSeries(tagElement, series) {
+    seriesSet.delete(series);
+    tagElement.remove();
+    const hiddenInput = document.getElementById(`series-${series.replace(/[^a-zA-Z0-9]/g, '_')}`);
+    if (hiddenInput) {
+        hiddenInput.remove();
+    }
+}
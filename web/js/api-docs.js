@@ -0,0 +1,163 @@
+// Renders the operations of the OpenAPI document, each with a form to try it
+// against this server.
+const operations = document.getElementById("apiOperations");
+const tokenInput = document.getElementById("apiToken");
+const labels = operations.dataset;
+
+function element(tag, className, text) {
+    const el = document.createElement(tag);
+    if (className) {
+        el.className = className;
+    }
+    if (text !== undefined) {
+        el.textContent = text;
+    }
+    return el;
+}
+
+// resolve follows a local $ref like #/components/parameters/page
+function resolve(spec, obj) {
+    if (!obj || !obj.$ref) {
+        return obj;
+    }
+    return obj.$ref.substring(2).split("/").reduce((o, key) => o[key], spec);
+}
+
+function schemaName(schema) {
+    if (!schema) {
+        return "";
+    }
+    if (schema.$ref) {
+        return schema.$ref.split("/").pop();
+    }
+    if (schema.type === "array") {
+        return schemaName(schema.items) + "[]";
+    }
+    return schema.type || "";
+}
+
+function exampleBody(spec, schema) {
+    schema = resolve(spec, schema);
+    const body = {};
+    Object.entries(schema.properties || {}).forEach(([name, property]) => {
+        property = resolve(spec, property);
+        if (property.type === "string") {
+            body[name] = "";
+        } else if (property.type === "array") {
+            body[name] = [];
+        } else if (property.type === "boolean") {
+            body[name] = false;
+        } else if (property.type === "integer") {
+            body[name] = 0;
+        } else {
+            body[name] = exampleBody(spec, property);
+        }
+    });
+    return body;
+}
+
+function renderOperation(spec, path, method, operation) {
+    const section = element("details", "api-operation");
+    const summary = element("summary");
+    summary.appendChild(element("span", "api-method api-method-" + method, method.toUpperCase()));
+    summary.appendChild(element("code", "api-path", path));
+    summary.appendChild(element("span", "api-summary", operation.summary));
+    section.appendChild(summary);
+
+    if (operation.description) {
+        section.appendChild(element("p", "", operation.description));
+    }
+    if (operation.security) {
+        section.appendChild(element("p", "api-auth", labels.auth));
+    }
+
+    const form = element("form", "api-form");
+    const parameters = (operation.parameters || []).map((p) => resolve(spec, p));
+    if (parameters.length > 0) {
+        form.appendChild(element("h3", "", labels.parameters));
+        parameters.forEach((parameter) => {
+            const label = element("label", "", parameter.name + " (" + schemaName(parameter.schema) + ")");
+            const input = element("input");
+            input.name = parameter.name;
+            input.dataset.in = parameter.in;
+            input.required = !!parameter.required;
+            input.placeholder = parameter.description || "";
+            label.appendChild(input);
+            form.appendChild(label);
+        });
+    }
+
+    let body = null;
+    if (operation.requestBody) {
+        form.appendChild(element("h3", "", labels.body));
+        const schema = operation.requestBody.content["application/json"].schema;
+        body = element("textarea", "api-body");
+        body.rows = 8;
+        body.value = JSON.stringify(exampleBody(spec, schema), null, 2);
+        form.appendChild(body);
+    }
+
+    form.appendChild(element("button", "", labels.send));
+    const response = element("pre", "api-response");
+    response.hidden = true;
+
+    form.addEventListener("submit", async function (e) {
+        e.preventDefault();
+        let url = path;
+        const query = new URLSearchParams();
+        form.querySelectorAll("input").forEach((input) => {
+            if (input.value === "") {
+                return;
+            }
+            if (input.dataset.in === "path") {
+                url = url.replace("{" + input.name + "}", encodeURIComponent(input.value));
+            } else {
+                input.value.split(",").forEach((v) => query.append(input.name, v.trim()));
+            }
+        });
+        if (query.toString() !== "") {
+            url += "?" + query.toString();
+        }
+
+        const headers = {};
+        if (operation.security && tokenInput.value.trim() !== "") {
+            headers["Authorization"] = "Bearer " + tokenInput.value.trim();
+        }
+        if (body) {
+            headers["Content-Type"] = "application/json";
+        }
+
+        response.hidden = false;
+        try {
+            const res = await fetch(url, { method: method.toUpperCase(), headers: headers, body: body ? body.value : undefined });
+            const text = await res.text();
+            let content = text;
+            try {
+                content = JSON.stringify(JSON.parse(text), null, 2);
+            } catch (err) {
+                // not JSON, e.g. the empty body of 204
+            }
+            response.textContent = labels.response + ": " + res.status + " " + res.statusText + "\n\n" + content;
+        } catch (err) {
+            response.textContent = err.message;
+        }
+    });
+
+    section.appendChild(form);
+    section.appendChild(response);
+    return section;
+}
+
+fetch("/api/openapi.json")
+    .then((res) => res.json())
+    .then((spec) => {
+        operations.replaceChildren();
+        Object.entries(spec.paths).forEach(([path, methods]) => {
+            Object.entries(methods).forEach(([method, operation]) => {
+                operations.appendChild(renderOperation(spec, path, method, operation));
+            });
+        });
+    })
+    .catch(() => {
+        operations.replaceChildren(element("p", "api-error", labels.error));
+    });
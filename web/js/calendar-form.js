@@ -0,0 +1,151 @@
+let seriesSet = new Set(
+    Array.from(document.querySelectorAll("#seriesTags .series-tag"), (tag) => tag.dataset.series),
+);
+
+// Initialize on page load
+document.addEventListener("DOMContentLoaded", function () {
+    // Populate series dropdown from tournament data
+    const allSeries = new Set(
+        Array.from(document.querySelectorAll(".tournament-item .series-badge"), (badge) => badge.textContent.trim()),
+    );
+
+    const dropdown = document.getElementById("seriesDropdown");
+    const sortedSeries = Array.from(allSeries).sort();
+    sortedSeries.forEach(series => {
+        const option = document.createElement("option");
+        option.value = series;
+        option.textContent = series;
+        dropdown.appendChild(option);
+    });
+
+    // Populate series filter dropdown
+    const seriesFilterDropdown = document.getElementById("seriesFilter");
+    sortedSeries.forEach(series => {
+        const option = document.createElement("option");
+        option.value = series;
+        option.textContent = series;
+        seriesFilterDropdown.appendChild(option);
+    });
+
+    // Initialize form with existing series as hidden inputs
+    seriesSet.forEach((series) => {
+        const hiddenInput = document.createElement("input");
+        hiddenInput.type = "hidden";
+        hiddenInput.name = "series";
+        hiddenInput.value = series;
+        hiddenInput.id = `series-${series}`;
+        document
+            .getElementById("editForm")
+            .appendChild(hiddenInput);
+    });
+
+    document.getElementById("addSeries").addEventListener("click", addSeries);
+    document.getElementById("seriesTags").addEventListener("click", function (e) {
+        const tag = e.target.closest("button") && e.target.closest(".series-tag");
+        if (tag) {
+            removeSeries(tag, tag.dataset.series);
+        }
+    });
+    document.getElementById("tournamentFilter").addEventListener("keyup", filterTournaments);
+    document.getElementById("seriesFilter").addEventListener("change", filterTournaments);
+
+    // Mark Sundays in red
+    document.querySelectorAll('.date-weekday').forEach(weekday => {
+        if (weekday.textContent.trim().toUpperCase() === 'SUN') {
+            weekday.classList.add('sunday');
+        }
+    });
+});
+
+// Safe helper to create series tags without innerHTML
+function createSeriesTag(series) {
+    const tag = document.createElement("span");
+    tag.className = "series-tag";
+    tag.dataset.series = series;
+    tag.appendChild(document.createTextNode(series + " "));
+    const btn = document.createElement("button");
+    btn.type = "button";
+    btn.textContent = "×";
+    tag.appendChild(btn);
+    return tag;
+}
+
+function addSeries() {
+    const dropdown = document.getElementById("seriesDropdown");
+    const series = dropdown.value.trim();
+
+    if (series && !seriesSet.has(series)) {
+        seriesSet.add(series);
+        const tagsDiv = document.getElementById("seriesTags");
+        tagsDiv.appendChild(createSeriesTag(series));
+
+        // Add hidden input for form submission
+        const hiddenInput = document.createElement("input");
+        hiddenInput.type = "hidden";
+        hiddenInput.name = "series";
+        hiddenInput.value = series;
+        hiddenInput.id = `series-${series}`;
+        document
+            .getElementById("editForm")
+            .appendChild(hiddenInput);
+
+        dropdown.selectedIndex = 0;
+        updatePreview();
+    }
+}
+
+function removeSeries(tagElement, series) {
+    seriesSet.delete(series);
+    tagElement.remove();
+    const hiddenInput = document.getElementById(`series-${series}`);
+    if (hiddenInput) {
+        hiddenInput.remove();
+    }
+    updatePreview();
+}
+
+function filterTournaments() {
+    const textFilter = document
+        .getElementById("tournamentFilter")
+        .value.toLowerCase();
+    const seriesFilter = document
+        .getElementById("seriesFilter")
+        .value;
+
+    const items = document.getElementsByClassName("tournament-item");
+
+    for (let item of items) {
+        const text = item.textContent.toLowerCase();
+        const seriesBadges = item.querySelectorAll(".series-badge");
+        const itemSeries = Array.from(seriesBadges).map(badge => badge.textContent.trim());
+
+        const matchesText = !textFilter || text.includes(textFilter);
+        const matchesSeries = !seriesFilter || itemSeries.includes(seriesFilter);
+
+        item.style.display = (matchesText && matchesSeries) ? "block" : "none";
+    }
+}
+
+// Count the tournaments matching the current form while editing
+let previewTimer;
+function updatePreview() {
+    clearTimeout(previewTimer);
+    previewTimer = setTimeout(function () {
+        const form = document.getElementById("editForm");
+        const preview = document.getElementById("rulePreview");
+        fetch("/calendar/preview", {
+            method: "POST",
+            body: new URLSearchParams(new FormData(form)),
+        })
+            .then((response) => response.json())
+            .then((result) => {
+                preview.classList.toggle("error", !!result.error);
+                preview.textContent = result.error
+                    ? result.error
+                    : form.dataset.previewCount.replace("{0}", result.count);
+            });
+    }, 300);
+}
+document.getElementById("editForm").addEventListener("input", updatePreview);
+document.getElementById("editForm").addEventListener("change", updatePreview);
+
@@ -0,0 +1,306 @@
+// Translations for sync time, see the data attributes of #sync-time
+const i18n = document.getElementById('sync-time').dataset;
+
+// Sync time display
+function updateSyncTime() {
+    const syncTimeEl = document.getElementById('sync-time');
+    const syncTextEl = document.getElementById('sync-text');
+    const syncIndicator = document.getElementById('sync-indicator');
+
+    if (!syncTimeEl || !syncTimeEl.dataset.iso) return;
+
+    const syncDate = new Date(syncTimeEl.dataset.iso);
+    const now = new Date();
+    const diffMs = now - syncDate;
+    const diffMins = Math.floor(diffMs / 60000);
+    const diffHours = Math.floor(diffMins / 60);
+
+    let relativeText;
+    if (diffMins < 1) {
+        relativeText = i18n.justNow;
+        syncIndicator.className = 'sync-indicator fresh';
+    } else if (diffMins === 1) {
+        relativeText = i18n.minuteAgo;
+        syncIndicator.className = 'sync-indicator fresh';
+    } else if (diffMins < 60) {
+        relativeText = i18n.minutesAgo.replace('{0}', diffMins);
+        syncIndicator.className = diffMins < 30 ? 'sync-indicator fresh' : 'sync-indicator recent';
+    } else if (diffHours === 1) {
+        relativeText = i18n.hourAgo;
+        syncIndicator.className = 'sync-indicator recent';
+    } else if (diffHours < 24) {
+        relativeText = i18n.hoursAgo.replace('{0}', diffHours);
+        syncIndicator.className = 'sync-indicator stale';
+    } else {
+        relativeText = syncDate.toLocaleDateString();
+        syncIndicator.className = 'sync-indicator stale';
+    }
+
+    syncTextEl.textContent = i18n.dataUpdated.replace('{0}', relativeText);
+}
+
+// Initialize table filters
+let tableFilter;
+let seriesSet;
+const selectedSeries = new Set();
+
+// Function to update divider visibility
+function updateDividerVisibility() {
+    const divider = document.querySelector('.registration-divider');
+    if (!divider) return;
+
+    // Check if there are visible open rows
+    const openRows = document.querySelectorAll('tr[data-status="open"]');
+    const hasVisibleOpen = Array.from(openRows).some(row => {
+        const style = window.getComputedStyle(row);
+        return style.display !== 'none';
+    });
+
+    // Check if there are visible upcoming rows
+    const upcomingRows = document.querySelectorAll('tr[data-status="upcoming"]');
+    const hasVisibleUpcoming = Array.from(upcomingRows).some(row => {
+        const style = window.getComputedStyle(row);
+        return style.display !== 'none';
+    });
+
+    // Show divider only if both sections have visible rows
+    divider.style.display = (hasVisibleOpen && hasVisibleUpcoming) ? '' : 'none';
+}
+
+// URL query parameter handling
+function updateUrlParams() {
+    const params = new URLSearchParams();
+
+    // Preserve lang parameter
+    const currentParams = new URLSearchParams(window.location.search);
+    if (currentParams.has('lang')) {
+        params.set('lang', currentParams.get('lang'));
+    }
+
+    // Search
+    const searchValue = document.getElementById('filter-search').value.trim();
+    if (searchValue) params.set('search', searchValue);
+
+    // Series (multi-select)
+    if (selectedSeries.size > 0) {
+        params.set('series', Array.from(selectedSeries).join(','));
+    }
+
+    // Status
+    const statusValue = document.getElementById('filter-status').value;
+    if (statusValue !== 'all') params.set('status', statusValue);
+
+    // Update URL without reload
+    const newUrl = params.toString() ? `${window.location.pathname}?${params.toString()}` : window.location.pathname;
+    window.history.replaceState({}, '', newUrl);
+}
+
+function loadFiltersFromUrl() {
+    const params = new URLSearchParams(window.location.search);
+
+    // Search
+    const searchValue = params.get('search');
+    if (searchValue) {
+        document.getElementById('filter-search').value = searchValue;
+        tableFilter.setFilterValue('search', searchValue);
+    }
+
+    // Series
+    const seriesParam = params.get('series');
+    if (seriesParam) {
+        seriesParam.split(',').forEach(value => {
+            if (seriesSet.has(value) && !selectedSeries.has(value)) {
+                selectedSeries.add(value);
+                // Remove from dropdown
+                const dropdown = document.getElementById('filter-series-dropdown');
+                for (let i = 1; i < dropdown.options.length; i++) {
+                    if (dropdown.options[i].value === value) {
+                        dropdown.remove(i);
+                        break;
+                    }
+                }
+            }
+        });
+        if (selectedSeries.size > 0) {
+            updateTagDisplay('series-tags', selectedSeries, removeSeriesFilter);
+            tableFilter.setFilterValue('series', true);
+        }
+    }
+
+    // Status
+    const statusParam = params.get('status');
+    if (statusParam) {
+        document.getElementById('filter-status').value = statusParam;
+        tableFilter.setFilterValue('status', statusParam);
+    }
+}
+
+document.addEventListener('DOMContentLoaded', function() {
+    // Update sync time display
+    updateSyncTime();
+    setInterval(updateSyncTime, 60000);
+
+    document.getElementById('filter-series-dropdown').addEventListener('change', addSeriesFilter);
+
+    tableFilter = new TableFilter('#registrations-table');
+
+    // Set callback to update divider after filtering
+    tableFilter.onFilterChange = updateDividerVisibility;
+
+    // Add search filter
+    tableFilter.addFilter('search', {
+        value: '',
+        fn: (row, value) => {
+            if (!value) return true;
+            return row.dataset.title.toLowerCase().includes(value.toLowerCase());
+        }
+    });
+
+    // Add series filter
+    tableFilter.addFilter('series', {
+        value: null,
+        fn: (row, value) => {
+            if (selectedSeries.size === 0) return true;
+            const rowSeries = row.dataset.series.split(',');
+            return Array.from(selectedSeries).some(s => rowSeries.includes(s));
+        }
+    });
+
+    // Add status filter
+    tableFilter.addFilter('status', {
+        value: 'all',
+        fn: (row, value) => {
+            if (value === 'all') return true;
+            return row.dataset.status === value;
+        }
+    });
+
+    // Populate series dropdown from table data
+    seriesSet = new Set();
+    tableFilter.rows.forEach(row => {
+        const series = row.dataset.series;
+        if (series) {
+            series.split(',').forEach(s => {
+                if (s.trim()) seriesSet.add(s.trim());
+            });
+        }
+    });
+    const seriesSelect = document.getElementById('filter-series-dropdown');
+    Array.from(seriesSet).sort().forEach(series => {
+        const option = document.createElement('option');
+        option.value = series;
+        option.textContent = series;
+        seriesSelect.appendChild(option);
+    });
+
+    // Load filters from URL params
+    loadFiltersFromUrl();
+
+    // Event listeners
+    document.getElementById('filter-search').addEventListener('input', (e) => {
+        tableFilter.setFilterValue('search', e.target.value.trim());
+        updateUrlParams();
+    });
+
+    document.getElementById('filter-status').addEventListener('change', (e) => {
+        tableFilter.setFilterValue('status', e.target.value);
+        updateUrlParams();
+    });
+
+    // Reset button
+    document.getElementById('reset-filters').addEventListener('click', () => {
+        // Clear search
+        document.getElementById('filter-search').value = '';
+
+        // Clear tags
+        document.getElementById('series-tags').textContent = '';
+
+        // Restore all options to series dropdown
+        const seriesDropdown = document.getElementById('filter-series-dropdown');
+        while (seriesDropdown.options.length > 1) {
+            seriesDropdown.remove(1);
+        }
+        Array.from(seriesSet).sort().forEach(series => {
+            const option = document.createElement('option');
+            option.value = series;
+            option.textContent = series;
+            seriesDropdown.appendChild(option);
+        });
+
+        // Clear selected sets
+        selectedSeries.clear();
+
+        // Reset dropdowns
+        seriesDropdown.selectedIndex = 0;
+        document.getElementById('filter-status').value = 'all';
+
+        tableFilter.reset();
+        updateUrlParams();
+    });
+});
+
+// Safe helper to create filter tags without innerHTML
+function createFilterTag(displayText, onRemove) {
+    const tag = document.createElement('span');
+    tag.className = 'filter-tag';
+    tag.appendChild(document.createTextNode(displayText + ' '));
+    const btn = document.createElement('button');
+    btn.type = 'button';
+    btn.textContent = '×';
+    btn.addEventListener('click', onRemove);
+    tag.appendChild(btn);
+    return tag;
+}
+
+function addSeriesFilter() {
+    const dropdown = document.getElementById('filter-series-dropdown');
+    const selectedOption = dropdown.options[dropdown.selectedIndex];
+    const value = dropdown.value.trim();
+
+    if (value && !selectedSeries.has(value)) {
+        selectedSeries.add(value);
+        const tagsDiv = document.getElementById('series-tags');
+        const tag = createFilterTag(value, () => removeSeriesFilter(value));
+        tagsDiv.appendChild(tag);
+
+        // Remove the option from dropdown
+        selectedOption.remove();
+        dropdown.selectedIndex = 0;
+        tableFilter.setFilterValue('series', true);
+        updateUrlParams();
+    }
+}
+
+function removeSeriesFilter(value) {
+    selectedSeries.delete(value);
+    updateTagDisplay('series-tags', selectedSeries, removeSeriesFilter);
+
+    // Add the option back to dropdown
+    const dropdown = document.getElementById('filter-series-dropdown');
+    const option = document.createElement('option');
+    option.value = value;
+    option.textContent = value;
+
+    // Insert in sorted order
+    const options = Array.from(dropdown.options).slice(1); // Skip first placeholder
+    options.push(option);
+    options.sort((a, b) => a.value.localeCompare(b.value));
+
+    // Clear and rebuild
+    while (dropdown.options.length > 1) {
+        dropdown.remove(1);
+    }
+    options.forEach(opt => dropdown.add(opt));
+
+    tableFilter.setFilterValue('series', true);
+    updateUrlParams();
+}
+
+function updateTagDisplay(tagsDivId, selectedSet, removeFn) {
+    const tagsDiv = document.getElementById(tagsDivId);
+    tagsDiv.textContent = '';
+    selectedSet.forEach(value => {
+        const tag = createFilterTag(value, () => removeFn(value));
+        tagsDiv.appendChild(tag);
+    });
+}
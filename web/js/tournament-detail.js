@@ -0,0 +1,13 @@
+// Smart back button - uses browser history
+document.addEventListener('DOMContentLoaded', function() {
+    const backButton = document.getElementById('back-button');
+
+    backButton.addEventListener('click', function(e) {
+        // Check if there's history to go back to
+        if (document.referrer && document.referrer.includes(window.location.host)) {
+            e.preventDefault();
+            history.back();
+        }
+        // Otherwise, fall through to the href default (/tournaments)
+    });
+});
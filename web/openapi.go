@@ -0,0 +1,35 @@
+package web
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+)
+
+// openApiSpec describes the endpoints of apiRoutes. It is written by hand,
+// TestOpenApiSpec keeps both in sync.
+//
+//go:embed openapi.json
+var openApiSpec []byte
+
+// OpenApiHandler serves the OpenAPI 3 document of the /api/v1 endpoints.
+func (app *WebApp) OpenApiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(openApiSpec)
+}
+
+// ApiDocsHandler shows the interactive documentation of the API, rendered by
+// js/api-docs.js from the OpenAPI document.
+func (app *WebApp) ApiDocsHandler(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Lang string
+	}{
+		Lang: GetLanguageFromContext(r.Context()),
+	}
+	if err := app.templates.ExecuteTemplate(w, "api-docs.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openApiSchema struct {
+	Ref        string                    `json:"$ref"`
+	Type       string                    `json:"type"`
+	Required   []string                  `json:"required"`
+	Properties map[string]*openApiSchema `json:"properties"`
+	Items      *openApiSchema            `json:"items"`
+	AllOf      []*openApiSchema          `json:"allOf"`
+}
+
+type openApiDocument struct {
+	OpenApi    string                               `json:"openapi"`
+	Paths      map[string]map[string]map[string]any `json:"paths"`
+	Components struct {
+		Schemas map[string]*openApiSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+func TestOpenApiSpec(t *testing.T) {
+	var spec openApiDocument
+	require.NoError(t, json.Unmarshal(openApiSpec, &spec))
+	assert.Equal(t, "3.0.3", spec.OpenApi)
+
+	var documented []string
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	var routes []string
+	for _, route := range apiRoutes {
+		if strings.Contains(route.pattern, " ") {
+			routes = append(routes, route.pattern)
+		}
+	}
+	slices.Sort(documented)
+	slices.Sort(routes)
+	assert.Equal(t, routes, documented, "every route is documented")
+
+	var raw any
+	require.NoError(t, json.Unmarshal(openApiSpec, &raw))
+	var refs []string
+	collectRefs(raw, &refs)
+	assert.NotEmpty(t, refs)
+	for _, ref := range refs {
+		var target any = raw
+		for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			object, ok := target.(map[string]any)
+			require.True(t, ok, ref)
+			target = object[key]
+		}
+		assert.NotNil(t, target, "%s resolves", ref)
+	}
+}
+
+// TestOpenApiSchemas compares the schemas with the JSON of the types the
+// handlers write.
+func TestOpenApiSchemas(t *testing.T) {
+	var spec openApiDocument
+	require.NoError(t, json.Unmarshal(openApiSpec, &spec))
+
+	for name, v := range map[string]any{
+		"ErrorResponse":    ApiErrorResponse{},
+		"Error":            ApiError{},
+		"Pagination":       ApiPagination{},
+		"Registration":     ApiRegistration{},
+		"Tournament":       ApiTournament{},
+		"TournamentDetail": ApiTournamentDetail{},
+		"TournamentPage":   ApiPage[ApiTournament]{},
+		"SeriesPage":       ApiPage[string]{},
+		"Rules":            ApiRules{},
+		"CalendarConfig":   ApiCalendarConfig{},
+		"Calendar":         ApiCalendar{},
+		"CalendarInput":    ApiCalendarInput{},
+		"CreatedCalendar":  ApiCreatedCalendar{},
+	} {
+		schema := spec.Components.Schemas[name]
+		require.NotNil(t, schema, name)
+		properties, required := map[string]bool{}, map[string]bool{}
+		for _, s := range append([]*openApiSchema{schema}, schema.AllOf...) {
+			if s.Ref != "" {
+				s = spec.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+			}
+			for property := range s.Properties {
+				properties[property] = true
+			}
+			for _, property := range s.Required {
+				required[property] = true
+			}
+		}
+
+		fields := map[string]bool{}
+		for field, omitempty := range jsonFields(reflect.TypeOf(v)) {
+			fields[field] = true
+			assert.True(t, properties[field], "%s.%s is documented", name, field)
+			if omitempty {
+				assert.False(t, required[field], "%s.%s is optional", name, field)
+			}
+		}
+		for property := range properties {
+			assert.True(t, fields[property], "%s.%s exists", name, property)
+		}
+	}
+}
+
+func TestOpenApiHandler(t *testing.T) {
+	app := NewWebApp(nil, nil, nil, nil, nil, nil, NewRateLimiter(nil, ""), 0)
+
+	w := httptest.NewRecorder()
+	app.OpenApiHandler(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, string(openApiSpec), w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.ApiDocsHandler(w, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<script src="/js/api-docs.js"></script>`)
+}
+
+func collectRefs(v any, refs *[]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				*refs = append(*refs, ref)
+			}
+			collectRefs(value, refs)
+		}
+	case []any:
+		for _, value := range v {
+			collectRefs(value, refs)
+		}
+	}
+}
+
+// jsonFields returns the JSON names of the fields of a struct, including
+// embedded ones, and whether they are omitted when empty.
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if field.Anonymous {
+			for name, omitempty := range jsonFields(field.Type) {
+				fields[name] = omitempty
+			}
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		fields[name] = options == "omitempty"
+	}
+	return fields
+}
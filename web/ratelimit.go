@@ -0,0 +1,350 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HONEYPOT_FIELD is hidden from people in the create form, bots filling in
+// every field reveal themselves.
+const HONEYPOT_FIELD = "website"
+
+// Failed edit code lookups of a client beyond LOCKOUT_FREE_FAILURES lock it
+// out for LOCKOUT_BASE, doubling with each further failure up to
+// LOCKOUT_MAX. Failures are forgotten after LOCKOUT_RESET without one.
+const LOCKOUT_FREE_FAILURES = 5
+const LOCKOUT_BASE = time.Minute
+const LOCKOUT_MAX = 24 * time.Hour
+const LOCKOUT_RESET = 24 * time.Hour
+
+var InvalidRateLimitError = errors.New("invalid rate limit, expected e.g. 10/m")
+
+// RateLimit allows Requests per Per, in bursts of up to Requests. The zero
+// value is unlimited.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+var rateLimitUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+}
+
+// ParseRateLimit reads limits like "10/m", with the units s, m, h and d.
+// Empty strings and "off" are unlimited.
+func ParseRateLimit(s string) (RateLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "off" {
+		return RateLimit{}, nil
+	}
+	requests, unit, found := strings.Cut(s, "/")
+	n, err := strconv.Atoi(requests)
+	per, ok := rateLimitUnits[unit]
+	if !found || err != nil || n <= 0 || !ok {
+		return RateLimit{}, InvalidRateLimitError
+	}
+	return RateLimit{Requests: n, Per: per}, nil
+}
+
+func (l RateLimit) Unlimited() bool {
+	return l.Requests <= 0
+}
+
+func (l RateLimit) String() string {
+	if l.Unlimited() {
+		return "off"
+	}
+	for unit, per := range rateLimitUnits {
+		if per == l.Per {
+			return fmt.Sprintf("%d/%s", l.Requests, unit)
+		}
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// RateLimitGroup limits the requests to the routes of a group, per client
+// and of all clients together.
+type RateLimitGroup struct {
+	Client RateLimit
+	Global RateLimit
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take removes a token from the bucket, or returns how long it takes until
+// one is available.
+func (b *tokenBucket) take(limit RateLimit, now time.Time) (bool, time.Duration) {
+	rate := float64(limit.Requests) / limit.Per.Seconds()
+	if b.updated.IsZero() {
+		b.tokens = float64(limit.Requests)
+	} else if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Requests), b.tokens+elapsed*rate)
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// full tells whether the bucket refilled completely, it can be forgotten.
+func (b *tokenBucket) full(limit RateLimit, now time.Time) bool {
+	return now.Sub(b.updated) >= limit.Per
+}
+
+type rateLimitGroup struct {
+	RateLimitGroup
+	global  tokenBucket
+	clients map[string]*tokenBucket
+	allowed int
+	limited int
+}
+
+type lockout struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// RateLimiter keeps its buckets and counters in memory, they start over with
+// every restart.
+type RateLimiter struct {
+	mu       sync.Mutex
+	groups   map[string]*rateLimitGroup
+	lockouts map[string]*lockout
+	// ipHeader holds the client address set by a proxy, RemoteAddr is used
+	// if empty
+	ipHeader  string
+	lockedOut int
+	honeypot  int
+}
+
+func NewRateLimiter(groups map[string]RateLimitGroup, ipHeader string) *RateLimiter {
+	l := &RateLimiter{
+		groups:   map[string]*rateLimitGroup{},
+		lockouts: map[string]*lockout{},
+		ipHeader: ipHeader,
+	}
+	for name, group := range groups {
+		l.groups[name] = &rateLimitGroup{RateLimitGroup: group, clients: map[string]*tokenBucket{}}
+	}
+	return l
+}
+
+// Limit rejects requests to next exceeding the limits of group. Routes of
+// unknown groups are unlimited.
+func (l *RateLimiter) Limit(group string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.allow(group, l.client(r), time.Now()); !ok {
+			tooManyRequests(w, r, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *RateLimiter) allow(name string, client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	group := l.groups[name]
+	if group == nil {
+		return true, 0
+	}
+
+	var bucket *tokenBucket
+	if !group.Client.Unlimited() {
+		bucket = group.clients[client]
+		if bucket == nil {
+			bucket = &tokenBucket{}
+			group.clients[client] = bucket
+		}
+		if ok, wait := bucket.take(group.Client, now); !ok {
+			group.limited++
+			return false, wait
+		}
+	}
+	if !group.Global.Unlimited() {
+		if ok, wait := group.global.take(group.Global, now); !ok {
+			// The request isn't made, the client keeps its token
+			if bucket != nil {
+				bucket.tokens++
+			}
+			group.limited++
+			return false, wait
+		}
+	}
+	group.allowed++
+	return true, 0
+}
+
+// LockedOut returns how long the client of r is still locked out after
+// failed edit code lookups.
+func (l *RateLimiter) LockedOut(r *http.Request, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := l.lockouts[l.client(r)]
+	if entry == nil || !entry.until.After(now) {
+		return 0
+	}
+	l.lockedOut++
+	return entry.until.Sub(now)
+}
+
+// Failed counts a failed edit code lookup of the client of r.
+func (l *RateLimiter) Failed(r *http.Request, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client := l.client(r)
+	entry := l.lockouts[client]
+	if entry == nil || now.Sub(entry.last) >= LOCKOUT_RESET {
+		entry = &lockout{}
+		l.lockouts[client] = entry
+	}
+	entry.failures++
+	entry.last = now
+	if excess := entry.failures - LOCKOUT_FREE_FAILURES; excess > 0 {
+		duration := LOCKOUT_MAX
+		if excess <= 30 {
+			duration = min(LOCKOUT_BASE<<(excess-1), LOCKOUT_MAX)
+		}
+		entry.until = now.Add(duration)
+	}
+}
+
+// Honeypot counts a request caught by the honeypot field.
+func (l *RateLimiter) Honeypot() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.honeypot++
+}
+
+// Prune forgets the clients that are back to their full limits and whose
+// failures are forgotten.
+func (l *RateLimiter) Prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, group := range l.groups {
+		for client, bucket := range group.clients {
+			if bucket.full(group.Client, now) {
+				delete(group.clients, client)
+			}
+		}
+	}
+	for client, entry := range l.lockouts {
+		if now.Sub(entry.last) >= LOCKOUT_RESET && !entry.until.After(now) {
+			delete(l.lockouts, client)
+		}
+	}
+}
+
+type RateLimitStats struct {
+	Groups []RateLimitGroupStats
+	// Lockouts are the clients with failed edit code lookups, most first
+	Lockouts []LockoutStats
+	// LockedOut counts the requests rejected because of lockouts
+	LockedOut int
+	Honeypot  int
+}
+
+type RateLimitGroupStats struct {
+	Name string
+	RateLimitGroup
+	Clients int
+	Allowed int
+	Limited int
+}
+
+type LockoutStats struct {
+	Client   string
+	Failures int
+	// Until is nil if the client isn't locked out
+	Until *time.Time
+}
+
+func (l *RateLimiter) Stats(now time.Time) RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := RateLimitStats{LockedOut: l.lockedOut, Honeypot: l.honeypot}
+	for name, group := range l.groups {
+		stats.Groups = append(stats.Groups, RateLimitGroupStats{
+			Name:           name,
+			RateLimitGroup: group.RateLimitGroup,
+			Clients:        len(group.clients),
+			Allowed:        group.allowed,
+			Limited:        group.limited,
+		})
+	}
+	sort.Slice(stats.Groups, func(i, j int) bool { return stats.Groups[i].Name < stats.Groups[j].Name })
+
+	for client, entry := range l.lockouts {
+		s := LockoutStats{Client: client, Failures: entry.failures}
+		if entry.until.After(now) {
+			until := entry.until
+			s.Until = &until
+		}
+		stats.Lockouts = append(stats.Lockouts, s)
+	}
+	sort.Slice(stats.Lockouts, func(i, j int) bool {
+		if stats.Lockouts[i].Failures != stats.Lockouts[j].Failures {
+			return stats.Lockouts[i].Failures > stats.Lockouts[j].Failures
+		}
+		return stats.Lockouts[i].Client < stats.Lockouts[j].Client
+	})
+	return stats
+}
+
+// client identifies the client of r by its address. IPv6 clients usually
+// get a whole /64 network, which counts as one client.
+func (l *RateLimiter) client(r *http.Request) string {
+	addr := ""
+	if l.ipHeader != "" {
+		// Proxies append the address they see to X-Forwarded-For
+		parts := strings.Split(r.Header.Get(l.ipHeader), ",")
+		addr = strings.TrimSpace(parts[len(parts)-1])
+	}
+	if addr == "" {
+		addr = r.RemoteAddr
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+	if ip.To4() == nil {
+		return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+	}
+	return ip.String()
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+		writeApiError(w, http.StatusTooManyRequests, API_ERROR_TOO_MANY_REQUESTS, "Too many requests, try again later")
+		return
+	}
+	http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+}
@@ -0,0 +1,138 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	for s, expected := range map[string]RateLimit{
+		"":      {},
+		"off":   {},
+		"10/m":  {Requests: 10, Per: time.Minute},
+		" 5/h ": {Requests: 5, Per: time.Hour},
+		"1/d":   {Requests: 1, Per: 24 * time.Hour},
+	} {
+		limit, err := ParseRateLimit(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, limit, s)
+	}
+	for _, s := range []string{"10", "10/y", "x/m", "0/m", "-1/s"} {
+		_, err := ParseRateLimit(s)
+		assert.ErrorIs(t, err, InvalidRateLimitError, s)
+	}
+
+	assert.Equal(t, "10/m", RateLimit{Requests: 10, Per: time.Minute}.String())
+	assert.Equal(t, "off", RateLimit{}.String())
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	limits := NewRateLimiter(map[string]RateLimitGroup{
+		"create": {Client: RateLimit{Requests: 2, Per: time.Minute}, Global: RateLimit{Requests: 3, Per: time.Minute}},
+	}, "")
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	ok, _ := limits.allow("create", "a", now)
+	assert.True(t, ok)
+	ok, _ = limits.allow("create", "a", now)
+	assert.True(t, ok)
+	ok, wait := limits.allow("create", "a", now)
+	assert.False(t, ok, "burst of the client used up")
+	assert.Equal(t, 30*time.Second, wait)
+
+	ok, _ = limits.allow("create", "b", now)
+	assert.True(t, ok)
+	ok, wait = limits.allow("create", "b", now)
+	assert.False(t, ok, "global burst used up")
+	assert.Equal(t, 20*time.Second, wait)
+
+	ok, _ = limits.allow("create", "a", now.Add(30*time.Second))
+	assert.True(t, ok, "refilled")
+	ok, _ = limits.allow("create", "b", now.Add(40*time.Second))
+	assert.True(t, ok, "kept its token when rejected globally")
+
+	ok, _ = limits.allow("unknown", "a", now)
+	assert.True(t, ok, "unknown groups are unlimited")
+
+	stats := limits.Stats(now)
+	require.Len(t, stats.Groups, 1)
+	assert.Equal(t, "create", stats.Groups[0].Name)
+	assert.Equal(t, 5, stats.Groups[0].Allowed)
+	assert.Equal(t, 2, stats.Groups[0].Limited)
+	assert.Equal(t, 2, stats.Groups[0].Clients)
+
+	limits.Prune(now.Add(time.Minute))
+	assert.Equal(t, 2, limits.Stats(now).Groups[0].Clients, "not refilled yet")
+	limits.Prune(now.Add(2 * time.Minute))
+	assert.Zero(t, limits.Stats(now).Groups[0].Clients)
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	limits := NewRateLimiter(map[string]RateLimitGroup{
+		"recover": {Client: RateLimit{Requests: 1, Per: time.Hour}},
+	}, "")
+	handler := limits.Limit("recover", func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/calendar/recover", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/calendar/recover", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimiterLockout(t *testing.T) {
+	limits := NewRateLimiter(nil, "")
+	r := httptest.NewRequest(http.MethodGet, "/calendar/edit/guess", nil)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for range LOCKOUT_FREE_FAILURES {
+		limits.Failed(r, now)
+	}
+	assert.Zero(t, limits.LockedOut(r, now))
+
+	limits.Failed(r, now)
+	assert.Equal(t, LOCKOUT_BASE, limits.LockedOut(r, now))
+	limits.Failed(r, now)
+	assert.Equal(t, 2*LOCKOUT_BASE, limits.LockedOut(r, now), "doubles")
+	assert.Zero(t, limits.LockedOut(r, now.Add(2*LOCKOUT_BASE)))
+
+	for range 20 {
+		limits.Failed(r, now)
+	}
+	assert.Equal(t, LOCKOUT_MAX, limits.LockedOut(r, now))
+
+	other := httptest.NewRequest(http.MethodGet, "/calendar/edit/guess", nil)
+	other.RemoteAddr = "192.0.2.2:1234"
+	assert.Zero(t, limits.LockedOut(other, now), "other clients aren't locked out")
+
+	stats := limits.Stats(now)
+	require.Len(t, stats.Lockouts, 1)
+	assert.Equal(t, 27, stats.Lockouts[0].Failures)
+	require.NotNil(t, stats.Lockouts[0].Until)
+	assert.Equal(t, 3, stats.LockedOut)
+
+	later := now.Add(LOCKOUT_MAX + LOCKOUT_RESET)
+	limits.Failed(r, later)
+	assert.Zero(t, limits.LockedOut(r, later), "failures forgotten")
+	limits.Prune(later.Add(LOCKOUT_RESET))
+	assert.Empty(t, limits.Stats(later).Lockouts)
+}
+
+func TestRateLimiterClient(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+	assert.Equal(t, "192.0.2.1", NewRateLimiter(nil, "").client(r), "header ignored without a proxy")
+	assert.Equal(t, "198.51.100.7", NewRateLimiter(nil, "X-Forwarded-For").client(r), "address seen by the proxy")
+
+	r.RemoteAddr = "[2001:db8:1:2:3:4:5:6]:1234"
+	assert.Equal(t, "2001:db8:1:2::/64", NewRateLimiter(nil, "").client(r))
+}
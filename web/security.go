@@ -0,0 +1,79 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const CSRF_COOKIE = "dgcal_csrf"
+
+// CSRF_FIELD is the form field, or header for scripts, carrying the CSRF
+// token, see the "csrf" template.
+const CSRF_FIELD = "csrf_token"
+const CSRF_HEADER = "X-CSRF-Token"
+
+// contentSecurityPolicy only allows scripts, styles and fonts served by us,
+// inline scripts, event handlers and style attributes are blocked. Data URLs
+// are the icons in common.css.
+const contentSecurityPolicy = "default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'"
+
+// SecurityMiddleware sets the security headers of all responses and rejects
+// requests changing something without the CSRF token of the session. The
+// API and GraphQL are exempt, they ignore cookies and only accept JSON.
+func SecurityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", contentSecurityPolicy)
+		// Edit codes are part of URLs, they must not leak to other sites
+		h.Set("Referrer-Policy", "same-origin")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		if isHttps(r) {
+			h.Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if !strings.HasPrefix(r.URL.Path, "/api/v1/") && r.URL.Path != "/graphql" && !validCsrfToken(r) {
+				http.Error(w, "Invalid CSRF token, reload the page and try again", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfToken returns the CSRF token of the session for the forms of a page.
+// Sessions without one get a new token in a cookie, so call it only once
+// per response and before writing the body.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(CSRF_COOKIE); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	token := rand.Text()
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRF_COOKIE,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   isHttps(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+func validCsrfToken(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRF_COOKIE)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	token := r.Header.Get(CSRF_HEADER)
+	if token == "" {
+		token = r.PostFormValue(CSRF_FIELD)
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) == 1
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	handler := SecurityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/calendar/edit/code", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, contentSecurityPolicy, w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "same-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"), "no HSTS over plain HTTP")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Contains(t, w.Header().Get("Strict-Transport-Security"), "max-age=")
+}
+
+func TestCsrfProtection(t *testing.T) {
+	handler := SecurityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	post := func(cookie string, field string, header string) int {
+		form := url.Values{"title": {"Cal"}}
+		if field != "" {
+			form.Set(CSRF_FIELD, field)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/calendar/create", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: CSRF_COOKIE, Value: cookie})
+		}
+		if header != "" {
+			r.Header.Set(CSRF_HEADER, header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, post("", "", ""))
+	assert.Equal(t, http.StatusForbidden, post("", "token", ""), "token without session")
+	assert.Equal(t, http.StatusForbidden, post("token", "", ""))
+	assert.Equal(t, http.StatusForbidden, post("token", "other", ""))
+	assert.Equal(t, http.StatusOK, post("token", "token", ""))
+	assert.Equal(t, http.StatusOK, post("token", "", "token"))
+}
+
+func TestCsrfToken(t *testing.T) {
+	w := httptest.NewRecorder()
+	token := csrfToken(w, httptest.NewRequest(http.MethodGet, "/calendar/new", nil))
+	require.NotEmpty(t, token)
+	require.Len(t, w.Result().Cookies(), 1)
+	cookie := w.Result().Cookies()[0]
+	assert.Equal(t, CSRF_COOKIE, cookie.Name)
+	assert.Equal(t, token, cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+
+	r := httptest.NewRequest(http.MethodGet, "/calendar/new", nil)
+	r.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	assert.Equal(t, token, csrfToken(w, r), "token of the session is kept")
+	assert.Empty(t, w.Result().Cookies())
+}
+
+// TestTemplatesCsp checks the templates for what the Content-Security-Policy
+// blocks and for POST forms without the CSRF token.
+func TestTemplatesCsp(t *testing.T) {
+	inline := regexp.MustCompile(`\son[a-z]+="|\sstyle="|<script>|<style`)
+	postForm := regexp.MustCompile(`(?s)<form[^>]*method="POST"[^>]*>\s*(\{\{template "csrf" \$\}\})?`)
+
+	files, err := fs.Glob(templatesFS, "templates/*.html")
+	require.NoError(t, err)
+	for _, file := range files {
+		content, err := fs.ReadFile(templatesFS, file)
+		require.NoError(t, err)
+
+		assert.Empty(t, inline.FindAllString(string(content), -1), file)
+		for _, form := range postForm.FindAllStringSubmatch(string(content), -1) {
+			assert.NotEmpty(t, form[1], "%s: %s", file, form[0])
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package web
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/resterle/dg-cal/v2/service"
+)
+
+const TOURNAMENT_LIST_DEFAULT_SORT = "startDate"
+
+var InvalidCursorError = errors.New("invalid cursor")
+
+// tournamentSorts are the orders of the sort parameter, ascending or with a
+// leading - descending. Ties are broken by id to keep pages stable.
+var tournamentSorts = map[string]func(a, b *model.Tournament) int{
+	"startDate": func(a, b *model.Tournament) int { return a.StartDate.Compare(b.StartDate) },
+	"endDate":   func(a, b *model.Tournament) int { return a.EndDate.Compare(b.EndDate) },
+	"updatedAt": func(a, b *model.Tournament) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+	"title":     func(a, b *model.Tournament) int { return strings.Compare(a.Title, b.Title) },
+	"id":        func(a, b *model.Tournament) int { return cmp.Compare(a.Id, b.Id) },
+}
+
+// tournamentCursor holds the sort keys of the last tournament of a page. It
+// is only valid for the generation of the tournaments it was created for.
+type tournamentCursor struct {
+	Sort       string    `json:"s"`
+	Generation int       `json:"g"`
+	Id         int       `json:"i"`
+	StartDate  time.Time `json:"sd,omitzero"`
+	EndDate    time.Time `json:"ed,omitzero"`
+	UpdatedAt  time.Time `json:"u,omitzero"`
+	Title      string    `json:"t,omitempty"`
+}
+
+// tournamentList reads the query parameters of TournamentHandler:
+//
+//   - from, to, status, series, tier, drating, q and location filter like
+//     ApiTournamentsHandler
+//   - updatedSince, a date or RFC 3339 time, keeps the tournaments updated
+//     at or after it
+//   - sort is one of tournamentSorts, startDate by default
+//   - limit is the number of tournaments per page, all without it. The Link
+//     header has the cursor of the next page, which is rejected once the
+//     tournaments changed.
+//   - fields lists the keys of the tournaments to return, comma separated
+type tournamentList struct {
+	matcher      *service.TournamentMatcher
+	generation   int
+	updatedSince *time.Time
+	sort         string
+	limit        int
+	cursor       *tournamentCursor
+	fields       []string
+}
+
+// parseTournamentList reads the query for the tournaments of generation.
+func parseTournamentList(query url.Values, generation int) (*tournamentList, error) {
+	matcher, err := apiTournamentFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	list := &tournamentList{matcher: matcher, generation: generation, sort: TOURNAMENT_LIST_DEFAULT_SORT}
+
+	if value := query.Get("updatedSince"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if since, err = time.Parse("2006-01-02", value); err != nil {
+				return nil, fmt.Errorf("invalid updatedSince %q", value)
+			}
+		}
+		list.updatedSince = &since
+	}
+
+	if value := query.Get("sort"); value != "" {
+		if _, ok := tournamentSorts[strings.TrimPrefix(value, "-")]; !ok {
+			return nil, fmt.Errorf("invalid sort %q", value)
+		}
+		list.sort = value
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > API_MAX_PAGE_SIZE {
+			return nil, fmt.Errorf("limit must be between 1 and %d", API_MAX_PAGE_SIZE)
+		}
+		list.limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		if list.cursor, err = decodeTournamentCursor(value); err != nil {
+			return nil, err
+		}
+		if list.cursor.Sort != list.sort {
+			return nil, fmt.Errorf("%w: created for sort %q", InvalidCursorError, list.cursor.Sort)
+		}
+		if list.cursor.Generation != generation {
+			return nil, fmt.Errorf("%w: the tournaments changed, start again without cursor", InvalidCursorError)
+		}
+	}
+
+	if value := query.Get("fields"); value != "" {
+		names := map[string]string{}
+		for _, field := range reflect.VisibleFields(reflect.TypeOf(model.Tournament{})) {
+			names[strings.ToLower(field.Name)] = field.Name
+		}
+		for _, field := range strings.Split(value, ",") {
+			name, ok := names[strings.ToLower(strings.TrimSpace(field))]
+			if !ok {
+				return nil, fmt.Errorf("unknown field %q", field)
+			}
+			list.fields = append(list.fields, name)
+		}
+	}
+	return list, nil
+}
+
+func (l *tournamentList) compare(a, b *model.Tournament) int {
+	c := tournamentSorts[strings.TrimPrefix(l.sort, "-")](a, b)
+	if strings.HasPrefix(l.sort, "-") {
+		c = -c
+	}
+	if c == 0 {
+		return cmp.Compare(a.Id, b.Id)
+	}
+	return c
+}
+
+// apply filters by updatedSince, sorts and returns the page after the
+// cursor, along with the cursor of the next page if there is one.
+func (l *tournamentList) apply(tournaments []*model.Tournament) ([]*model.Tournament, string) {
+	if l.updatedSince != nil {
+		tournaments = slices.DeleteFunc(tournaments, func(t *model.Tournament) bool {
+			return t.UpdatedAt.Before(*l.updatedSince)
+		})
+	}
+	slices.SortFunc(tournaments, l.compare)
+
+	if l.cursor != nil {
+		last := &model.Tournament{
+			Id:        l.cursor.Id,
+			StartDate: l.cursor.StartDate,
+			EndDate:   l.cursor.EndDate,
+			UpdatedAt: l.cursor.UpdatedAt,
+			Title:     l.cursor.Title,
+		}
+		start, found := slices.BinarySearchFunc(tournaments, last, l.compare)
+		if found {
+			start++
+		}
+		tournaments = tournaments[start:]
+	}
+
+	if l.limit == 0 || len(tournaments) <= l.limit {
+		return tournaments, ""
+	}
+	tournaments = tournaments[:l.limit]
+	return tournaments, l.encodeCursor(tournaments[len(tournaments)-1])
+}
+
+func (l *tournamentList) encodeCursor(t *model.Tournament) string {
+	cursor := tournamentCursor{Sort: l.sort, Generation: l.generation, Id: t.Id}
+	switch strings.TrimPrefix(l.sort, "-") {
+	case "startDate":
+		cursor.StartDate = t.StartDate
+	case "endDate":
+		cursor.EndDate = t.EndDate
+	case "updatedAt":
+		cursor.UpdatedAt = t.UpdatedAt
+	case "title":
+		cursor.Title = t.Title
+	}
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTournamentCursor(value string) (*tournamentCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, InvalidCursorError
+	}
+	var cursor tournamentCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, InvalidCursorError
+	}
+	return &cursor, nil
+}
+
+// selectFields returns the tournaments as they are, or only their keys in
+// fields.
+func (l *tournamentList) selectFields(tournaments []*model.Tournament) (any, error) {
+	if len(l.fields) == 0 {
+		return tournaments, nil
+	}
+	result := []map[string]json.RawMessage{}
+	for _, t := range tournaments {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(b, &all); err != nil {
+			return nil, err
+		}
+		selected := map[string]json.RawMessage{}
+		for _, field := range l.fields {
+			selected[field] = all[field]
+		}
+		result = append(result, selected)
+	}
+	return result, nil
+}
+
+// etagMatches reports whether the If-None-Match header lists etag.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/resterle/dg-cal/v2/db"
+	"github.com/resterle/dg-cal/v2/model"
+	"github.com/resterle/dg-cal/v2/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTournamentListApp(t *testing.T) (*WebApp, *service.TournamentService) {
+	repo, err := db.NewRepo(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(repo.Close)
+
+	tournaments, err := service.NewTournamentService(repo, &apiTestGto{})
+	require.NoError(t, err)
+	require.NoError(t, tournaments.Sync())
+	app := NewWebApp(tournaments, nil, nil, nil, nil, nil, NewRateLimiter(nil, ""), time.Minute)
+	return &app, tournaments
+}
+
+// listTournaments returns the ids of the tournaments, or with fields their
+// raw keys.
+func listTournaments(t *testing.T, app *WebApp, query string, header http.Header) (*httptest.ResponseRecorder, []int) {
+	r := httptest.NewRequest(http.MethodGet, "/api/tournaments"+query, nil)
+	for name := range header {
+		r.Header.Set(name, header.Get(name))
+	}
+	w := httptest.NewRecorder()
+	app.TournamentHandler(w, r)
+	if w.Code != http.StatusOK {
+		return w, nil
+	}
+
+	var tournaments []model.Tournament
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tournaments), w.Body.String())
+	ids := []int{}
+	for _, tournament := range tournaments {
+		ids = append(ids, tournament.Id)
+	}
+	return w, ids
+}
+
+func TestTournamentHandlerFilters(t *testing.T) {
+	app, _ := newTournamentListApp(t)
+
+	for query, expected := range map[string][]int{
+		"":                                   {1, 2, 3},
+		"?status=ANNOUNCED&status=CANCELLED": {2, 3},
+		"?series=Liga+S%C3%BCd":              {2},
+		"?tier=C":                            {1, 3},
+		"?drating=true":                      {2},
+		"?q=open+3":                          {3},
+		"?from=2030-05-16":                   {2, 3},
+		"?to=2030-05-10":                     {1},
+		"?updatedSince=2030-05-01":           {1, 2, 3},
+		"?updatedSince=2030-05-01T10:00:01Z": {},
+		"?sort=-startDate":                   {3, 2, 1},
+		"?sort=-id&tier=C":                   {3, 1},
+		"?sort=title":                        {1, 2, 3},
+	} {
+		w, ids := listTournaments(t, app, query, nil)
+		require.Equal(t, http.StatusOK, w.Code, query)
+		assert.Equal(t, expected, ids, query)
+	}
+
+	for _, query := range []string{"?from=May", "?updatedSince=yesterday", "?sort=rating", "?limit=0", "?cursor=x", "?fields=Id,Rating"} {
+		w, _ := listTournaments(t, app, query, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		var response ApiErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), query)
+		assert.Equal(t, API_ERROR_INVALID_REQUEST, response.Error.Code, query)
+	}
+}
+
+func TestTournamentHandlerCursor(t *testing.T) {
+	app, tournaments := newTournamentListApp(t)
+	generation := tournaments.GetGeneration()
+
+	w, ids := listTournaments(t, app, "?sort=-startDate&limit=2", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []int{3, 2}, ids)
+	link := regexp.MustCompile(`^<(/api/tournaments\?[^>]+)>; rel="next"$`).FindStringSubmatch(w.Header().Get("Link"))
+	require.NotNil(t, link, w.Header().Get("Link"))
+
+	w, ids = listTournaments(t, app, link[1][len("/api/tournaments"):], nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []int{1}, ids)
+	assert.Empty(t, w.Header().Get("Link"), "last page")
+
+	cursor := (&tournamentList{sort: "-startDate", generation: generation}).encodeCursor(&model.Tournament{Id: 3, StartDate: apiTestStart.AddDate(0, 0, 21)})
+	_, ids = listTournaments(t, app, "?sort=-startDate&cursor="+cursor, nil)
+	assert.Equal(t, []int{2, 1}, ids, "continues after the cursor")
+	w, _ = listTournaments(t, app, "?sort=title&cursor="+cursor, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "cursor of another sort")
+
+	gone := (&tournamentList{sort: "startDate", generation: generation}).encodeCursor(&model.Tournament{Id: 9, StartDate: apiTestStart.AddDate(0, 0, 10)})
+	_, ids = listTournaments(t, app, "?cursor="+gone, nil)
+	assert.Equal(t, []int{2, 3}, ids, "continues after a removed tournament")
+
+	stale := (&tournamentList{sort: "startDate", generation: generation - 1}).encodeCursor(&model.Tournament{Id: 1, StartDate: apiTestStart.AddDate(0, 0, 7)})
+	w, _ = listTournaments(t, app, "?cursor="+stale, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "cursor of changed tournaments")
+	assert.Contains(t, w.Body.String(), API_ERROR_INVALID_REQUEST)
+}
+
+func TestTournamentHandlerFields(t *testing.T) {
+	app, _ := newTournamentListApp(t)
+
+	w, _ := listTournaments(t, app, "?fields=id,+Title&status=ANNOUNCED", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"Id": 2, "Title": "Open 2"}]`, w.Body.String())
+}
+
+func TestTournamentHandlerEtag(t *testing.T) {
+	app, tournaments := newTournamentListApp(t)
+
+	w, _ := listTournaments(t, app, "", nil)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.NotEmpty(t, w.Header().Get("Cache-Control"))
+
+	w, _ = listTournaments(t, app, "?tier=B", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	require.NoError(t, tournaments.Sync())
+	w, _ = listTournaments(t, app, "", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code, "sync without changes")
+
+	app.started = app.started.Add(-time.Hour)
+	w, _ = listTournaments(t, app, "", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, w.Code, "generation of an earlier run")
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
@@ -4,15 +4,20 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"path"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/graphql-go/graphql"
 	"github.com/resterle/dg-cal/v2/model"
 	"github.com/resterle/dg-cal/v2/service"
 )
@@ -38,14 +43,24 @@ var faviconSVG []byte
 //go:embed fonts/*.woff2
 var fontsFS embed.FS
 
+//go:embed js/*.js
+var scriptsFS embed.FS
+
 type WebApp struct {
 	calendaeService   CalendarServiceInterface
 	tournamentService TournamentServiceInterface
 	icsService        IcsServiceInterface
+	notifications     NotificationServiceInterface
+	retention         RetentionServiceInterface
+	auth              *AdminAuth
+	limits            *RateLimiter
 	templates         *template.Template
 	translator        *Translator
 	loc               *time.Location
 	syncInterval      time.Duration
+	// started tells generations of tournaments of earlier runs apart
+	started       time.Time
+	graphqlSchema graphql.Schema
 }
 
 type CalendarServiceInterface interface {
@@ -55,21 +70,63 @@ type CalendarServiceInterface interface {
 	GetUpdateCount() (map[int]int, error)
 	GetAllCalendars() ([]*model.Calendar, error)
 	DeleteCalendar(id string) error
+	RestoreCalendar(id string) error
+	PurgeCalendar(id string) error
+	GetDeletedCalendars() ([]*model.Calendar, error)
+	GetMatcher(id string, config model.SubscriptionConfig) (*service.TournamentMatcher, error)
+	GetAttendance(calendar *model.Calendar) (map[int]string, error)
+	SetAttendance(calendar *model.Calendar, tournamentId int, status string) error
+	GetNotes(calendar *model.Calendar) (map[int]string, error)
+	SetNotes(calendar *model.Calendar, notes map[int]string) error
+	GetConflicts(calendar *model.Calendar, tournaments []*model.Tournament) ([]service.Conflict, error)
+	RotateEditId(calendar *model.Calendar) (string, error)
+	RotateId(calendar *model.Calendar, grace time.Duration) (string, error)
+	ResolveCalendarId(id string, now time.Time) (string, error)
+	GetEditor(secret string) (*model.Calendar, *model.Editor, error)
+	GetEditors(calendar *model.Calendar) ([]*model.Editor, error)
+	InviteEditor(calendar *model.Calendar, name string, role string) (*model.Editor, error)
+	AcceptInvite(token string) (*model.Editor, error)
+	RevokeEditor(calendar *model.Calendar, editorId int) error
+	RotateEditorSecret(calendar *model.Calendar, editor *model.Editor) (string, error)
+	RecordChange(calendar *model.Calendar, editor *model.Editor, oldTitle string, old model.SubscriptionConfig) error
+	GetAuditLog(calendar *model.Calendar) ([]*model.AuditEntry, error)
+	GetVersions(calendar *model.Calendar) ([]service.CalendarVersion, error)
+	RestoreVersion(calendar *model.Calendar, editor *model.Editor, versionId int) error
+	RecordRetrieval(calendarId string, userAgent string, status int, at time.Time) error
+	GetFeedStats(calendar *model.Calendar, now time.Time) (*service.FeedStats, error)
+	GetClientStats(now time.Time) ([]*model.ClientStats, error)
 }
 
 type TournamentServiceInterface interface {
 	GetTournaments() []*model.Tournament
+	GetMatchingTournaments(m *service.TournamentMatcher) []*model.Tournament
 	GetTournament(id int) *model.Tournament
 	GetAllSeries(active ...bool) []string
 	GetTournamentHistory(tournamentId int) ([]*model.Tournament, error)
 	GetLastSync() *time.Time
+	GetGeneration() int
 }
 
 type IcsServiceInterface interface {
-	CreateIcs(id string) (string, error)
+	CreateIcs(id string, profile service.IcsProfile, format string) (*service.IcsFeed, error)
+	CreateSeriesIcs(name string, profile service.IcsProfile, format string) (*service.IcsFeed, error)
+	CreateTournamentIcs(id int, profile service.IcsProfile, format string) (*service.IcsFeed, error)
+}
+
+type NotificationServiceInterface interface {
+	RequestEmail(calendar *model.Calendar, email string, now time.Time) error
+	ConfirmEmail(token string, now time.Time) (*model.Calendar, error)
+	Unsubscribe(token string) (bool, error)
+	RecoverEditLinks(email string, now time.Time) error
+	RenewEditCodes(token string, now time.Time) (bool, error)
+}
+
+type RetentionServiceInterface interface {
+	Policy() service.RetentionPolicy
+	Plan(now time.Time) ([]service.RetentionAction, error)
 }
 
-func NewWebApp(tournamentService TournamentServiceInterface, calendarService CalendarServiceInterface, icsService IcsServiceInterface, syncInterval time.Duration) WebApp {
+func NewWebApp(tournamentService TournamentServiceInterface, calendarService CalendarServiceInterface, icsService IcsServiceInterface, notifications NotificationServiceInterface, retention RetentionServiceInterface, auth *AdminAuth, limits *RateLimiter, syncInterval time.Duration) WebApp {
 	// Initialize translator with English as default language
 	translator := NewTranslator(defaultLang)
 
@@ -84,6 +141,9 @@ func NewWebApp(tournamentService TournamentServiceInterface, calendarService Cal
 		"contains": func(slice []int, item int) bool {
 			return slices.Contains(slice, item)
 		},
+		"containsString": func(slice []string, item string) bool {
+			return slices.Contains(slice, item)
+		},
 		"formatDate": func(t any) string {
 			if date, ok := t.(time.Time); ok {
 				return date.Format("2006-01-02")
@@ -172,7 +232,12 @@ func NewWebApp(tournamentService TournamentServiceInterface, calendarService Cal
 			}
 			return status
 		},
-		"join": strings.Join,
+		"join":       strings.Join,
+		"pathEscape": url.PathEscape,
+		// html/template rejects the webcal scheme unless it is marked safe
+		"webcal": func(host string, path string) template.URL {
+			return template.URL("webcal://" + host + path)
+		},
 		"dict": func(values ...interface{}) (map[string]interface{}, error) {
 			if len(values)%2 != 0 {
 				return nil, fmt.Errorf("dict requires an even number of arguments")
@@ -196,18 +261,53 @@ func NewWebApp(tournamentService TournamentServiceInterface, calendarService Cal
 			// Format as xxxx-xxxx-xxxx-xxxx
 			return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
 		},
+		"timeAgo": func(t any, lang string) string {
+			if p, ok := t.(*time.Time); ok && p != nil {
+				t = *p
+			}
+			date, ok := t.(time.Time)
+			if !ok {
+				return ""
+			}
+			since := time.Since(date)
+			switch {
+			case since < time.Minute:
+				return translator.T(lang, "time.just_now")
+			case since < 2*time.Minute:
+				return translator.T(lang, "time.minute_ago")
+			case since < time.Hour:
+				return translator.TWithArgs(lang, "time.minutes_ago", int(since.Minutes()))
+			case since < 2*time.Hour:
+				return translator.T(lang, "time.hour_ago")
+			case since < 24*time.Hour:
+				return translator.TWithArgs(lang, "time.hours_ago", int(since.Hours()))
+			case since < 48*time.Hour:
+				return translator.T(lang, "time.day_ago")
+			}
+			return translator.TWithArgs(lang, "time.days_ago", int(since.Hours()/24))
+		},
 	}
 
 	loc, _ := time.LoadLocation("Europe/Berlin")
 	templates := template.Must(template.New("").Funcs(funcMap).ParseFS(templatesFS, "templates/*.html"))
+	graphqlSchema, err := newGraphqlSchema(tournamentService, calendarService)
+	if err != nil {
+		panic(err)
+	}
 	return WebApp{
 		tournamentService: tournamentService,
 		calendaeService:   calendarService,
 		icsService:        icsService,
+		notifications:     notifications,
+		retention:         retention,
+		auth:              auth,
+		limits:            limits,
 		templates:         templates,
 		translator:        translator,
 		loc:               loc,
 		syncInterval:      syncInterval,
+		started:           time.Now(),
+		graphqlSchema:     graphqlSchema,
 	}
 }
 
@@ -236,6 +336,7 @@ type TournamentYearGroup struct {
 
 type TournamentsPageData struct {
 	Lang        string
+	Host        string
 	LastSync    string
 	LastSyncISO string
 	Groups      []TournamentYearGroup
@@ -330,6 +431,7 @@ func (app *WebApp) TournamentsHandler(w http.ResponseWriter, r *http.Request) {
 
 	data := TournamentsPageData{
 		Lang:        GetLanguageFromContext(r.Context()),
+		Host:        r.Host,
 		Groups:      groups,
 		LastSync:    app.lastSync(),
 		LastSyncISO: app.lastSyncISO(),
@@ -475,19 +577,62 @@ func (app *WebApp) RegistrationsHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// TournamentHandler lists the tournaments as stored, see tournamentList for
+// the query parameters. The ETag changes with every sync that changed a
+// tournament, so pollers get 304 until then.
 func (app *WebApp) TournamentHandler(w http.ResponseWriter, r *http.Request) {
-	tournaments := app.tournamentService.GetTournaments()
-	w.Header().Set("Content-Type", "application/json")
+	generation := app.tournamentService.GetGeneration()
+	list, err := parseTournamentList(r.URL.Query(), generation)
+	if err != nil {
+		writeApiError(w, http.StatusBadRequest, API_ERROR_INVALID_REQUEST, err.Error())
+		return
+	}
+
+	etag := fmt.Sprintf("\"%d-%d\"", app.started.Unix(), generation)
+	w.Header().Set("ETag", etag)
 	app.addCachingHeader(w)
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(tournaments); err != nil {
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	tournaments := app.tournamentService.GetTournaments()
+	if list.matcher != nil {
+		tournaments = app.tournamentService.GetMatchingTournaments(list.matcher)
+	}
+	tournaments, next := list.apply(tournaments)
+
+	result, err := list.selectFields(tournaments)
+	var body []byte
+	if err == nil {
+		body, err = json.Marshal(result)
+	}
+	if err != nil {
+		log.Printf("Failed to encode tournaments: %v", err)
 		app.removeCachingHeader(w)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		w.Header().Del("ETag")
+		writeApiError(w, http.StatusInternalServerError, API_ERROR_INTERNAL, "Failed to encode tournaments")
+		return
 	}
+
+	if next != "" {
+		nextQuery := r.URL.Query()
+		nextQuery.Set("cursor", next)
+		w.Header().Set("Link", fmt.Sprintf("<%s?%s>; rel=\"next\"", r.URL.Path, nextQuery.Encode()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
 }
 
 func (app *WebApp) CreateCalendarFormHandler(w http.ResponseWriter, r *http.Request) {
-	data := struct{ Lang string }{Lang: GetLanguageFromContext(r.Context())}
+	data := struct {
+		Lang      string
+		CsrfToken string
+	}{
+		Lang:      GetLanguageFromContext(r.Context()),
+		CsrfToken: csrfToken(w, r),
+	}
 	if err := app.templates.ExecuteTemplate(w, "create-calendar.html", data); err != nil {
 		log.Printf("Template execution error: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -500,6 +645,12 @@ func (app *WebApp) CreateCalendarHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if r.FormValue(HONEYPOT_FIELD) != "" {
+		app.limits.Honeypot()
+		http.Error(w, "Calendar could not be created", http.StatusBadRequest)
+		return
+	}
+
 	title := r.FormValue("title")
 	if title == "" {
 		http.Error(w, "Title is required", http.StatusBadRequest)
@@ -538,11 +689,126 @@ func (app *WebApp) CalendarCreatedHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (app *WebApp) IcsHandler(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
+	id, format := feedFormat(r, r.PathValue("id"))
 
-	log.Printf("=> %+v", r.Header)
+	profile, ok := icsProfile(r)
+	if !ok {
+		http.Error(w, "Unknown profile", http.StatusBadRequest)
+		return
+	}
 
-	result, err := app.icsService.CreateIcs(id)
+	feed, err := app.icsService.CreateIcs(id, profile, format)
+	if err == service.NotFoundError {
+		// Revoked ids redirect to the new one during their grace period
+		newId, err := app.calendaeService.ResolveCalendarId(id, time.Now())
+		if errors.Is(err, service.CalendarGoneError) {
+			http.Error(w, "Calendar URL was revoked", http.StatusGone)
+			return
+		}
+		if err == nil && newId != "" {
+			target := strings.Replace(r.URL.Path, id, newId, 1)
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			app.recordRetrieval(newId, r, http.StatusMovedPermanently)
+			return
+		}
+	}
+
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	app.writeIcs(sw, r, feed, err, format, "tournaments")
+	if err != service.NotFoundError {
+		app.recordRetrieval(id, r, sw.status)
+	}
+}
+
+func (app *WebApp) recordRetrieval(calendarId string, r *http.Request, status int) {
+	if err := app.calendaeService.RecordRetrieval(calendarId, r.UserAgent(), status, time.Now()); err != nil {
+		log.Printf("Could not record retrieval of calendar %s: %s", calendarId, err.Error())
+	}
+}
+
+// statusWriter remembers the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (app *WebApp) SeriesIcsHandler(w http.ResponseWriter, r *http.Request) {
+	name, format := feedFormat(r, r.PathValue("name"))
+
+	profile, ok := icsProfile(r)
+	if !ok {
+		http.Error(w, "Unknown profile", http.StatusBadRequest)
+		return
+	}
+
+	feed, err := app.icsService.CreateSeriesIcs(name, profile, format)
+	app.writeIcs(w, r, feed, err, format, "series")
+}
+
+func (app *WebApp) TournamentIcsHandler(w http.ResponseWriter, r *http.Request) {
+	idStr, format := feedFormat(r, r.PathValue("id"))
+
+	var id int
+	if _, err := fmt.Sscanf(idStr, "%d", &id); err != nil {
+		http.Error(w, "Invalid tournament ID", http.StatusBadRequest)
+		return
+	}
+
+	profile, ok := icsProfile(r)
+	if !ok {
+		http.Error(w, "Unknown profile", http.StatusBadRequest)
+		return
+	}
+
+	feed, err := app.icsService.CreateTournamentIcs(id, profile, format)
+	app.writeIcs(w, r, feed, err, format, fmt.Sprintf("tournament-%d", id))
+}
+
+// icsProfile picks the profile requested by ?profile= or detected from the User-Agent.
+func icsProfile(r *http.Request) (service.IcsProfile, bool) {
+	if name := r.URL.Query().Get("profile"); name != "" {
+		return service.IcsProfileByName(name)
+	}
+	return service.IcsProfileForUserAgent(r.UserAgent()), true
+}
+
+// feedFormats maps the supported feed formats to their media type and file extension.
+var feedFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	service.FEED_FORMAT_ICS:  {contentType: "text/calendar", extension: ".ics"},
+	service.FEED_FORMAT_JCAL: {contentType: "application/calendar+json", extension: ".json"},
+	service.FEED_FORMAT_XCAL: {contentType: "application/calendar+xml", extension: ".xml"},
+}
+
+// feedFormat strips a known file extension from the feed name and picks the
+// format from it, falling back to the Accept header and then to iCalendar.
+func feedFormat(r *http.Request, name string) (string, string) {
+	for format, f := range feedFormats {
+		if trimmed, ok := strings.CutSuffix(name, f.extension); ok {
+			return trimmed, format
+		}
+	}
+
+	accept := r.Header.Get("Accept")
+	for _, format := range []string{service.FEED_FORMAT_JCAL, service.FEED_FORMAT_XCAL} {
+		if strings.Contains(accept, feedFormats[format].contentType) {
+			return name, format
+		}
+	}
+	return name, service.FEED_FORMAT_ICS
+}
+
+func (app *WebApp) writeIcs(w http.ResponseWriter, r *http.Request, feed *service.IcsFeed, err error, format string, filename string) {
 	if err == service.NotFoundError {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
@@ -552,11 +818,15 @@ func (app *WebApp) IcsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
-	w.Header().Set("Content-Disposition", "attachment; filename=\"tournaments.ics\"")
+	w.Header().Set("Content-Type", feedFormats[format].contentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s%s\"", filename, feedFormats[format].extension))
+	w.Header().Set("ETag", feed.ETag)
+	// The rendered profile depends on the client, the format may depend on Accept
+	w.Header().Set("Vary", "User-Agent, Accept")
 	app.addCachingHeader(w)
 
-	w.Write([]byte(result))
+	// ServeContent answers If-None-Match and If-Modified-Since with 304
+	http.ServeContent(w, r, "", feed.ModifiedAt, strings.NewReader(feed.Content))
 }
 
 func (app *WebApp) EditCalendarFormHandler(w http.ResponseWriter, r *http.Request) {
@@ -566,14 +836,8 @@ func (app *WebApp) EditCalendarFormHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	calendar, err := app.calendaeService.GetCalendar(service.CalendarEditId(id))
-	if err != nil {
-		http.Error(w, "Calendar not found", http.StatusNotFound)
-		return
-	}
-
-	if calendar == nil {
-		http.Error(w, "Calendar not found", http.StatusNotFound)
+	calendar, editor, ok := app.editorAccess(w, r, model.EDITOR_ROLE_VIEWER)
+	if !ok {
 		return
 	}
 
@@ -589,12 +853,84 @@ func (app *WebApp) EditCalendarFormHandler(w http.ResponseWriter, r *http.Reques
 
 	series := app.tournamentService.GetAllSeries()
 
+	matching := []*model.Tournament{}
+	inheritedTournaments := []int{}
+	matcher, err := app.calendaeService.GetMatcher(calendar.Id, *calendar.Config)
+	if err != nil {
+		log.Printf("Invalid config in calendar %s: %s", calendar.Id, err.Error())
+	} else {
+		matching = app.tournamentService.GetMatchingTournaments(matcher)
+		for _, t := range matching {
+			if matcher.Inherited(t) {
+				inheritedTournaments = append(inheritedTournaments, t.Id)
+			}
+		}
+	}
+
+	attendance, err := app.calendaeService.GetAttendance(calendar)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	conflicts, err := app.calendaeService.GetConflicts(calendar, matching)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	seasons, season, groups := seasonView(matching, attendance, r.URL.Query().Get("season"))
+
+	notes, err := app.calendaeService.GetNotes(calendar)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	parents := []*model.Calendar{}
+	for _, parentId := range calendar.Config.Inherit {
+		if parent, err := app.calendaeService.GetCalendar(service.CalendarId(parentId)); err == nil && parent != nil {
+			parents = append(parents, parent)
+		}
+	}
+
+	editors := []*model.Editor{}
+	if service.HasRole(editor, model.EDITOR_ROLE_OWNER) {
+		if editors, err = app.calendaeService.GetEditors(calendar); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	auditLog, err := app.calendaeService.GetAuditLog(calendar)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	versions, err := app.calendaeService.GetVersions(calendar)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	feedStats, err := app.calendaeService.GetFeedStats(calendar, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	versionTournaments := map[int]string{}
+	for _, v := range versions {
+		for _, tournamentId := range slices.Concat(v.AddedTournaments, v.RemovedTournaments) {
+			versionTournaments[tournamentId] = fmt.Sprintf("#%d", tournamentId)
+			if t := app.tournamentService.GetTournament(tournamentId); t != nil {
+				versionTournaments[tournamentId] = t.Title
+			}
+		}
+	}
+
 	scheme := "https"
 	host := r.Host
 	calendarUrl := fmt.Sprintf("%s://%s/ical/%s", scheme, host, calendar.Id)
 
 	data := struct {
 		Lang            string
+		CsrfToken       string
 		PageTitle       string
 		FormAction      string
 		CalendarUrl     string
@@ -604,8 +940,34 @@ func (app *WebApp) EditCalendarFormHandler(w http.ResponseWriter, r *http.Reques
 		Calendar        *model.Calendar
 		Tournaments     []*model.Tournament
 		Series          []string
+		PdgaTiers       []string
+		Statuses        []string
+		MatchCount      int
+		Parents         []*model.Calendar
+		Inherited       []int
+		Seasons         []int
+		Season          int
+		Attendance      []AttendanceGroup
+		States          []string
+		Notes           map[int]string
+		NoteMaxLength   int
+		Conflicts       []service.Conflict
+		EditId          string
+		Rotated         string
+		GraceDays       []int
+		Editor          *model.Editor
+		CanEdit         bool
+		IsOwner         bool
+		Editors         []*model.Editor
+		Roles           []string
+		InviteUrl       string
+		AuditLog        []*model.AuditEntry
+		Versions        []service.CalendarVersion
+		VersionTitles   map[int]string
+		FeedStats       *service.FeedStats
 	}{
 		Lang:            GetLanguageFromContext(r.Context()),
+		CsrfToken:       csrfToken(w, r),
 		PageTitle:       "Edit Calendar",
 		FormAction:      "/calendar/edit/" + id,
 		CalendarUrl:     calendarUrl,
@@ -615,6 +977,31 @@ func (app *WebApp) EditCalendarFormHandler(w http.ResponseWriter, r *http.Reques
 		Calendar:        calendar,
 		Tournaments:     tournaments,
 		Series:          series,
+		PdgaTiers:       pdgaTiers,
+		Statuses:        ruleStatuses,
+		MatchCount:      len(matching),
+		Parents:         parents,
+		Inherited:       inheritedTournaments,
+		Seasons:         seasons,
+		Season:          season,
+		Attendance:      groups,
+		States:          service.AttendanceStatuses,
+		Notes:           notes,
+		NoteMaxLength:   service.NOTE_MAX_LENGTH,
+		Conflicts:       conflicts,
+		EditId:          id,
+		Rotated:         r.URL.Query().Get("rotated"),
+		GraceDays:       rotationGraceDays,
+		Editor:          editor,
+		CanEdit:         service.HasRole(editor, model.EDITOR_ROLE_EDITOR),
+		IsOwner:         service.HasRole(editor, model.EDITOR_ROLE_OWNER),
+		Editors:         editors,
+		Roles:           service.EditorRoles,
+		InviteUrl:       fmt.Sprintf("%s://%s/calendar/invite/", scheme, host),
+		AuditLog:        auditLog,
+		Versions:        versions,
+		VersionTitles:   versionTournaments,
+		FeedStats:       feedStats,
 	}
 
 	if err := app.templates.ExecuteTemplate(w, "calendar-form.html", data); err != nil {
@@ -635,9 +1022,8 @@ func (app *WebApp) EditCalendarHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	calendar, err := app.calendaeService.GetCalendar(service.CalendarEditId(id))
-	if err != nil || calendar == nil {
-		http.Error(w, "Calendar not found", http.StatusNotFound)
+	calendar, editor, ok := app.editorAccess(w, r, model.EDITOR_ROLE_EDITOR)
+	if !ok {
 		return
 	}
 
@@ -647,39 +1033,529 @@ func (app *WebApp) EditCalendarHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse tournament IDs
-	tournamentIds := []int{}
-	if err := r.ParseForm(); err == nil {
-		for _, idStr := range r.Form["tournaments"] {
-			var id int
-			if _, err := fmt.Sscanf(idStr, "%d", &id); err == nil {
-				tournamentIds = append(tournamentIds, id)
-			}
-		}
+	config, err := subscriptionConfigFromForm(r)
+	if err == nil {
+		_, err = app.formMatcher(calendar.Id, config)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Parse series
-	series := r.Form["series"]
+	// Notes are posted as note_<tournament id>
+	notes := map[int]string{}
+	for key, values := range r.PostForm {
+		idStr, ok := strings.CutPrefix(key, "note_")
+		if !ok {
+			continue
+		}
+		tournamentId, err := strconv.Atoi(idStr)
+		if err != nil || app.tournamentService.GetTournament(tournamentId) == nil {
+			continue
+		}
+		notes[tournamentId] = values[0]
+	}
+	if err := app.calendaeService.SetNotes(calendar, notes); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Update calendar
+	oldTitle, oldConfig := calendar.Title, *calendar.Config
 	calendar.Title = title
-	calendar.Config = &model.SubscriptionConfig{
-		Tournaments: tournamentIds,
-		Series:      series,
-	}
+	calendar.Config = &config
 
 	_, err = app.calendaeService.UpdateCalendar(calendar)
 	if err != nil {
 		http.Error(w, "Failed to update calendar: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := app.calendaeService.RecordChange(calendar, editor, oldTitle, oldConfig); err != nil {
+		log.Printf("Could not record change of calendar %s: %s", calendar.Id, err.Error())
+	}
 
 	// Redirect back to edit page with success message
 	http.Redirect(w, r, "/calendar/edit/"+id, http.StatusSeeOther)
 }
 
+type AttendanceGroup struct {
+	Status      string
+	Tournaments []*model.Tournament
+}
+
+// seasonView groups the tournaments of one season by attendance status. The
+// season defaults to the current year if the calendar has tournaments in it.
+func seasonView(tournaments []*model.Tournament, attendance map[int]string, selected string) ([]int, int, []AttendanceGroup) {
+	seasons := []int{}
+	for _, t := range tournaments {
+		if !slices.Contains(seasons, t.StartDate.Year()) {
+			seasons = append(seasons, t.StartDate.Year())
+		}
+	}
+	slices.Sort(seasons)
+
+	season := time.Now().Year()
+	if s, err := strconv.Atoi(selected); err == nil {
+		season = s
+	} else if !slices.Contains(seasons, season) && len(seasons) > 0 {
+		season = seasons[len(seasons)-1]
+	}
+
+	groups := []AttendanceGroup{{Status: ""}}
+	for _, status := range service.AttendanceStatuses {
+		groups = append(groups, AttendanceGroup{Status: status})
+	}
+
+	slices.SortFunc(tournaments, func(a, b *model.Tournament) int { return a.StartDate.Compare(b.StartDate) })
+	for _, t := range tournaments {
+		if t.StartDate.Year() != season {
+			continue
+		}
+		for i := range groups {
+			if groups[i].Status == attendance[t.Id] {
+				groups[i].Tournaments = append(groups[i].Tournaments, t)
+			}
+		}
+	}
+	return seasons, season, groups
+}
+
+// AttendanceHandler stores the attendance status of a tournament from the
+// season view on the edit page.
+func (app *WebApp) AttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	calendar, _, ok := app.editorAccess(w, r, model.EDITOR_ROLE_EDITOR)
+	if !ok {
+		return
+	}
+
+	tournamentId, err := strconv.Atoi(r.FormValue("tournament"))
+	if err != nil || app.tournamentService.GetTournament(tournamentId) == nil {
+		http.Error(w, "Tournament not found", http.StatusBadRequest)
+		return
+	}
+
+	status := r.FormValue("status")
+	if status != "" && !slices.Contains(service.AttendanceStatuses, status) {
+		http.Error(w, "Unknown status", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.calendaeService.SetAttendance(calendar, tournamentId, status); err != nil {
+		http.Error(w, "Failed to update attendance: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/calendar/edit/%s?season=%s#season", id, url.QueryEscape(r.FormValue("season"))), http.StatusSeeOther)
+}
+
+// editorAccess resolves the secret in the path to its calendar and editor.
+// It responds with an error and returns false if the secret is unknown or the
+// editor lacks role.
+func (app *WebApp) editorAccess(w http.ResponseWriter, r *http.Request, role string) (*model.Calendar, *model.Editor, bool) {
+	// Clients guessing edit codes are locked out
+	if wait := app.limits.LockedOut(r, time.Now()); wait > 0 {
+		tooManyRequests(w, r, wait)
+		return nil, nil, false
+	}
+
+	calendar, editor, err := app.calendaeService.GetEditor(r.PathValue("id"))
+	if err == nil && calendar == nil {
+		app.limits.Failed(r, time.Now())
+	}
+	if err != nil || calendar == nil {
+		http.Error(w, "Calendar not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if !service.HasRole(editor, role) {
+		http.Error(w, "Not allowed for your role", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return calendar, editor, true
+}
+
+// InviteEditorHandler creates an invite link for a new editor of the calendar.
+func (app *WebApp) InviteEditorHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	calendar, _, ok := app.editorAccess(w, r, model.EDITOR_ROLE_OWNER)
+	if !ok {
+		return
+	}
+
+	if _, err := app.calendaeService.InviteEditor(calendar, r.FormValue("name"), r.FormValue("role")); err != nil {
+		if errors.Is(err, service.InvalidEditorError) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to invite editor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/calendar/edit/%s#editors", r.PathValue("id")), http.StatusSeeOther)
+}
+
+func (app *WebApp) RevokeEditorHandler(w http.ResponseWriter, r *http.Request) {
+	calendar, _, ok := app.editorAccess(w, r, model.EDITOR_ROLE_OWNER)
+	if !ok {
+		return
+	}
+
+	editorId, err := strconv.Atoi(r.PathValue("editor"))
+	if err != nil {
+		http.Error(w, "Invalid editor", http.StatusBadRequest)
+		return
+	}
+
+	if err := app.calendaeService.RevokeEditor(calendar, editorId); err != nil {
+		http.Error(w, "Failed to revoke editor: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/calendar/edit/%s#editors", r.PathValue("id")), http.StatusSeeOther)
+}
+
+// RestoreVersionHandler sets the calendar back to a version from its
+// history.
+func (app *WebApp) RestoreVersionHandler(w http.ResponseWriter, r *http.Request) {
+	calendar, editor, ok := app.editorAccess(w, r, model.EDITOR_ROLE_EDITOR)
+	if !ok {
+		return
+	}
+
+	versionId, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	err = app.calendaeService.RestoreVersion(calendar, editor, versionId)
+	if errors.Is(err, service.VersionNotFoundError) {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.InheritanceCycleError) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to restore version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/calendar/edit/%s#versions", r.PathValue("id")), http.StatusSeeOther)
+}
+
+// AcceptInviteHandler turns an invite link into the personal edit link of the
+// editor. The link works only once.
+func (app *WebApp) AcceptInviteHandler(w http.ResponseWriter, r *http.Request) {
+	editor, err := app.calendaeService.AcceptInvite(r.PathValue("token"))
+	if err != nil {
+		http.Error(w, "Failed to accept invitation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if editor == nil {
+		app.NotFoundHandler(w, r)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/calendar/edit/%s?rotated=invite#access", editor.Secret), http.StatusSeeOther)
+}
+
+// rotationGraceDays are the periods an owner can keep a revoked feed URL
+// working for.
+var rotationGraceDays = []int{0, 7, 30}
+
+// RotateEditIdHandler replaces the access code the editor used and continues
+// on the edit page with the new code.
+func (app *WebApp) RotateEditIdHandler(w http.ResponseWriter, r *http.Request) {
+	calendar, editor, ok := app.editorAccess(w, r, model.EDITOR_ROLE_VIEWER)
+	if !ok {
+		return
+	}
+
+	editId, err := app.calendaeService.RotateEditorSecret(calendar, editor)
+	if err != nil {
+		http.Error(w, "Failed to rotate edit code: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/calendar/edit/%s?rotated=edit#access", editId), http.StatusSeeOther)
+}
+
+// RotateIdHandler gives a calendar a new feed URL. The old URL redirects for
+// the chosen number of days and is gone afterwards.
+func (app *WebApp) RotateIdHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	calendar, _, ok := app.editorAccess(w, r, model.EDITOR_ROLE_OWNER)
+	if !ok {
+		return
+	}
+
+	days, err := strconv.Atoi(r.FormValue("grace"))
+	if err != nil || !slices.Contains(rotationGraceDays, days) {
+		http.Error(w, "Invalid grace period", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := app.calendaeService.RotateId(calendar, time.Duration(days)*24*time.Hour); err != nil {
+		http.Error(w, "Failed to rotate calendar URL: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/calendar/edit/%s?rotated=feed#access", id), http.StatusSeeOther)
+}
+
+// EmailHandler sets the address notifications of the calendar are sent to.
+// The address has to be confirmed through the link mailed to it, an empty
+// address turns notifications off.
+func (app *WebApp) EmailHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	calendar, _, ok := app.editorAccess(w, r, model.EDITOR_ROLE_OWNER)
+	if !ok {
+		return
+	}
+
+	if err := app.notifications.RequestEmail(calendar, r.FormValue("email"), time.Now()); err != nil {
+		if errors.Is(err, service.InvalidEmailError) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.TooManyEmailRequestsError) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "Failed to update email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/calendar/edit/%s#email", id), http.StatusSeeOther)
+}
+
+// ConfirmEmailHandler activates an address through the link of the
+// confirmation mail.
+func (app *WebApp) ConfirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	calendar, err := app.notifications.ConfirmEmail(r.PathValue("token"), time.Now())
+	if err != nil {
+		http.Error(w, "Failed to confirm email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if calendar == nil {
+		app.renderEmailStatus(w, r, http.StatusNotFound, "email.invalid_link", "", "")
+		return
+	}
+	app.renderEmailStatus(w, r, http.StatusOK, "email.confirmed", "", "")
+}
+
+// UnsubscribeFormHandler asks before turning notifications off, so link
+// scanners of mail providers do not unsubscribe by opening the link.
+func (app *WebApp) UnsubscribeFormHandler(w http.ResponseWriter, r *http.Request) {
+	app.renderEmailStatus(w, r, http.StatusOK, "email.unsubscribe_question", "/calendar/email/unsubscribe/"+r.PathValue("token"), "email.unsubscribe")
+}
+
+func (app *WebApp) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	ok, err := app.notifications.Unsubscribe(r.PathValue("token"))
+	if err != nil {
+		http.Error(w, "Failed to unsubscribe: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		app.renderEmailStatus(w, r, http.StatusNotFound, "email.invalid_link", "", "")
+		return
+	}
+	app.renderEmailStatus(w, r, http.StatusOK, "email.unsubscribed", "", "")
+}
+
+func (app *WebApp) renderEmailStatus(w http.ResponseWriter, r *http.Request, status int, message string, action string, button string) {
+	data := struct {
+		Lang      string
+		CsrfToken string
+		Message   string
+		Action    string
+		Button    string
+	}{
+		Lang:      GetLanguageFromContext(r.Context()),
+		CsrfToken: csrfToken(w, r),
+		Message:   message,
+		Action:    action,
+		Button:    button,
+	}
+
+	w.WriteHeader(status)
+	if err := app.templates.ExecuteTemplate(w, "email.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
+// CalendarPreviewHandler counts the tournaments matched by the submitted
+// calendar form, so rules can be tried out before saving.
+func (app *WebApp) CalendarPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	result := struct {
+		Count int    `json:"count"`
+		Error string `json:"error,omitempty"`
+	}{}
+
+	config, err := subscriptionConfigFromForm(r)
+	if err == nil {
+		var matcher *service.TournamentMatcher
+		if matcher, err = app.formMatcher(r.FormValue("calendar"), config); err == nil {
+			result.Count = len(app.tournamentService.GetMatchingTournaments(matcher))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		result.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// formMatcher validates a config posted by calendar-form.html, which may
+// reference calendars that do not exist.
+func (app *WebApp) formMatcher(id string, config model.SubscriptionConfig) (*service.TournamentMatcher, error) {
+	for _, parentId := range config.Inherit {
+		parent, err := app.calendaeService.GetCalendar(service.CalendarId(parentId))
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, fmt.Errorf("calendar %s not found", parentId)
+		}
+	}
+	return app.calendaeService.GetMatcher(id, config)
+}
+
+var pdgaTiers = []string{"A", "B", "C"}
+
+var ruleStatuses = []string{
+	model.TOURNAMENT_STATUS_PROVISIONAL,
+	model.TOURNAMENT_STATUS_ANNOUNCED,
+	model.TOURNAMENT_STATUS_REGISTRATION,
+	model.TOURNAMENT_STATUS_IN_PROGRESS,
+	model.TOURNAMENT_STATUS_DONE,
+	model.TOURNAMENT_STATUS_CANCELLED,
+}
+
+// subscriptionConfigFromForm reads the tournament selection, rules and
+// options posted by calendar-form.html.
+func subscriptionConfigFromForm(r *http.Request) (model.SubscriptionConfig, error) {
+	config := model.SubscriptionConfig{
+		Tournaments:       formIds(r.Form["tournaments"]),
+		Series:            r.Form["series"],
+		Tasks:             r.FormValue("tasks") == "on",
+		Exclude:           formIds(r.Form["exclude"]),
+		Inherit:           []string{},
+		AnnotateConflicts: r.FormValue("annotate_conflicts") == "on",
+		Rules: model.SubscriptionRules{
+			PdgaTiers:   r.Form["rule_tier"],
+			DRatingOnly: r.FormValue("rule_drating") == "on",
+			Title:       strings.TrimSpace(r.FormValue("rule_title")),
+			Location:    strings.TrimSpace(r.FormValue("rule_location")),
+			Regex:       r.FormValue("rule_regex") == "on",
+			Status:      r.Form["rule_status"],
+		},
+	}
+
+	// Accept the subscription URL as well as the bare public id
+	for _, value := range r.Form["inherit"] {
+		value, _, _ = strings.Cut(strings.TrimSpace(value), "?")
+		value = value[strings.LastIndex(value, "/")+1:]
+		value = strings.TrimSuffix(value, path.Ext(value))
+		if value != "" && !slices.Contains(config.Inherit, value) {
+			config.Inherit = append(config.Inherit, value)
+		}
+	}
+
+	if value := r.FormValue("conflict_window"); value != "" {
+		window, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid conflict window %q", value)
+		}
+		config.ConflictWindow = window
+	}
+
+	err := validateSubscriptionConfig(&config, r.FormValue("rule_from"), r.FormValue("rule_to"))
+	return config, err
+}
+
+// validateSubscriptionConfig checks the conflict window and sets the date
+// rules from the dates from and to (YYYY-MM-DD, empty for none). The form and
+// the API both use it.
+func validateSubscriptionConfig(config *model.SubscriptionConfig, from string, to string) error {
+	if config.ConflictWindow < 0 || config.ConflictWindow > 24*60 {
+		return fmt.Errorf("invalid conflict window %d", config.ConflictWindow)
+	}
+	dates := []struct {
+		name  string
+		value string
+		date  **time.Time
+	}{
+		{"from", from, &config.Rules.From},
+		{"to", to, &config.Rules.To},
+	}
+	for _, d := range dates {
+		if d.value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", d.value)
+		if err != nil {
+			return fmt.Errorf("invalid date %q for %s", d.value, d.name)
+		}
+		*d.date = &date
+	}
+	return nil
+}
+
+func formIds(values []string) []int {
+	ids := []int{}
+	for _, idStr := range values {
+		var id int
+		if _, err := fmt.Sscanf(idStr, "%d", &id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 func (app *WebApp) AccessCalendarFormHandler(w http.ResponseWriter, r *http.Request) {
-	data := struct{ Lang string }{Lang: GetLanguageFromContext(r.Context())}
+	data := struct {
+		Lang         string
+		CsrfToken    string
+		RecoverySent bool
+	}{
+		Lang:         GetLanguageFromContext(r.Context()),
+		CsrfToken:    csrfToken(w, r),
+		RecoverySent: r.URL.Query().Get("recovery") == "sent",
+	}
 	if err := app.templates.ExecuteTemplate(w, "access-calendar.html", data); err != nil {
 		log.Printf("Template execution error: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -702,6 +1578,47 @@ func (app *WebApp) AccessCalendarHandler(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, "/calendar/edit/"+editId, http.StatusSeeOther)
 }
 
+// RecoverHandler mails the edit links of the calendars registered for an
+// address. The response is the same whether the address is known or not.
+func (app *WebApp) RecoverHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form", http.StatusBadRequest)
+		return
+	}
+
+	err := app.notifications.RecoverEditLinks(r.FormValue("email"), time.Now())
+	if errors.Is(err, service.InvalidEmailError) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Recovery failed: %s", err.Error())
+	}
+
+	http.Redirect(w, r, "/calendar/edit?recovery=sent", http.StatusSeeOther)
+}
+
+// RenewEditCodesFormHandler asks before renewing the edit codes through the
+// link of a recovery mail, so link scanners of mail providers do not renew
+// them by opening the link.
+func (app *WebApp) RenewEditCodesFormHandler(w http.ResponseWriter, r *http.Request) {
+	app.renderEmailStatus(w, r, http.StatusOK, "recovery.renew_question", "/calendar/recover/"+r.PathValue("token"), "recovery.renew_button")
+}
+
+func (app *WebApp) RenewEditCodesHandler(w http.ResponseWriter, r *http.Request) {
+	ok, err := app.notifications.RenewEditCodes(r.PathValue("token"), time.Now())
+	if err != nil {
+		http.Error(w, "Failed to renew edit codes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !ok {
+		app.renderEmailStatus(w, r, http.StatusNotFound, "email.invalid_link", "", "")
+		return
+	}
+	app.renderEmailStatus(w, r, http.StatusOK, "recovery.renewed", "", "")
+}
+
 func (app *WebApp) CommonCSSHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/css; charset=utf-8")
 	w.Header().Set("Cache-Control", "public, max-age=3600")
@@ -745,6 +1662,20 @@ func (app *WebApp) FontHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(fontData)
 }
 
+// ScriptHandler serves the scripts of single pages, which can't be inline
+// because of the Content-Security-Policy.
+func (app *WebApp) ScriptHandler(w http.ResponseWriter, r *http.Request) {
+	script, err := scriptsFS.ReadFile("js/" + r.PathValue("name"))
+	if err != nil {
+		http.Error(w, "Script not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(script)
+}
+
 func (app *WebApp) TournamentDetailHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	if idStr == "" {
@@ -766,9 +1697,11 @@ func (app *WebApp) TournamentDetailHandler(w http.ResponseWriter, r *http.Reques
 
 	data := struct {
 		Lang string
+		Host string
 		*model.Tournament
 	}{
 		Lang:       GetLanguageFromContext(r.Context()),
+		Host:       r.Host,
 		Tournament: tournament,
 	}
 
@@ -791,15 +1724,88 @@ func (app *WebApp) AdminHandler(w http.ResponseWriter, r *http.Request) {
 		return calendars[i].CreatedAt.After(calendars[j].CreatedAt)
 	})
 
+	clientStats, err := app.calendaeService.GetClientStats(time.Now())
+	if err != nil {
+		log.Printf("Failed to get client stats: %v", err)
+		http.Error(w, "Failed to retrieve client stats", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Lang        string
+		CsrfToken   string
+		Calendars   []*model.Calendar
+		ClientStats []*model.ClientStats
+		Deleted     string
+	}{
+		Lang:        GetLanguageFromContext(r.Context()),
+		CsrfToken:   csrfToken(w, r),
+		Calendars:   calendars,
+		ClientStats: clientStats,
+		Deleted:     r.URL.Query().Get("deleted"),
+	}
+
+	if err := app.templates.ExecuteTemplate(w, "admin.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// AdminRetentionHandler shows what the next retention run would do, without
+// doing it.
+func (app *WebApp) AdminRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	actions, err := app.retention.Plan(time.Now())
+	if err != nil {
+		log.Printf("Failed to plan retention: %v", err)
+		http.Error(w, "Failed to plan retention", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].Action != actions[j].Action {
+			return actions[i].Action < actions[j].Action
+		}
+		return actions[i].Calendar.CreatedAt.Before(actions[j].Calendar.CreatedAt)
+	})
+
+	policy := app.retention.Policy()
+	data := struct {
+		Lang         string
+		Mode         string
+		CsrfToken    string
+		Actions      []service.RetentionAction
+		UnusedDays   int
+		InactiveDays int
+		GraceDays    int
+	}{
+		Lang:         GetLanguageFromContext(r.Context()),
+		Mode:         policy.Mode,
+		CsrfToken:    csrfToken(w, r),
+		Actions:      actions,
+		UnusedDays:   int(policy.UnusedAfter.Hours() / 24),
+		InactiveDays: int(policy.InactiveAfter.Hours() / 24),
+		GraceDays:    int(policy.Grace.Hours() / 24),
+	}
+
+	if err := app.templates.ExecuteTemplate(w, "admin-retention.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// AdminLimitsHandler shows the counters of the rate limits and lockouts
+// since the last restart.
+func (app *WebApp) AdminLimitsHandler(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Lang      string
-		Calendars []*model.Calendar
+		CsrfToken string
+		Stats     RateLimitStats
 	}{
 		Lang:      GetLanguageFromContext(r.Context()),
-		Calendars: calendars,
+		CsrfToken: csrfToken(w, r),
+		Stats:     app.limits.Stats(time.Now()),
 	}
 
-	if err := app.templates.ExecuteTemplate(w, "admin.html", data); err != nil {
+	if err := app.templates.ExecuteTemplate(w, "admin-limits.html", data); err != nil {
 		log.Printf("Template execution error: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -824,8 +1830,62 @@ func (app *WebApp) DeleteCalendarHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Redirect back to admin page
-	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+	// Redirect back to admin page, which offers to undo the deletion
+	http.Redirect(w, r, "/admin?deleted="+url.QueryEscape(calendarId), http.StatusSeeOther)
+}
+
+// AdminTrashHandler lists deleted calendars, which are purged by the
+// retention policy after its grace period.
+func (app *WebApp) AdminTrashHandler(w http.ResponseWriter, r *http.Request) {
+	calendars, err := app.calendaeService.GetDeletedCalendars()
+	if err != nil {
+		log.Printf("Failed to get deleted calendars: %v", err)
+		http.Error(w, "Failed to retrieve calendars", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Lang      string
+		CsrfToken string
+		Calendars []*model.Calendar
+		Grace     time.Duration
+	}{
+		Lang:      GetLanguageFromContext(r.Context()),
+		CsrfToken: csrfToken(w, r),
+		Calendars: calendars,
+		Grace:     app.retention.Policy().Grace,
+	}
+
+	if err := app.templates.ExecuteTemplate(w, "admin-trash.html", data); err != nil {
+		log.Printf("Template execution error: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (app *WebApp) RestoreCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	calendarId := r.PathValue("id")
+	if err := app.calendaeService.RestoreCalendar(calendarId); err != nil {
+		log.Printf("Failed to restore calendar: %v", err)
+		http.Error(w, "Failed to restore calendar", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/calendar/"+url.PathEscape(calendarId), http.StatusSeeOther)
+}
+
+func (app *WebApp) PurgeCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.calendaeService.PurgeCalendar(r.PathValue("id"))
+	if errors.Is(err, service.NotInTrashError) {
+		http.Error(w, "Only deleted calendars can be purged", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to purge calendar: %v", err)
+		http.Error(w, "Failed to purge calendar", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/trash", http.StatusSeeOther)
 }
 
 func (app *WebApp) AdminViewCalendarHandler(w http.ResponseWriter, r *http.Request) {
@@ -861,11 +1921,13 @@ func (app *WebApp) AdminViewCalendarHandler(w http.ResponseWriter, r *http.Reque
 
 	data := struct {
 		Lang          string
+		CsrfToken     string
 		Calendar      *model.Calendar
 		TournamentIds string
 		Series        []string
 	}{
 		Lang:          GetLanguageFromContext(r.Context()),
+		CsrfToken:     csrfToken(w, r),
 		Calendar:      calendar,
 		TournamentIds: tournamentIds,
 		Series:        series,
@@ -925,18 +1987,21 @@ func (app *WebApp) AdminUpdateCalendarHandler(w http.ResponseWriter, r *http.Req
 	// Parse series from form array
 	series := r.Form["series"]
 
-	// Update calendar
+	// Update calendar, keeping options the admin form does not show
+	oldTitle, oldConfig := calendar.Title, *calendar.Config
 	calendar.Title = title
-	calendar.Config = &model.SubscriptionConfig{
-		Tournaments: tournamentIds,
-		Series:      series,
-	}
+	calendar.Config.Tournaments = tournamentIds
+	calendar.Config.Series = series
 
 	_, err = app.calendaeService.UpdateCalendar(calendar)
 	if err != nil {
 		http.Error(w, "Failed to update calendar: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	admin := &model.Editor{Name: "Admin", Role: model.EDITOR_ROLE_OWNER}
+	if err := app.calendaeService.RecordChange(calendar, admin, oldTitle, oldConfig); err != nil {
+		log.Printf("Could not record change of calendar %s: %s", calendar.Id, err.Error())
+	}
 
 	// Redirect back to admin view page
 	http.Redirect(w, r, "/admin/calendar/"+calendarId, http.StatusSeeOther)
@@ -977,9 +2042,11 @@ func (app *WebApp) AdminTournamentsHandler(w http.ResponseWriter, r *http.Reques
 
 	data := struct {
 		Lang        string
+		CsrfToken   string
 		Tournaments []TournamentWithCount
 	}{
 		Lang:        GetLanguageFromContext(r.Context()),
+		CsrfToken:   csrfToken(w, r),
 		Tournaments: tournamentData,
 	}
 
@@ -1022,10 +2089,12 @@ func (app *WebApp) AdminTournamentHistoryHandler(w http.ResponseWriter, r *http.
 
 	data := struct {
 		Lang       string
+		CsrfToken  string
 		Tournament *model.Tournament
 		History    []*model.Tournament
 	}{
 		Lang:       GetLanguageFromContext(r.Context()),
+		CsrfToken:  csrfToken(w, r),
 		Tournament: tournament,
 		History:    history,
 	}